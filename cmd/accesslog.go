@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/urfave/negroni"
+)
+
+const (
+	accessLogNegroni  = "negroni"
+	accessLogCommon   = "common"
+	accessLogCombined = "combined"
+	accessLogJSON     = "json"
+)
+
+type accessLogKey struct{}
+
+// accessLogInfo carries details learnt further down the middleware chain, such as
+// the authenticated user, back to the access logger.
+type accessLogInfo struct {
+	user string
+}
+
+type accessLogEntry struct {
+	Time       string  `json:"time"`
+	RemoteAddr string  `json:"remoteAddr"`
+	User       string  `json:"user,omitempty"`
+	RequestID  string  `json:"requestId,omitempty"`
+	Method     string  `json:"method"`
+	Path       string  `json:"path"`
+	Proto      string  `json:"proto"`
+	Status     int     `json:"status"`
+	Bytes      int     `json:"bytes"`
+	DurationMs float64 `json:"durationMs"`
+	Referer    string  `json:"referer,omitempty"`
+	UserAgent  string  `json:"userAgent,omitempty"`
+}
+
+var accessLogger = log.New(os.Stdout, "", 0)
+
+// setAccessLogUser records the authenticated user for the access log entry of r.
+func setAccessLogUser(r *http.Request, user string) {
+	if info, ok := r.Context().Value(accessLogKey{}).(*accessLogInfo); ok {
+		info.user = user
+	}
+}
+
+func newAccessLogger(format string) (negroni.Handler, error) {
+	switch format {
+	case "", accessLogNegroni:
+		return negroni.NewLogger(), nil
+	case accessLogCommon, accessLogCombined, accessLogJSON:
+		return accessLog(format), nil
+	default:
+		return nil, fmt.Errorf("ACCESS_LOG_FORMAT must be one of %s, %s, %s, %s", accessLogNegroni, accessLogCommon, accessLogCombined, accessLogJSON)
+	}
+}
+
+func accessLog(format string) negroni.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		start := time.Now()
+		info := &accessLogInfo{}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), accessLogKey{}, info)))
+
+		res := w.(negroni.ResponseWriter)
+		status := res.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+
+		switch format {
+		case accessLogJSON:
+			b, _ := json.Marshal(accessLogEntry{
+				Time:       start.Format(time.RFC3339Nano),
+				RemoteAddr: host,
+				User:       info.user,
+				RequestID:  r.Header.Get("X-Request-ID"),
+				Method:     r.Method,
+				Path:       r.URL.RequestURI(),
+				Proto:      r.Proto,
+				Status:     status,
+				Bytes:      res.Size(),
+				DurationMs: float64(time.Since(start)) / float64(time.Millisecond),
+				Referer:    r.Referer(),
+				UserAgent:  r.UserAgent(),
+			})
+			accessLogger.Println(string(b))
+		default:
+			line := fmt.Sprintf("%s - %s [%s] %q %d %d",
+				host,
+				orDash(info.user),
+				start.Format("02/Jan/2006:15:04:05 -0700"),
+				r.Method+" "+r.URL.RequestURI()+" "+r.Proto,
+				status,
+				res.Size(),
+			)
+			if format == accessLogCombined {
+				line += fmt.Sprintf(" %q %q", orDash(r.Referer()), orDash(r.UserAgent()))
+			}
+			accessLogger.Println(line)
+		}
+	}
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ActionValue is the value of a policy action field. It only decodes from a JSON number
+// that is a whole number within the action bounds, so a value that slips past decoding
+// can't be misread by a later change to how actions are stored or compared.
+type ActionValue int
+
+var actionValueType = reflect.TypeOf(ActionValue(0))
+
+// Values of json.UnmarshalTypeError.Value for numbers that are not valid actions. The
+// decoder adds the field name to an UnmarshalTypeError, so decodePolicy can turn these
+// into validation errors that name the field.
+const (
+	actionNotWhole   = "fractional number"
+	actionOutOfRange = "out of range number"
+)
+
+// UnmarshalJSON accepts any spelling of a whole number, e.g. 2 or 2.0, between
+// minPolicyAction and maxPolicyAction. A null field is left to the decoder, so it
+// stays nil and is reported as missing.
+func (a *ActionValue) UnmarshalJSON(b []byte) error {
+	if kind := jsonKind(b); kind != "number" {
+		return &json.UnmarshalTypeError{Value: kind, Type: actionValueType}
+	}
+
+	// numbers too large for a float64 fail to parse and are out of range as well
+	f, err := strconv.ParseFloat(string(b), 64)
+	if err == nil && f != math.Trunc(f) {
+		return &json.UnmarshalTypeError{Value: actionNotWhole, Type: actionValueType}
+	}
+	if err != nil || f < minPolicyAction || f > maxPolicyAction {
+		return &json.UnmarshalTypeError{Value: actionOutOfRange, Type: actionValueType}
+	}
+
+	*a = ActionValue(f)
+	return nil
+}
+
+// jsonKind names the kind of a JSON value the way json.UnmarshalTypeError does.
+func jsonKind(b []byte) string {
+	switch b[0] {
+	case '"':
+		return "string"
+	case 't', 'f':
+		return "bool"
+	case '{':
+		return "object"
+	case '[':
+		return "array"
+	case 'n':
+		return "null"
+	default:
+		return "number"
+	}
+}
+
+// actionValueError turns the decoding error of an invalid action number in the policy
+// object raw into a validation error for its field, or returns nil for any other error.
+func actionValueError(err error, raw json.RawMessage) error {
+	typeErr, ok := err.(*json.UnmarshalTypeError)
+	if !ok || typeErr.Type != actionValueType {
+		return nil
+	}
+
+	field := typeErr.Field
+	if field == "" {
+		// not every version of encoding/json names the field of an UnmarshalJSON error
+		field = invalidActionField(raw)
+	}
+
+	switch typeErr.Value {
+	case actionNotWhole:
+		recordValidationFailure(field, reasonWrongType)
+		return localizedError{key: msgFieldNotWhole, args: []interface{}{field}}
+	case actionOutOfRange:
+		recordValidationFailure(field, reasonOutOfRange)
+		return localizedError{key: msgFieldOutOfRange, args: []interface{}{field, minPolicyAction, maxPolicyAction}}
+	}
+
+	return nil
+}
+
+// invalidActionField names the first action field, in validation order, whose value in
+// the policy object raw is a number ActionValue rejects.
+func invalidActionField(raw json.RawMessage) string {
+	var values map[string]json.RawMessage
+	json.Unmarshal(raw, &values)
+
+	for _, field := range actionFields(Policy{}) {
+		for name, value := range values {
+			var a ActionValue
+			if strings.EqualFold(name, field.name) && jsonKind(value) == "number" && a.UnmarshalJSON(value) != nil {
+				return field.name
+			}
+		}
+	}
+
+	return ""
+}
+
+// parseActionValue parses an action value from configuration, where only the plain
+// integer spelling is accepted.
+func parseActionValue(s string) (ActionValue, bool) {
+	i, err := strconv.Atoi(s)
+	if err != nil || i < minPolicyAction || i > maxPolicyAction {
+		return 0, false
+	}
+
+	return ActionValue(i), true
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecodePolicyActions(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    ActionValue
+		wantErr string
+	}{
+		{name: "integer", value: "2", want: 2},
+		{name: "whole float", value: "2.0", want: 2},
+		{name: "exponent", value: "2e0", want: 2},
+		{name: "lowest", value: "1", want: 1},
+		{name: "highest", value: "4", want: 4},
+		{name: "below range", value: "0", wantErr: "UnprocessableFileTypeAction must be between 1-4"},
+		{name: "above range", value: "5", wantErr: "UnprocessableFileTypeAction must be between 1-4"},
+		{name: "negative", value: "-1", wantErr: "UnprocessableFileTypeAction must be between 1-4"},
+		{name: "too large for a float", value: "1e400", wantErr: "UnprocessableFileTypeAction must be between 1-4"},
+		{name: "fractional", value: "1.5", wantErr: "UnprocessableFileTypeAction must be a whole number"},
+		{name: "string", value: `"2"`, wantErr: "invalid value"},
+		{name: "bool", value: "true", wantErr: "invalid value"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := decodePolicy(strings.NewReader(`{"UnprocessableFileTypeAction":` + tt.value + `,"GlasswallBlockedFilesAction":1}`))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if *p.UnprocessableFileTypeAction != tt.want {
+					t.Errorf("action = %d, want %d", *p.UnprocessableFileTypeAction, tt.want)
+				}
+				return
+			}
+
+			w := httptest.NewRecorder()
+			writePolicyError(w, httptest.NewRequest("PUT", policyPath, nil), err)
+			if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tt.wantErr) {
+				t.Errorf("error = %d %s, want 400 with %q", w.Code, w.Body, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDecodeStoredPolicyActions(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  *ActionValue
+	}{
+		{name: "integer", value: "2", want: action(2)},
+		{name: "whole float", value: "3.0", want: action(3)},
+		{name: "out of range is kept", value: "7", want: action(7)},
+		{name: "negative is kept", value: "-1", want: action(-1)},
+		{name: "fractional is left out", value: "1.5"},
+		{name: "too large is left out", value: "1e400"},
+		{name: "string is left out", value: `"2"`},
+		{name: "null", value: "null"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := decodeStoredPolicy(`{"UnprocessableFileTypeAction":` + tt.value + `,"GlasswallBlockedFilesAction":1}`)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := p.UnprocessableFileTypeAction
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("action = %v, want %v", got, tt.want)
+			}
+			if p.GlasswallBlockedFilesAction == nil || *p.GlasswallBlockedFilesAction != 1 {
+				t.Errorf("other action = %v, want 1", p.GlasswallBlockedFilesAction)
+			}
+		})
+	}
+
+	if _, err := decodeStoredPolicy(`[1,2]`); err == nil {
+		t.Error("a document that isn't an object decoded")
+	}
+}
+
+func TestInvalidStoredActions(t *testing.T) {
+	tests := []struct {
+		name      string
+		stored    string
+		method    string
+		body      string
+		want      int
+		wantError string
+	}{
+		{name: "read out of range", stored: `{"UnprocessableFileTypeAction":7,"GlasswallBlockedFilesAction":1}`, method: "GET", want: http.StatusOK},
+		{name: "read fractional", stored: `{"UnprocessableFileTypeAction":1.5,"GlasswallBlockedFilesAction":1}`, method: "GET", want: http.StatusOK},
+		{name: "patch other field of out of range", stored: `{"UnprocessableFileTypeAction":7,"GlasswallBlockedFilesAction":1}`, method: "PATCH", body: `{"GlasswallBlockedFilesAction":2}`, want: http.StatusBadRequest, wantError: "UnprocessableFileTypeAction"},
+		{name: "patch out of range field", stored: `{"UnprocessableFileTypeAction":7,"GlasswallBlockedFilesAction":1}`, method: "PATCH", body: `{"UnprocessableFileTypeAction":2}`, want: http.StatusOK},
+		{name: "patch fractional field", stored: `{"UnprocessableFileTypeAction":1.5,"GlasswallBlockedFilesAction":1}`, method: "PATCH", body: `{"UnprocessableFileTypeAction":2}`, want: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFakeClient(t, policyConfigMap(tt.stored))
+
+			r := asAdmin(httptest.NewRequest(tt.method, policyPath, strings.NewReader(tt.body)))
+			if tt.method == "PATCH" {
+				r.Header.Set("Content-Type", "application/merge-patch+json")
+			}
+			w := serve(newTestHandler(), r)
+			if w.Code != tt.want || !strings.Contains(w.Body.String(), tt.wantError) {
+				t.Errorf("%s = %d %s, want %d", tt.method, w.Code, w.Body, tt.want)
+			}
+		})
+	}
+}
+
+func action(a ActionValue) *ActionValue {
+	return &a
+}
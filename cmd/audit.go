@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const auditPath = "/api/v1/audit"
+
+// auditEntry is one audited change: a policy change, an auth cache flush, a service
+// token issued or revoked, or a freeze override.
+type auditEntry struct {
+	Time   time.Time `json:"time"`
+	User   string    `json:"user"`
+	Action string    `json:"action"`
+	Detail string    `json:"detail"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+// auditLog keeps the most recent audit entries in a ring buffer. It lives in memory
+// only, so each replica holds its own entries and loses them on restart.
+type auditLog struct {
+	mu      sync.Mutex
+	entries []auditEntry
+	next    int
+	full    bool
+}
+
+func newAuditLog(capacity int) *auditLog {
+	return &auditLog{entries: make([]auditEntry, capacity)}
+}
+
+// add records e, overwriting the oldest entry when the log is full.
+func (l *auditLog) add(e auditEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries[l.next] = e
+	l.next = (l.next + 1) % len(l.entries)
+	l.full = l.full || l.next == 0
+}
+
+// list returns the entries accepted by keep, newest first.
+func (l *auditLog) list(keep func(auditEntry) bool) []auditEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	count := l.next
+	if l.full {
+		count = len(l.entries)
+	}
+
+	entries := []auditEntry{}
+	for i := 1; i <= count; i++ {
+		e := l.entries[(l.next-i+len(l.entries))%len(l.entries)]
+		if keep(e) {
+			entries = append(entries, e)
+		}
+	}
+
+	return entries
+}
+
+// auditTrail starts out with the default capacity so handlers can be used without
+// setup; setupAuditLog resizes it from AUDIT_LOG_SIZE.
+var auditTrail = newAuditLog(200)
+
+func setupAuditLog() error {
+	size, err := intFromEnv("AUDIT_LOG_SIZE", 200)
+	if err != nil {
+		return err
+	}
+
+	auditTrail = newAuditLog(size)
+	return nil
+}
+
+// recordAudit adds an entry to the audit trail. Changes are still logged as before;
+// the trail only makes the recent ones queryable.
+func recordAudit(user, action, detail, reason string) {
+	auditTrail.add(auditEntry{
+		Time:   time.Now().UTC(),
+		User:   user,
+		Action: action,
+		Detail: detail,
+		Reason: reason,
+	})
+}
+
+// getAudit returns the recent audit entries of this replica, newest first, optionally
+// only those of one user and within a time range.
+func getAudit(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Methods", "*")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "*")
+	w.Header().Set("Access-Control-Expose-Headers", "*")
+
+	if isServiceTokenUser(r) {
+		writeError(w, http.StatusForbidden, codeForbidden, "Service tokens cannot read the audit trail.")
+		return
+	}
+
+	query := r.URL.Query()
+	user := query.Get("user")
+
+	var since, until time.Time
+	for name, t := range map[string]*time.Time{"since": &since, "until": &until} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeValidation, fmt.Sprintf("%s must be an RFC 3339 time.", name))
+			return
+		}
+		*t = parsed
+	}
+
+	entries := auditTrail.list(func(e auditEntry) bool {
+		return (user == "" || e.User == user) &&
+			(since.IsZero() || !e.Time.Before(since)) &&
+			(until.IsZero() || e.Time.Before(until))
+	})
+
+	writeData(w, http.StatusOK, entries, map[string]interface{}{
+		"count":    len(entries),
+		"capacity": len(auditTrail.entries),
+	})
+}
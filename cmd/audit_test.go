@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// useAuditLog replaces the audit trail with an empty one of capacity for the rest of
+// the test.
+func useAuditLog(t *testing.T, capacity int) *auditLog {
+	previous := auditTrail
+	auditTrail = newAuditLog(capacity)
+	t.Cleanup(func() { auditTrail = previous })
+
+	return auditTrail
+}
+
+func auditDetails(entries []auditEntry) []string {
+	details := []string{}
+	for _, e := range entries {
+		details = append(details, e.Detail)
+	}
+
+	return details
+}
+
+func TestAuditLogCapacity(t *testing.T) {
+	tests := []struct {
+		name  string
+		added int
+		want  []string
+	}{
+		{name: "empty", added: 0, want: []string{}},
+		{name: "partly full", added: 2, want: []string{"1", "0"}},
+		{name: "exactly full", added: 3, want: []string{"2", "1", "0"}},
+		{name: "wrapped", added: 5, want: []string{"4", "3", "2"}},
+		{name: "wrapped twice", added: 7, want: []string{"6", "5", "4"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newAuditLog(3)
+			for i := 0; i < tt.added; i++ {
+				l.add(auditEntry{Detail: string(rune('0' + i))})
+			}
+
+			got := auditDetails(l.list(func(auditEntry) bool { return true }))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("list() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetAuditFilters(t *testing.T) {
+	l := useAuditLog(t, 10)
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, user := range []string{"alice", "bob", "alice", "bob"} {
+		l.add(auditEntry{Time: start.Add(time.Duration(i) * time.Hour), User: user, Detail: string(rune('0' + i))})
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{name: "all", query: "", want: []string{"3", "2", "1", "0"}},
+		{name: "user", query: "?user=alice", want: []string{"2", "0"}},
+		{name: "since is inclusive", query: "?since=2026-01-01T01:00:00Z", want: []string{"3", "2", "1"}},
+		{name: "until is exclusive", query: "?until=2026-01-01T02:00:00Z", want: []string{"1", "0"}},
+		{name: "user and range", query: "?user=bob&since=2026-01-01T00:30:00Z&until=2026-01-01T03:00:00Z", want: []string{"1"}},
+		{name: "no match", query: "?user=carol", want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			getAudit(w, withIdentity(httptest.NewRequest("GET", auditPath+tt.query, nil), "admin", roleAdmin))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+			}
+
+			var body struct {
+				Data []auditEntry           `json:"data"`
+				Meta map[string]interface{} `json:"meta"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if got := auditDetails(body.Data); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("entries = %v, want %v", got, tt.want)
+			}
+			if body.Meta["capacity"] != float64(10) {
+				t.Errorf("capacity = %v, want 10", body.Meta["capacity"])
+			}
+		})
+	}
+}
+
+func TestGetAuditRejected(t *testing.T) {
+	useAuditLog(t, 10)
+	handler := requireAdmin(getAudit)
+
+	tests := []struct {
+		name   string
+		query  string
+		groups []string
+		want   int
+	}{
+		{name: "invalid since", query: "?since=yesterday", groups: []string{roleAdmin}, want: http.StatusBadRequest},
+		{name: "invalid until", query: "?until=2026-01-01", groups: []string{roleAdmin}, want: http.StatusBadRequest},
+		{name: "not an admin", groups: []string{roleReader, roleWriter}, want: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler(w, withIdentity(httptest.NewRequest("GET", auditPath+tt.query, nil), "someone", tt.groups...))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/shaj13/go-guardian/store"
+)
+
+// flushableCache remembers the keys stored in an auth cache so the whole cache can
+// be emptied on demand; store.Cache only deletes one known key at a time. It also
+// counts lookups, so the cache TTL can be tuned by its hit ratio. Hits, the common
+// case, only take a read lock.
+type flushableCache struct {
+	store.Cache
+
+	mu     sync.RWMutex
+	keys   map[string]struct{}
+	hits   int64
+	misses int64
+}
+
+func newFlushableCache(c store.Cache) *flushableCache {
+	return &flushableCache{Cache: c, keys: map[string]struct{}{}}
+}
+
+func (c *flushableCache) Load(key string, r *http.Request) (interface{}, bool, error) {
+	c.mu.RLock()
+	v, ok, err := c.Cache.Load(key, r)
+	c.mu.RUnlock()
+
+	if ok {
+		atomic.AddInt64(&c.hits, 1)
+		svcMetrics.authCacheLookups.WithLabelValues("hit").Inc()
+		return v, ok, err
+	}
+
+	atomic.AddInt64(&c.misses, 1)
+	svcMetrics.authCacheLookups.WithLabelValues("miss").Inc()
+
+	// expired entries would otherwise be remembered forever
+	c.mu.Lock()
+	if _, ok, _ := c.Cache.Load(key, r); !ok {
+		delete(c.keys, key)
+	}
+	c.mu.Unlock()
+
+	return v, ok, err
+}
+
+func (c *flushableCache) Store(key string, value interface{}, r *http.Request) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.keys[key] = struct{}{}
+	return c.Cache.Store(key, value, r)
+}
+
+func (c *flushableCache) Delete(key string, r *http.Request) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.keys, key)
+	return c.Cache.Delete(key, r)
+}
+
+// flush deletes every live entry and returns how many there were.
+func (c *flushableCache) flush() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cleared := 0
+	for key := range c.keys {
+		if _, ok, _ := c.Cache.Load(key, nil); ok {
+			cleared++
+		}
+		c.Cache.Delete(key, nil)
+		delete(c.keys, key)
+	}
+
+	return cleared
+}
+
+// entries returns how many entries are live, dropping expired ones it comes across.
+func (c *flushableCache) entries() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	live := 0
+	for key := range c.keys {
+		if _, ok, _ := c.Cache.Load(key, nil); ok {
+			live++
+		} else {
+			delete(c.keys, key)
+		}
+	}
+
+	return live
+}
+
+// authCaches are every cache of authentication results, emptied together by a flush.
+var authCaches []*flushableCache
+
+// authCacheEntries backs gw_ncfspolicyupdate_auth_cache_entries.
+func authCacheEntries() float64 {
+	entries := 0
+	for _, c := range authCaches {
+		entries += c.entries()
+	}
+
+	return float64(entries)
+}
+
+type authCacheSummary struct {
+	Entries  int     `json:"entries"`
+	Hits     int     `json:"hits"`
+	Misses   int     `json:"misses"`
+	HitRatio float64 `json:"hitRatio"`
+}
+
+// authCacheStatus summarises the auth caches since startup for the status endpoint.
+// The hit ratio is 0 until there has been a lookup.
+func authCacheStatus() componentStatus {
+	summary := authCacheSummary{Entries: int(authCacheEntries())}
+	for _, c := range authCaches {
+		summary.Hits += int(atomic.LoadInt64(&c.hits))
+		summary.Misses += int(atomic.LoadInt64(&c.misses))
+	}
+
+	if lookups := summary.Hits + summary.Misses; lookups > 0 {
+		summary.HitRatio = float64(summary.Hits) / float64(lookups)
+	}
+
+	return componentStatus{Status: statusOK, Detail: summary}
+}
+
+type cacheFlushResponse struct {
+	Cleared int `json:"cleared"`
+}
+
+// flushAuthCache drops all cached authentication results, so changed credentials take
+// effect immediately rather than once cached logins expire. It is an admin route.
+func flushAuthCache(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Methods", "*")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "*")
+	w.Header().Set("Access-Control-Expose-Headers", "*")
+
+	cleared := 0
+	for _, c := range authCaches {
+		cleared += c.flush()
+	}
+
+	loggerFromContext(r.Context()).Printf("Auth cache flushed by %s, %d entries cleared", requestActor(r), cleared)
+	recordAudit(requestUser(r), "auth_cache.flushed", fmt.Sprintf("%d entries cleared", cleared), "")
+	writeData(w, http.StatusOK, cacheFlushResponse{Cleared: cleared}, nil)
+}
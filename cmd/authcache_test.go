@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/shaj13/go-guardian/store"
+)
+
+// useAuthCache replaces the auth caches with one empty cache for the rest of the test.
+func useAuthCache(t *testing.T) *flushableCache {
+	ctx, cancel := context.WithCancel(context.Background())
+	cache := newFlushableCache(store.NewFIFO(ctx, time.Minute))
+
+	previous := authCaches
+	authCaches = []*flushableCache{cache}
+	t.Cleanup(func() {
+		authCaches = previous
+		cancel()
+	})
+
+	return cache
+}
+
+func TestFlushAuthCache(t *testing.T) {
+	cache := useAuthCache(t)
+	cache.Store("a", "user-a", nil)
+	cache.Store("b", "user-b", nil)
+
+	handler := requireAdmin(flushAuthCache)
+
+	w := httptest.NewRecorder()
+	handler(w, withIdentity(httptest.NewRequest("POST", "/api/v1/admin/cache/flush", nil), "writer", roleWriter))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("flush by a writer status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if entries := cache.entries(); entries != 2 {
+		t.Fatalf("a refused flush left %d entries, want 2", entries)
+	}
+
+	w = httptest.NewRecorder()
+	handler(w, withIdentity(httptest.NewRequest("POST", "/api/v1/admin/cache/flush", nil), "admin", roleAdmin))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"cleared":2`) {
+		t.Fatalf("flush by an admin = %d %s, want 200 with 2 cleared", w.Code, w.Body)
+	}
+	if _, ok, _ := cache.Load("a", nil); ok {
+		t.Error("entry still cached after a flush")
+	}
+}
+
+func TestFlushableCacheConcurrentLookups(t *testing.T) {
+	cache := useAuthCache(t)
+	cache.Store("hit", "user", nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				cache.Load("hit", nil)
+				cache.Load("miss", nil)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if cache.hits != 800 || cache.misses != 800 {
+		t.Errorf("hits = %d, misses = %d, want 800 each", cache.hits, cache.misses)
+	}
+	if entries := cache.entries(); entries != 1 {
+		t.Errorf("entries = %d, want 1", entries)
+	}
+}
+
+func TestAuthCacheLookupsCounted(t *testing.T) {
+	useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`))
+	previousCaches, previousMetrics := authCaches, svcMetrics
+	authCaches, svcMetrics = nil, newServiceMetrics()
+	t.Cleanup(func() { authCaches, svcMetrics = previousCaches, previousMetrics })
+	handler := newTestHandler()
+
+	// the first login is a miss and cached, the second a hit; unknown users are never
+	// cached, so every attempt of theirs is a miss
+	serve(handler, asAdmin(httptest.NewRequest("GET", whoamiPath, nil)))
+	serve(handler, asAdmin(httptest.NewRequest("GET", whoamiPath, nil)))
+	r := httptest.NewRequest("GET", whoamiPath, nil)
+	r.SetBasicAuth("nobody", "wrong")
+	serve(handler, r)
+
+	if hits, misses := testutil.ToFloat64(svcMetrics.authCacheLookups.WithLabelValues("hit")), testutil.ToFloat64(svcMetrics.authCacheLookups.WithLabelValues("miss")); hits != 1 || misses != 2 {
+		t.Errorf("metric hits = %v, misses = %v, want 1 and 2", hits, misses)
+	}
+
+	// the status request is itself a hit
+	w := serve(handler, asAdmin(httptest.NewRequest("GET", "/api/v1/status", nil)))
+	var body struct {
+		Data struct {
+			Components struct {
+				AuthCache struct {
+					Detail authCacheSummary `json:"detail"`
+				} `json:"authCache"`
+			} `json:"components"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+
+	want := authCacheSummary{Entries: 1, Hits: 2, Misses: 2, HitRatio: 0.5}
+	if got := body.Data.Components.AuthCache.Detail; got != want {
+		t.Errorf("status authCache = %+v, want %+v", got, want)
+	}
+}
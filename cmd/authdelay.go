@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// maxAuthFailureDelay bounds AUTH_FAILURE_DELAY so a misconfiguration can't leave
+// failed requests hanging.
+const maxAuthFailureDelay = 5 * time.Second
+
+// authFailureDelay is the minimum time a failed authentication takes to be answered.
+// Zero answers failures immediately.
+var authFailureDelay time.Duration
+
+func setupAuthFailureDelay() error {
+	var err error
+	authFailureDelay, err = optionalDurationFromEnv("AUTH_FAILURE_DELAY")
+	if err != nil {
+		return err
+	}
+
+	if authFailureDelay > maxAuthFailureDelay {
+		return fmt.Errorf("AUTH_FAILURE_DELAY must not exceed %v", maxAuthFailureDelay)
+	}
+
+	return nil
+}
+
+// delayAuthFailure holds back a failed authentication until authFailureDelay, plus up
+// to a quarter of it in random jitter, has passed since start. Whether a user exists or
+// which check failed then no longer shows in the response time. It returns early if
+// the request is cancelled.
+func delayAuthFailure(r *http.Request, start time.Time) {
+	if authFailureDelay <= 0 {
+		return
+	}
+
+	delay := authFailureDelay + time.Duration(rand.Int63n(int64(authFailureDelay/4)+1))
+	remaining := delay - time.Since(start)
+	if remaining <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(remaining)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-r.Context().Done():
+	}
+}
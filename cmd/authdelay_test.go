@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// useAuthFailureDelay sets AUTH_FAILURE_DELAY to d for the rest of the test.
+func useAuthFailureDelay(t *testing.T, d time.Duration) {
+	previous := authFailureDelay
+	t.Cleanup(func() { authFailureDelay = previous })
+
+	authFailureDelay = d
+}
+
+func TestAuthFailureDelayed(t *testing.T) {
+	const delay = 100 * time.Millisecond
+	useAuthFailureDelay(t, delay)
+
+	r := httptest.NewRequest("GET", whoamiPath, nil)
+	r.SetBasicAuth("nobody", "wrong")
+
+	start := time.Now()
+	w := serve(newTestHandler(), r)
+	elapsed := time.Since(start)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if elapsed < delay {
+		t.Errorf("failed authentication answered after %v, want at least %v", elapsed, delay)
+	}
+	// the jitter adds at most a quarter of the delay
+	if elapsed > 2*delay {
+		t.Errorf("failed authentication answered after %v, want about %v", elapsed, delay)
+	}
+}
+
+func TestAuthSuccessNotDelayed(t *testing.T) {
+	useAuthFailureDelay(t, time.Second)
+
+	start := time.Now()
+	w := serve(newTestHandler(), asAdmin(httptest.NewRequest("GET", whoamiPath, nil)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("successful authentication answered after %v, want no delay", elapsed)
+	}
+}
+
+func TestAuthFailureDelayEndsWithRequest(t *testing.T) {
+	useAuthFailureDelay(t, maxAuthFailureDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	r := httptest.NewRequest("GET", whoamiPath, nil).WithContext(ctx)
+	r.SetBasicAuth("nobody", "wrong")
+
+	start := time.Now()
+	serve(newTestHandler(), r)
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("cancelled request answered after %v, want the delay cut short", elapsed)
+	}
+}
+
+func TestAuthFailureDelayCapped(t *testing.T) {
+	useAuthFailureDelay(t, 0)
+
+	t.Setenv("AUTH_FAILURE_DELAY", maxAuthFailureDelay.String())
+	if err := setupAuthFailureDelay(); err != nil || authFailureDelay != maxAuthFailureDelay {
+		t.Errorf("AUTH_FAILURE_DELAY=%v = %v, %v", maxAuthFailureDelay, authFailureDelay, err)
+	}
+
+	t.Setenv("AUTH_FAILURE_DELAY", "6s")
+	if err := setupAuthFailureDelay(); err == nil {
+		t.Error("AUTH_FAILURE_DELAY=6s accepted, want it capped at 5s")
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidateUser(t *testing.T) {
+	tests := []struct {
+		name     string
+		user     string
+		password string
+		accepted bool
+	}{
+		{name: "valid credentials", user: username, password: password, accepted: true},
+		{name: "wrong password", user: username, password: "wrong-password", accepted: false},
+		{name: "wrong user", user: "nobody", password: password, accepted: false},
+		// subtle.ConstantTimeCompare returns early on a length mismatch only, so a
+		// partly matching credential is rejected like any other
+		{name: "password prefix", user: username, password: password[:len(password)-1], accepted: false},
+		{name: "password with suffix", user: username, password: password + "x", accepted: false},
+		{name: "user prefix", user: username[:len(username)-1], password: password, accepted: false},
+		{name: "empty", user: "", password: "", accepted: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := validateUser(context.Background(), httptest.NewRequest("GET", whoamiPath, nil), tt.user, tt.password)
+			if tt.accepted && (err != nil || info.UserName() != tt.user) {
+				t.Errorf("validateUser() = %v, %v, want %s accepted", info, err, tt.user)
+			}
+			if !tt.accepted && (err == nil || info != nil) {
+				t.Errorf("validateUser() = %v, %v, want the credentials rejected", info, err)
+			}
+		})
+	}
+}
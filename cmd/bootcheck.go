@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	policy "github.com/filetrust/policy-update-service/pkg"
+)
+
+// validateStoredPolicy checks the policy already in the config map against the current
+// validation rules, so a policy left behind by an older schema is noticed at boot.
+func validateStoredPolicy() error {
+	args := policy.PolicyArgs{
+		Namespace:     namespace,
+		ConfigMapName: configmapName,
+		PolicyKeys:    policyKeys,
+	}
+
+	err := args.GetClient()
+	if err != nil {
+		return fmt.Errorf("unable to get client to validate stored policy: %v", err)
+	}
+
+	stored, err := args.GetStoredPolicy(context.Background())
+	if err != nil {
+		return fmt.Errorf("unable to read stored policy: %v", err)
+	}
+
+	recordConfigMapSize(namespace, configmapName, stored.Size)
+	current := stored.Policy
+
+	if current == "" {
+		log.Printf("No policy stored in config map %s/%s yet", namespace, configmapName)
+		return nil
+	}
+
+	// checked leniently and without counting validation failures, like /api/v1/status
+	err = validateStoredDocument(current)
+	var invalid *validationError
+	if errors.As(err, &invalid) {
+		return fmt.Errorf("stored policy in config map %s/%s is invalid: %s", namespace, configmapName, redactPolicyError(err))
+	}
+	if err != nil {
+		return fmt.Errorf("stored policy in config map %s/%s cannot be decoded: %s", namespace, configmapName, redactPolicyError(err))
+	}
+
+	return nil
+}
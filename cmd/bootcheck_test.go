@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateStoredPolicy(t *testing.T) {
+	useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1,"Future":true}`))
+	useUnknownFields(t, unknownFieldsReject)
+
+	before := validationFailureTotal()
+	if err := validateStoredPolicy(); err != nil {
+		t.Errorf("validateStoredPolicy() of a valid policy = %v, want nil", err)
+	}
+	if validationFailureTotal() != before {
+		t.Error("startup check counted a validation failure")
+	}
+}
+
+func TestValidateStoredPolicyInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		stored string
+		want   string
+	}{
+		{name: "out of range", stored: `{"UnprocessableFileTypeAction":9,"GlasswallBlockedFilesAction":1}`, want: "stored policy in config map ncfs/ncfs-policy is invalid: UnprocessableFileTypeAction must be between 1-4 inclusive."},
+		{name: "missing field", stored: `{"UnprocessableFileTypeAction":1}`, want: "stored policy in config map ncfs/ncfs-policy is invalid: GlasswallBlockedFilesAction is required."},
+		{name: "malformed", stored: `{"UnprocessableFileTypeAction":`, want: "stored policy in config map ncfs/ncfs-policy cannot be decoded: unexpected end of JSON input"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFakeClient(t, policyConfigMap(tt.stored))
+
+			before := validationFailureTotal()
+			if err := validateStoredPolicy(); err == nil || err.Error() != tt.want {
+				t.Errorf("validateStoredPolicy() = %v, want %s", err, tt.want)
+			}
+			if validationFailureTotal() != before {
+				t.Error("startup check counted a validation failure")
+			}
+		})
+	}
+}
+
+func TestValidateStoredPolicyMissingConfigMap(t *testing.T) {
+	useFakeClient(t)
+
+	err := validateStoredPolicy()
+	if err == nil || !strings.HasPrefix(err.Error(), "unable to read stored policy:") {
+		t.Errorf("validateStoredPolicy() without a config map = %v, want a read error", err)
+	}
+}
+
+func TestValidateStoredPolicyEmpty(t *testing.T) {
+	useFakeClient(t, policyConfigMap(""))
+
+	if err := validateStoredPolicy(); err != nil {
+		t.Errorf("validateStoredPolicy() with no policy stored = %v, want nil", err)
+	}
+}
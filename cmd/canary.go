@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// canaryPercentAnnotation records on the config map the share of NCFS instances a
+// policy is meant for. The service only stores it; downstream consumers act on it.
+const canaryPercentAnnotation = "glasswall.com/canary-percent"
+
+// canaryAnnotations reads the X-Canary-Percent header of a PUT. A PUT without the
+// header clears any canary mark left by a previous policy.
+func canaryAnnotations(r *http.Request) (map[string]string, error) {
+	value := r.Header.Get("X-Canary-Percent")
+	if value == "" {
+		return map[string]string{canaryPercentAnnotation: ""}, nil
+	}
+
+	percent, err := strconv.Atoi(value)
+	if err != nil || percent < 0 || percent > 100 {
+		return nil, errors.New("X-Canary-Percent must be an integer between 0-100 inclusive.")
+	}
+
+	return map[string]string{canaryPercentAnnotation: strconv.Itoa(percent)}, nil
+}
+
+func canaryPercentFromAnnotations(annotations map[string]string) *int {
+	percent, err := strconv.Atoi(annotations[canaryPercentAnnotation])
+	if err != nil {
+		return nil
+	}
+
+	return &percent
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// putPolicyCanary sends body to the policy endpoint with X-Canary-Percent set to
+// percent, or without the header when it is empty.
+func putPolicyCanary(body, percent string) *httptest.ResponseRecorder {
+	r := asAdmin(httptest.NewRequest("PUT", policyPath, strings.NewReader(body)))
+	r.Header.Set("Content-Type", "application/json")
+	if percent != "" {
+		r.Header.Set("X-Canary-Percent", percent)
+	}
+	return serve(newTestHandler(), r)
+}
+
+// storedCanaryPercent returns the canary annotation of the policy config map, and
+// whether it is set.
+func storedCanaryPercent(t *testing.T, client kubernetes.Interface) (string, bool) {
+	configMap, err := client.CoreV1().ConfigMaps(namespace).Get(context.Background(), configmapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	percent, ok := configMap.Annotations[canaryPercentAnnotation]
+	return percent, ok
+}
+
+func TestCanaryPercentRoundTrip(t *testing.T) {
+	client := useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`))
+	const body = `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":2}`
+
+	if w := putPolicyCanary(body, "25"); w.Code != http.StatusOK {
+		t.Fatalf("PUT = %d %s", w.Code, w.Body)
+	}
+	if percent, _ := storedCanaryPercent(t, client); percent != "25" {
+		t.Errorf("annotation = %q, want 25", percent)
+	}
+	if doc := storedDocument(t, client); doc != body+"\n" {
+		t.Errorf("stored policy = %s, want %s without the canary", doc, body)
+	}
+	if percent := policyMeta(t)["canaryPercent"]; percent != float64(25) {
+		t.Errorf("meta canaryPercent = %v, want 25", percent)
+	}
+
+	// the same policy without the header is no longer a canary
+	if w := putPolicyCanary(body, ""); w.Code != http.StatusOK {
+		t.Fatalf("PUT = %d %s", w.Code, w.Body)
+	}
+	if percent, ok := storedCanaryPercent(t, client); ok {
+		t.Errorf("annotation = %q, want it removed", percent)
+	}
+	if percent, ok := policyMeta(t)["canaryPercent"]; ok {
+		t.Errorf("meta canaryPercent = %v, want none", percent)
+	}
+}
+
+func TestCanaryPercentRange(t *testing.T) {
+	const body = `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":2}`
+
+	for _, percent := range []string{"0", "100"} {
+		client := useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`))
+		if w := putPolicyCanary(body, percent); w.Code != http.StatusOK {
+			t.Errorf("X-Canary-Percent %s: PUT = %d %s", percent, w.Code, w.Body)
+		}
+		if stored, _ := storedCanaryPercent(t, client); stored != percent {
+			t.Errorf("X-Canary-Percent %s: annotation = %q", percent, stored)
+		}
+	}
+
+	for _, percent := range []string{"-1", "101", "half", "12.5"} {
+		const stored = `{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`
+		client := useFakeClient(t, policyConfigMap(stored))
+		if w := putPolicyCanary(body, percent); w.Code != http.StatusBadRequest {
+			t.Errorf("X-Canary-Percent %s: PUT = %d, want %d", percent, w.Code, http.StatusBadRequest)
+		}
+		if doc := storedDocument(t, client); doc != stored {
+			t.Errorf("X-Canary-Percent %s: stored policy changed to %s", percent, doc)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"crypto/tls"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	certFile = "/etc/ssl/certs/server.crt"
+	keyFile  = "/etc/ssl/private/server.key"
+)
+
+// certReloader serves the certificate on disk, reloading it whenever the
+// certificate or key file modification time changes.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu          sync.Mutex
+	cert        *tls.Certificate
+	certModTime time.Time
+	keyModTime  time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	cr := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+
+	if _, err := cr.GetCertificate(nil); err != nil {
+		return nil, err
+	}
+
+	return cr, nil
+}
+
+// GetCertificate is used as tls.Config.GetCertificate. If a rotated pair cannot be
+// loaded the previously loaded certificate keeps being served.
+func (cr *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	certInfo, err := os.Stat(cr.certFile)
+	if err != nil {
+		return cr.fallback(err)
+	}
+
+	keyInfo, err := os.Stat(cr.keyFile)
+	if err != nil {
+		return cr.fallback(err)
+	}
+
+	if cr.cert != nil && certInfo.ModTime().Equal(cr.certModTime) && keyInfo.ModTime().Equal(cr.keyModTime) {
+		return cr.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return cr.fallback(err)
+	}
+
+	if cr.cert != nil {
+		log.Printf("Reloaded TLS certificate from %s", cr.certFile)
+		svcMetrics.certificateReloads.Inc()
+	}
+
+	cr.cert = &cert
+	cr.certModTime = certInfo.ModTime()
+	cr.keyModTime = keyInfo.ModTime()
+
+	return cr.cert, nil
+}
+
+func (cr *certReloader) fallback(err error) (*tls.Certificate, error) {
+	if cr.cert == nil {
+		return nil, err
+	}
+
+	log.Printf("Unable to reload TLS certificate, serving previous certificate: %v", err)
+	return cr.cert, nil
+}
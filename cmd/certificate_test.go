@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// writeCertificate writes a self-signed certificate for commonName and its key to
+// certFile and keyFile, dated modTime so a rewrite is seen as a change.
+func writeCertificate(t *testing.T, certFile, keyFile, commonName string, modTime time.Time) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]*pem.Block{
+		certFile: {Type: "CERTIFICATE", Bytes: der},
+		keyFile:  {Type: "EC PRIVATE KEY", Bytes: keyDER},
+	}
+	for name, block := range files {
+		if err := os.WriteFile(name, pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(name, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// servedCommonName connects to server and returns the common name of the certificate it
+// presents. The server name makes the listener ask GetCertificate rather than serve the
+// httptest certificate.
+func servedCommonName(t *testing.T, server *httptest.Server) string {
+	conn, err := tls.Dial("tcp", server.Listener.Addr().String(), &tls.Config{ServerName: "localhost", InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+}
+
+func TestCertificateReload(t *testing.T) {
+	previous := svcMetrics
+	svcMetrics = newServiceMetrics()
+	t.Cleanup(func() { svcMetrics = previous })
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	start := time.Now().Add(-time.Hour)
+	writeCertificate(t, certFile, keyFile, "first", start)
+
+	reloader, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewUnstartedServer(http.NotFoundHandler())
+	server.TLS = &tls.Config{GetCertificate: reloader.GetCertificate}
+	server.StartTLS()
+	defer server.Close()
+
+	if name := servedCommonName(t, server); name != "first" {
+		t.Fatalf("served %q, want the first certificate", name)
+	}
+
+	writeCertificate(t, certFile, keyFile, "rotated", start.Add(time.Minute))
+	if name := servedCommonName(t, server); name != "rotated" {
+		t.Errorf("served %q after rotation, want the rotated certificate", name)
+	}
+	if reloads := testutil.ToFloat64(svcMetrics.certificateReloads); reloads != 1 {
+		t.Errorf("reloads = %v, want 1", reloads)
+	}
+
+	// a half-written rotation keeps the last good certificate in service
+	if err := os.WriteFile(keyFile, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(keyFile, start.Add(2*time.Minute), start.Add(2*time.Minute))
+	if name := servedCommonName(t, server); name != "rotated" {
+		t.Errorf("served %q after a broken rotation, want the previous certificate", name)
+	}
+}
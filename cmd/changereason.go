@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// requireChangeReason rejects policy changes that don't say why they are made, e.g. by
+// naming a ticket.
+var requireChangeReason = os.Getenv("REQUIRE_CHANGE_REASON") == "true"
+
+const changeReasonHeader = "X-Change-Reason"
+
+// changeReasonField is the body member that may carry the reason instead of the header.
+// It is removed before the body is decoded, so it is never stored with the policy.
+const changeReasonField = "reason"
+
+const maxChangeReasonLength = 512
+
+// takeChangeReason removes the reason member from a JSON object body and returns the
+// rest of the body and the reason. A body that isn't a JSON object is returned as is,
+// for the policy decoder to report.
+func takeChangeReason(body []byte) ([]byte, string, error) {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) != nil {
+		return body, "", nil
+	}
+
+	raw, ok := fields[changeReasonField]
+	if !ok {
+		return body, "", nil
+	}
+
+	var reason string
+	if err := json.Unmarshal(raw, &reason); err != nil {
+		return nil, "", errors.New("reason must be a string")
+	}
+
+	delete(fields, changeReasonField)
+	rest, err := json.Marshal(fields)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return rest, reason, nil
+}
+
+// changeReason returns the reason given for the change made by r: bodyReason when the
+// body had one, otherwise the X-Change-Reason header. It writes a 400 and returns false
+// if the reason is too long, or missing when REQUIRE_CHANGE_REASON is set.
+func changeReason(w http.ResponseWriter, r *http.Request, bodyReason string) (string, bool) {
+	reason := strings.TrimSpace(bodyReason)
+	if reason == "" {
+		reason = strings.TrimSpace(r.Header.Get(changeReasonHeader))
+	}
+
+	if len(reason) > maxChangeReasonLength {
+		writeError(w, http.StatusBadRequest, codeValidation, fmt.Sprintf("The change reason must not be longer than %d characters.", maxChangeReasonLength))
+		return "", false
+	}
+
+	if reason == "" && requireChangeReason {
+		writeError(w, http.StatusBadRequest, codeValidation, fmt.Sprintf("A change reason is required, in the %s header or the %s field of the body.", changeReasonHeader, changeReasonField))
+		return "", false
+	}
+
+	return reason, true
+}
+
+// withReason adds the change reason, if one was given, to the audit description of who
+// made a change.
+func withReason(actor, reason string) string {
+	if reason == "" {
+		return actor
+	}
+
+	return fmt.Sprintf("%s, reason %q", actor, reason)
+}
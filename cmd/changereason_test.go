@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// useRequireChangeReason sets REQUIRE_CHANGE_REASON to required for the rest of the test.
+func useRequireChangeReason(t *testing.T, required bool) {
+	previous := requireChangeReason
+	requireChangeReason = required
+	t.Cleanup(func() { requireChangeReason = previous })
+}
+
+// changeRequest returns an admin request to change the policy with body, and the
+// X-Change-Reason header when reason isn't empty.
+func changeRequest(method, contentType, body, reason string) *http.Request {
+	r := asAdmin(httptest.NewRequest(method, policyPath, strings.NewReader(body)))
+	r.Header.Set("Content-Type", contentType)
+	if reason != "" {
+		r.Header.Set(changeReasonHeader, reason)
+	}
+	return r
+}
+
+func TestChangeReasonAudited(t *testing.T) {
+	tests := []struct {
+		name    string
+		request *http.Request
+		want    string
+	}{
+		{
+			name:    "PUT body",
+			request: changeRequest("PUT", "application/json", `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":1,"reason":"CHG-1"}`, ""),
+			want:    "CHG-1",
+		},
+		{
+			name:    "PUT header",
+			request: changeRequest("PUT", "application/json", `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":1}`, "CHG-2"),
+			want:    "CHG-2",
+		},
+		{
+			name:    "body before header",
+			request: changeRequest("PUT", "application/json", `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":1,"reason":"CHG-3"}`, "CHG-4"),
+			want:    "CHG-3",
+		},
+		{
+			name:    "PATCH body",
+			request: changeRequest("PATCH", "application/merge-patch+json", `{"UnprocessableFileTypeAction":2,"reason":"CHG-5"}`, ""),
+			want:    "CHG-5",
+		},
+		{
+			name:    "none",
+			request: changeRequest("PUT", "application/json", `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":1}`, ""),
+			want:    "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`))
+			audit := useAuditLog(t, 10)
+			useRequireChangeReason(t, false)
+
+			w := serve(newTestHandler(), tt.request)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+			}
+
+			entries := audit.list(func(auditEntry) bool { return true })
+			if len(entries) != 1 || entries[0].Reason != tt.want {
+				t.Errorf("audit = %+v, want one entry with reason %q", entries, tt.want)
+			}
+			if doc := storedDocument(t, client); strings.Contains(doc, "reason") || strings.Contains(doc, "CHG") {
+				t.Errorf("stored policy = %s, want the reason kept out of it", doc)
+			}
+		})
+	}
+}
+
+func TestChangeReasonRejected(t *testing.T) {
+	const policy = `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":1`
+	tests := []struct {
+		name     string
+		required bool
+		request  *http.Request
+		message  string
+	}{
+		{
+			name:     "required and missing",
+			required: true,
+			request:  changeRequest("PUT", "application/json", policy+`}`, ""),
+			message:  "A change reason is required, in the X-Change-Reason header or the reason field of the body.",
+		},
+		{
+			name:     "required and blank",
+			required: true,
+			request:  changeRequest("PATCH", "application/merge-patch+json", `{"UnprocessableFileTypeAction":2,"reason":"  "}`, ""),
+			message:  "A change reason is required, in the X-Change-Reason header or the reason field of the body.",
+		},
+		{
+			name:    "too long",
+			request: changeRequest("PUT", "application/json", policy+`}`, strings.Repeat("x", maxChangeReasonLength+1)),
+			message: "The change reason must not be longer than 512 characters.",
+		},
+		{
+			name:    "not a string",
+			request: changeRequest("PUT", "application/json", policy+`,"reason":42}`, ""),
+			message: "reason must be a string",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := `{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`
+			client := useFakeClient(t, policyConfigMap(doc))
+			audit := useAuditLog(t, 10)
+			useRequireChangeReason(t, tt.required)
+
+			w := serve(newTestHandler(), tt.request)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body)
+			}
+
+			var resp errorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Code != codeValidation || resp.Message != tt.message {
+				t.Errorf("body = %s, want %s %q", w.Body, codeValidation, tt.message)
+			}
+			if got := storedDocument(t, client); got != doc {
+				t.Errorf("stored policy = %s, want it unchanged", got)
+			}
+			if entries := audit.list(func(auditEntry) bool { return true }); len(entries) != 0 {
+				t.Errorf("audit = %+v, want nothing recorded", entries)
+			}
+		})
+	}
+}
+
+func TestChangeReasonRequiredAndGiven(t *testing.T) {
+	useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`))
+	useRequireChangeReason(t, true)
+
+	r := changeRequest("PUT", "application/json", `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":1}`, "CHG-6")
+	if w := serve(newTestHandler(), r); w.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+
+	policy "github.com/filetrust/policy-update-service/pkg"
+)
+
+const comparePath = "/api/v1/policy/compare"
+
+// compareNamespaces is the allowlist of namespaces whose CONFIGMAP_NAME config map the
+// comparison endpoint may read. The endpoint is disabled when it is empty.
+var compareNamespaces []string
+
+func setupCompareNamespaces() error {
+	for _, ns := range strings.Split(os.Getenv("COMPARE_NAMESPACES"), ",") {
+		ns = strings.TrimSpace(ns)
+		if ns == "" {
+			continue
+		}
+
+		if err := policy.ValidateNames(ns, configmapName); err != nil {
+			return fmt.Errorf("COMPARE_NAMESPACES: %v", err)
+		}
+		compareNamespaces = append(compareNamespaces, ns)
+	}
+
+	if len(compareNamespaces) > 0 {
+		log.Printf("Policy comparison enabled across namespaces %s", strings.Join(compareNamespaces, ", "))
+	}
+
+	return nil
+}
+
+// Status of the policy read from one namespace.
+const (
+	compareOK      = "ok"
+	compareMissing = "missing"
+	compareEmpty   = "empty"
+	compareInvalid = "invalid"
+	compareError   = "error"
+)
+
+type namespacePolicy struct {
+	Namespace string `json:"namespace"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+}
+
+// comparisonRow holds one policy field as stored in each namespace whose policy could
+// be read. Values are shown as stored, even when they would fail validation.
+type comparisonRow struct {
+	Field   string                 `json:"field"`
+	Values  map[string]interface{} `json:"values"`
+	Differs bool                   `json:"differs"`
+}
+
+type policyComparison struct {
+	Namespaces []namespacePolicy `json:"namespaces"`
+	Rows       []comparisonRow   `json:"rows"`
+}
+
+// comparePolicies reads the policy from each requested namespace, all of
+// COMPARE_NAMESPACES by default, and returns it field by field, marking the fields
+// whose values differ.
+func comparePolicies(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Methods", "*")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "*")
+	w.Header().Set("Access-Control-Expose-Headers", "*")
+
+	namespaces, err := requestedNamespaces(r.URL.Query().Get("namespaces"))
+	if err != nil {
+		writeError(w, http.StatusForbidden, codeForbidden, err.Error())
+		return
+	}
+
+	args := policy.PolicyArgs{
+		ConfigMapName: configmapName,
+		PolicyKeys:    policyKeys,
+	}
+
+	err = args.GetClient()
+	if err != nil {
+		loggerFromContext(r.Context()).Printf("Unable to get client: %v", err)
+		writeError(w, http.StatusInternalServerError, codeK8sClient, "Something went wrong getting K8 Client.")
+		return
+	}
+
+	comparison := policyComparison{}
+	stored := map[string]map[string]interface{}{}
+	for _, ns := range namespaces {
+		args.Namespace = ns
+		result := namespacePolicy{Namespace: ns, Status: compareOK}
+
+		current, err := args.GetPolicy(r.Context())
+		var fields map[string]interface{}
+		switch {
+		case errors.Is(err, policy.ErrNotFound):
+			result.Status = compareMissing
+		case err != nil:
+			loggerFromContext(r.Context()).Printf("Unable to read policy in %s/%s for comparison: %v", ns, configmapName, err)
+			result.Status = compareError
+			result.Error = "Something went wrong when reading the config map."
+		case current == "":
+			result.Status = compareEmpty
+		case json.Unmarshal([]byte(current), &fields) != nil:
+			result.Status = compareInvalid
+		default:
+			stored[ns] = fields
+		}
+
+		comparison.Namespaces = append(comparison.Namespaces, result)
+	}
+
+	comparison.Rows = compareFields(stored)
+
+	// identical only if every namespace has a readable policy and no field differs
+	identical := len(stored) == len(namespaces)
+	for _, row := range comparison.Rows {
+		identical = identical && !row.Differs
+	}
+
+	writeData(w, http.StatusOK, comparison, map[string]interface{}{
+		"configMapName": configmapName,
+		"identical":     identical,
+	})
+}
+
+// compareFields builds a row for each policy field from the stored policies, by
+// namespace.
+func compareFields(stored map[string]map[string]interface{}) []comparisonRow {
+	var rows []comparisonRow
+	for _, field := range actionFields(Policy{}) {
+		row := comparisonRow{Field: field.name, Values: map[string]interface{}{}}
+		for ns, fields := range stored {
+			value := fields[field.name]
+			for _, other := range row.Values {
+				row.Differs = row.Differs || !reflect.DeepEqual(value, other)
+			}
+			row.Values[ns] = value
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows
+}
+
+// requestedNamespaces parses the comma-separated namespaces query parameter, which may
+// only name namespaces in COMPARE_NAMESPACES. Without it every allowed namespace is
+// compared.
+func requestedNamespaces(value string) ([]string, error) {
+	allowed := map[string]bool{}
+	for _, ns := range compareNamespaces {
+		allowed[ns] = true
+	}
+
+	var namespaces []string
+	seen := map[string]bool{}
+	for _, ns := range strings.Split(value, ",") {
+		ns = strings.TrimSpace(ns)
+		if ns == "" || seen[ns] {
+			continue
+		}
+
+		if !allowed[ns] {
+			return nil, fmt.Errorf("Namespace %q is not in COMPARE_NAMESPACES.", ns)
+		}
+		seen[ns] = true
+		namespaces = append(namespaces, ns)
+	}
+
+	if len(namespaces) == 0 {
+		return compareNamespaces, nil
+	}
+
+	return namespaces, nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// useCompareNamespaces sets COMPARE_NAMESPACES to value for the rest of the test and
+// returns the error setting it up.
+func useCompareNamespaces(t *testing.T, value string) error {
+	t.Setenv("COMPARE_NAMESPACES", value)
+	previous := compareNamespaces
+	compareNamespaces = nil
+	t.Cleanup(func() { compareNamespaces = previous })
+
+	return setupCompareNamespaces()
+}
+
+// namespacedPolicy returns the policy config map in ns holding data.
+func namespacedPolicy(ns string, data map[string]string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: configmapName, Namespace: ns},
+		Data:       data,
+	}
+}
+
+// comparison serves the comparison request r and returns its status, the comparison
+// and whether the policies were reported identical.
+func comparison(t *testing.T, r *http.Request) (int, policyComparison, bool) {
+	w := serve(newTestHandler(), r)
+
+	var resp struct {
+		Data policyComparison `json:"data"`
+		Meta struct {
+			Identical bool `json:"identical"`
+		} `json:"meta"`
+	}
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return w.Code, resp.Data, resp.Meta.Identical
+}
+
+func TestComparePolicies(t *testing.T) {
+	useFakeClient(t,
+		namespacedPolicy("dev", map[string]string{"appsettings.json": `{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`}),
+		namespacedPolicy("test", map[string]string{"appsettings.json": `{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":2}`}),
+		namespacedPolicy("stage", map[string]string{}),
+		namespacedPolicy("prod", map[string]string{"appsettings.json": `[1,2]`}),
+	)
+	if err := useCompareNamespaces(t, "dev, test, stage, prod, dr"); err != nil {
+		t.Fatal(err)
+	}
+
+	status, got, identical := comparison(t, asAdmin(httptest.NewRequest("GET", comparePath, nil)))
+	if status != http.StatusOK {
+		t.Fatalf("status = %d, want %d", status, http.StatusOK)
+	}
+
+	want := policyComparison{
+		Namespaces: []namespacePolicy{
+			{Namespace: "dev", Status: compareOK},
+			{Namespace: "test", Status: compareOK},
+			{Namespace: "stage", Status: compareEmpty},
+			{Namespace: "prod", Status: compareInvalid},
+			{Namespace: "dr", Status: compareMissing},
+		},
+		Rows: []comparisonRow{
+			{Field: "UnprocessableFileTypeAction", Values: map[string]interface{}{"dev": 1.0, "test": 1.0}},
+			{Field: "GlasswallBlockedFilesAction", Values: map[string]interface{}{"dev": 1.0, "test": 2.0}, Differs: true},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("comparison = %+v, want %+v", got, want)
+	}
+	if identical {
+		t.Error("divergent policies reported identical")
+	}
+}
+
+func TestComparePoliciesIdentical(t *testing.T) {
+	doc := `{"UnprocessableFileTypeAction":3,"GlasswallBlockedFilesAction":2}`
+	useFakeClient(t,
+		namespacedPolicy("dev", map[string]string{"appsettings.json": doc}),
+		namespacedPolicy("test", map[string]string{"appsettings.json": doc}),
+		namespacedPolicy("prod", map[string]string{"appsettings.json": `{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":2}`}),
+	)
+	if err := useCompareNamespaces(t, "dev,test,prod"); err != nil {
+		t.Fatal(err)
+	}
+
+	// only the namespaces asked for are compared
+	status, got, identical := comparison(t, asAdmin(httptest.NewRequest("GET", comparePath+"?namespaces=test,dev", nil)))
+	if status != http.StatusOK || !identical || len(got.Namespaces) != 2 || got.Namespaces[0].Namespace != "test" {
+		t.Errorf("comparison = %d %+v identical %v, want test and dev identical", status, got, identical)
+	}
+}
+
+func TestComparePoliciesRejected(t *testing.T) {
+	useFakeClient(t)
+	if err := useCompareNamespaces(t, "dev,test"); err != nil {
+		t.Fatal(err)
+	}
+	useGatewayIdentity(t, true, "10.0.0.0/8")
+
+	reader := func(roles string) *http.Request {
+		r := gatewayRequest("10.1.2.3:41000")
+		r.URL.Path = comparePath
+		r.Header.Set("X-Authenticated-Roles", roles)
+		return r
+	}
+
+	tests := []struct {
+		name    string
+		request *http.Request
+		want    int
+	}{
+		{name: "outside COMPARE_NAMESPACES", request: asAdmin(httptest.NewRequest("GET", comparePath+"?namespaces=dev,kube-system", nil)), want: http.StatusForbidden},
+		{name: "unauthenticated", request: httptest.NewRequest("GET", comparePath, nil), want: http.StatusUnauthorized},
+		{name: "reader", request: reader(roleReader), want: http.StatusOK},
+		{name: "no role", request: reader(""), want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status, _, _ := comparison(t, tt.request); status != tt.want {
+				t.Errorf("status = %d, want %d", status, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareDisabled(t *testing.T) {
+	if err := useCompareNamespaces(t, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if status, _, _ := comparison(t, asAdmin(httptest.NewRequest("GET", comparePath, nil))); status != http.StatusNotFound {
+		t.Errorf("status = %d, want %d without COMPARE_NAMESPACES", status, http.StatusNotFound)
+	}
+}
+
+func TestCompareNamespacesSetting(t *testing.T) {
+	if err := useCompareNamespaces(t, "dev,Not_A_Namespace"); err == nil {
+		t.Error("an invalid namespace in COMPARE_NAMESPACES was accepted")
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	overloadQueue  = "queue"
+	overloadReject = "reject"
+)
+
+var (
+	writeLimiter *limiter
+	readLimiter  *limiter
+
+	overloadPolicy       string
+	overloadQueueTimeout time.Duration
+)
+
+// limiter is a semaphore bounding the number of requests of one kind in flight.
+type limiter struct {
+	kind  string
+	slots chan struct{}
+}
+
+func newLimiter(kind string, size int) *limiter {
+	return &limiter{
+		kind:  kind,
+		slots: make(chan struct{}, size),
+	}
+}
+
+func (l *limiter) acquire(r *http.Request) bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	if overloadPolicy == overloadReject {
+		return false
+	}
+
+	svcMetrics.queueDepth.WithLabelValues(l.kind).Inc()
+	defer svcMetrics.queueDepth.WithLabelValues(l.kind).Dec()
+
+	timer := time.NewTimer(overloadQueueTimeout)
+	defer timer.Stop()
+
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+func (l *limiter) release() {
+	<-l.slots
+}
+
+func isMutation(method string) bool {
+	return method == "PUT" || method == "PATCH" || method == "POST" || method == "DELETE"
+}
+
+func concurrencyMiddleware(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	// event streams are long-lived and limited by MAX_EVENT_SUBSCRIBERS instead
+	if r.URL.Path == policyEventsPath {
+		next(w, r)
+		return
+	}
+
+	l := readLimiter
+	if isMutation(r.Method) {
+		l = writeLimiter
+	}
+
+	if !l.acquire(r) {
+		w.Header().Set("Retry-After", "1")
+		writeError(w, http.StatusServiceUnavailable, codeOverloaded, "Too many concurrent requests, retry later.")
+		return
+	}
+	defer l.release()
+
+	next(w, r)
+}
+
+func setupConcurrencyLimits() error {
+	maxWrites, err := intFromEnv("MAX_CONCURRENT_WRITES", 4)
+	if err != nil {
+		return err
+	}
+
+	maxReads, err := intFromEnv("MAX_CONCURRENT_READS", 32)
+	if err != nil {
+		return err
+	}
+
+	overloadPolicy = os.Getenv("OVERLOAD_POLICY")
+	if overloadPolicy == "" {
+		overloadPolicy = overloadQueue
+	}
+
+	if overloadPolicy != overloadQueue && overloadPolicy != overloadReject {
+		return fmt.Errorf("OVERLOAD_POLICY must be one of %s, %s", overloadQueue, overloadReject)
+	}
+
+	overloadQueueTimeout, err = durationFromEnv("OVERLOAD_QUEUE_TIMEOUT", 5*time.Second)
+	if err != nil {
+		return err
+	}
+
+	writeLimiter = newLimiter("write", maxWrites)
+	readLimiter = newLimiter("read", maxReads)
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// useConcurrencyLimits sets the write and read limits and the overload policy for the
+// rest of the test.
+func useConcurrencyLimits(t *testing.T, writes, reads int, policy string, queueTimeout time.Duration) {
+	previousWrites, previousReads := writeLimiter, readLimiter
+	previousPolicy, previousTimeout := overloadPolicy, overloadQueueTimeout
+	t.Cleanup(func() {
+		writeLimiter, readLimiter = previousWrites, previousReads
+		overloadPolicy, overloadQueueTimeout = previousPolicy, previousTimeout
+	})
+
+	writeLimiter, readLimiter = newLimiter("write", writes), newLimiter("read", reads)
+	overloadPolicy, overloadQueueTimeout = policy, queueTimeout
+}
+
+// blockingHandler returns concurrencyMiddleware around a handler that answers 204 once
+// release is closed, and a channel receiving each request it starts.
+func blockingHandler(release <-chan struct{}) (http.HandlerFunc, <-chan struct{}) {
+	started := make(chan struct{}, 8)
+	return func(w http.ResponseWriter, r *http.Request) {
+		concurrencyMiddleware(w, r, func(w http.ResponseWriter, r *http.Request) {
+			started <- struct{}{}
+			<-release
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}, started
+}
+
+// sendAsync serves r in the background, sending the response to the returned channel.
+func sendAsync(handler http.Handler, r *http.Request) <-chan *httptest.ResponseRecorder {
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() { done <- serve(handler, r) }()
+	return done
+}
+
+func TestWriteLimitRejects(t *testing.T) {
+	useConcurrencyLimits(t, 1, 1, overloadReject, time.Second)
+	release := make(chan struct{})
+	handler, started := blockingHandler(release)
+
+	first := sendAsync(handler, httptest.NewRequest("PUT", policyPath, nil))
+	<-started
+
+	w := serve(handler, httptest.NewRequest("PUT", policyPath, nil))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("write over the limit = %d with Retry-After %q, want %d with 1", w.Code, w.Header().Get("Retry-After"), http.StatusServiceUnavailable)
+	}
+
+	// reads have their own limit
+	read := sendAsync(handler, httptest.NewRequest("GET", policyPath, nil))
+	<-started
+
+	close(release)
+	if w := <-first; w.Code != http.StatusNoContent {
+		t.Errorf("write within the limit = %d, want %d", w.Code, http.StatusNoContent)
+	}
+	if w := <-read; w.Code != http.StatusNoContent {
+		t.Errorf("read during a write = %d, want %d", w.Code, http.StatusNoContent)
+	}
+
+	if w := serve(handler, httptest.NewRequest("PUT", policyPath, nil)); w.Code != http.StatusNoContent {
+		t.Errorf("write after the limit freed up = %d, want %d", w.Code, http.StatusNoContent)
+	}
+}
+
+func TestWriteLimitQueues(t *testing.T) {
+	useConcurrencyLimits(t, 1, 1, overloadQueue, 5*time.Second)
+	release := make(chan struct{})
+	handler, started := blockingHandler(release)
+	queueDepth := svcMetrics.queueDepth.WithLabelValues("write")
+
+	first := sendAsync(handler, httptest.NewRequest("PUT", policyPath, nil))
+	<-started
+	queued := sendAsync(handler, httptest.NewRequest("PUT", policyPath, nil))
+
+	deadline := time.Now().Add(time.Second)
+	for testutil.ToFloat64(queueDepth) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("queue depth = %v, want 1", testutil.ToFloat64(queueDepth))
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	close(release)
+	if w := <-first; w.Code != http.StatusNoContent {
+		t.Errorf("first write = %d, want %d", w.Code, http.StatusNoContent)
+	}
+	if w := <-queued; w.Code != http.StatusNoContent {
+		t.Errorf("queued write = %d, want %d", w.Code, http.StatusNoContent)
+	}
+	if depth := testutil.ToFloat64(queueDepth); depth != 0 {
+		t.Errorf("queue depth after the writes = %v, want 0", depth)
+	}
+}
+
+func TestWriteLimitQueueTimeout(t *testing.T) {
+	useConcurrencyLimits(t, 1, 1, overloadQueue, 20*time.Millisecond)
+	release := make(chan struct{})
+	defer close(release)
+	handler, started := blockingHandler(release)
+
+	sendAsync(handler, httptest.NewRequest("PUT", policyPath, nil))
+	<-started
+
+	if w := serve(handler, httptest.NewRequest("PUT", policyPath, nil)); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("write queued past OVERLOAD_QUEUE_TIMEOUT = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestOverloadPolicySetting(t *testing.T) {
+	useConcurrencyLimits(t, 1, 1, overloadQueue, time.Second)
+
+	t.Setenv("OVERLOAD_POLICY", "drop")
+	if err := setupConcurrencyLimits(); err == nil {
+		t.Error("OVERLOAD_POLICY=drop accepted")
+	}
+
+	t.Setenv("OVERLOAD_POLICY", overloadReject)
+	t.Setenv("MAX_CONCURRENT_WRITES", "2")
+	if err := setupConcurrencyLimits(); err != nil || overloadPolicy != overloadReject || cap(writeLimiter.slots) != 2 {
+		t.Errorf("settings = %s, %d writes, %v", overloadPolicy, cap(writeLimiter.slots), err)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// intFromEnv reads a positive integer setting, falling back to def when unset.
+func intFromEnv(name string, def int) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil || i <= 0 {
+		return 0, fmt.Errorf("%s must be a positive integer", name)
+	}
+
+	return i, nil
+}
+
+// listenAddress returns the address the API binds to: BIND_ADDRESS when set, otherwise
+// every interface on LISTENING_PORT.
+func listenAddress(bindAddress, port string) (string, error) {
+	if bindAddress == "" {
+		return fmt.Sprintf(":%v", port), nil
+	}
+
+	_, p, err := net.SplitHostPort(bindAddress)
+	if err != nil {
+		return "", fmt.Errorf("BIND_ADDRESS must be host:port: %v", err)
+	}
+
+	if n, err := strconv.Atoi(p); err != nil || n <= 0 || n > 65535 {
+		return "", fmt.Errorf("BIND_ADDRESS has an invalid port %q", p)
+	}
+
+	return bindAddress, nil
+}
+
+// durationFromEnv reads a positive duration setting, falling back to def when unset.
+func durationFromEnv(name string, def time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%s must be a positive duration", name)
+	}
+
+	return d, nil
+}
+
+// optionalDurationFromEnv reads a duration setting that is disabled by default and by
+// 0, so 0 is accepted where durationFromEnv rejects it.
+func optionalDurationFromEnv(name string) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("%s must be a duration of 0 or more", name)
+	}
+
+	return d, nil
+}
+
+const (
+	updateStrategyMerge   = "merge"
+	updateStrategyReplace = "replace"
+)
+
+// updateStrategy decides what happens to ConfigMap data keys other than the policy
+// on a write: merge keeps them, replace removes them.
+var updateStrategy = os.Getenv("UPDATE_STRATEGY")
+
+func setupUpdateStrategy() error {
+	if updateStrategy == "" {
+		updateStrategy = updateStrategyMerge
+	}
+
+	if updateStrategy != updateStrategyMerge && updateStrategy != updateStrategyReplace {
+		return fmt.Errorf("UPDATE_STRATEGY must be one of %s, %s", updateStrategyMerge, updateStrategyReplace)
+	}
+
+	if updateStrategy == updateStrategyReplace && useServerSideApply {
+		return errors.New("UPDATE_STRATEGY=replace is not supported with USE_SERVER_SIDE_APPLY")
+	}
+
+	return nil
+}
+
+const (
+	unknownFieldsReject = "reject"
+	unknownFieldsIgnore = "ignore"
+	unknownFieldsWarn   = "warn"
+)
+
+// unknownFields decides what decodePolicy does with fields that aren't part of the
+// policy: reject fails with a 400, ignore drops them, warn logs and drops them.
+var unknownFields = os.Getenv("UNKNOWN_FIELDS")
+
+func setupUnknownFields() error {
+	if unknownFields == "" {
+		unknownFields = unknownFieldsReject
+	}
+
+	if unknownFields != unknownFieldsReject && unknownFields != unknownFieldsIgnore && unknownFields != unknownFieldsWarn {
+		return fmt.Errorf("UNKNOWN_FIELDS must be one of %s, %s, %s", unknownFieldsReject, unknownFieldsIgnore, unknownFieldsWarn)
+	}
+
+	return nil
+}
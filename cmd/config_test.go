@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestOptionalDurationSettings(t *testing.T) {
+	settings := []struct {
+		name    string
+		setup   func() error
+		setting *time.Duration
+	}{
+		{name: "MIN_CHANGE_INTERVAL", setup: setupChangeThrottle, setting: &minChangeInterval},
+		{name: "POLICY_CACHE_TTL", setup: setupPolicyCache, setting: &policyCacheTTL},
+		{name: "AUTH_FAILURE_DELAY", setup: setupAuthFailureDelay, setting: &authFailureDelay},
+	}
+
+	for _, setting := range settings {
+		t.Run(setting.name, func(t *testing.T) {
+			previous := *setting.setting
+			t.Cleanup(func() { *setting.setting = previous })
+
+			for value, want := range map[string]time.Duration{"": 0, "0": 0, "0s": 0, "2s": 2 * time.Second} {
+				t.Setenv(setting.name, value)
+				if err := setting.setup(); err != nil || *setting.setting != want {
+					t.Errorf("%s=%q = %v, %v, want %v", setting.name, value, *setting.setting, err, want)
+				}
+			}
+
+			for _, value := range []string{"-1s", "soon"} {
+				t.Setenv(setting.name, value)
+				if err := setting.setup(); err == nil {
+					t.Errorf("%s=%q accepted", setting.name, value)
+				}
+			}
+		})
+	}
+}
+
+func TestDurationSettingRejectsZero(t *testing.T) {
+	t.Setenv("SHUTDOWN_TIMEOUT", "0")
+	if _, err := durationFromEnv("SHUTDOWN_TIMEOUT", time.Second); err == nil {
+		t.Error("SHUTDOWN_TIMEOUT=0 accepted, want a positive duration")
+	}
+}
+
+func TestListenAddress(t *testing.T) {
+	tests := []struct {
+		bindAddress string
+		port        string
+		want        string
+	}{
+		{port: "8080", want: ":8080"},
+		{bindAddress: "127.0.0.1:8443", port: "8080", want: "127.0.0.1:8443"},
+		{bindAddress: "[::1]:8443", want: "[::1]:8443"},
+		{bindAddress: ":8443", want: ":8443"},
+	}
+	for _, tt := range tests {
+		if got, err := listenAddress(tt.bindAddress, tt.port); err != nil || got != tt.want {
+			t.Errorf("listenAddress(%q, %q) = %q, %v, want %q", tt.bindAddress, tt.port, got, err, tt.want)
+		}
+	}
+
+	for _, bindAddress := range []string{"127.0.0.1", "127.0.0.1:", "127.0.0.1:0", "127.0.0.1:https", "127.0.0.1:70000"} {
+		if _, err := listenAddress(bindAddress, "8080"); err == nil {
+			t.Errorf("BIND_ADDRESS=%q accepted", bindAddress)
+		}
+	}
+}
+
+func TestBindAddress(t *testing.T) {
+	// find a free port on the loopback interface
+	free, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := free.Addr().(*net.TCPAddr).Port
+	free.Close()
+
+	addr, err := listenAddress("127.0.0.1:"+strconv.Itoa(port), "8080")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	bound := listener.Addr().(*net.TCPAddr)
+	if !bound.IP.Equal(net.IPv4(127, 0, 0, 1)) || bound.Port != port {
+		t.Errorf("bound %v, want 127.0.0.1:%d", bound, port)
+	}
+}
+
+func TestUpdateStrategySetting(t *testing.T) {
+	previousStrategy, previousApply := updateStrategy, useServerSideApply
+	t.Cleanup(func() { updateStrategy, useServerSideApply = previousStrategy, previousApply })
+
+	updateStrategy, useServerSideApply = "", false
+	if err := setupUpdateStrategy(); err != nil || updateStrategy != updateStrategyMerge {
+		t.Errorf("default UPDATE_STRATEGY = %q, %v, want %s", updateStrategy, err, updateStrategyMerge)
+	}
+
+	updateStrategy = "overwrite"
+	if err := setupUpdateStrategy(); err == nil {
+		t.Error("UPDATE_STRATEGY=overwrite accepted")
+	}
+
+	updateStrategy, useServerSideApply = updateStrategyReplace, true
+	if err := setupUpdateStrategy(); err == nil {
+		t.Error("UPDATE_STRATEGY=replace accepted with server-side apply")
+	}
+}
+
+func TestUpdateStrategyOfPut(t *testing.T) {
+	previous := updateStrategy
+	t.Cleanup(func() { updateStrategy = previous })
+
+	for _, strategy := range []string{updateStrategyMerge, updateStrategyReplace} {
+		updateStrategy = strategy
+		configMap := policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`)
+		configMap.Data["logging.json"] = `{"level":"info"}`
+		client := useFakeClient(t, configMap)
+
+		if w := putPolicy(newTestHandler(), `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":2}`); w.Code != http.StatusOK {
+			t.Fatalf("UPDATE_STRATEGY=%s: PUT = %d %s", strategy, w.Code, w.Body)
+		}
+
+		updated, err := client.CoreV1().ConfigMaps(namespace).Get(context.Background(), configmapName, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, kept := updated.Data["logging.json"]; kept != (strategy == updateStrategyMerge) {
+			t.Errorf("UPDATE_STRATEGY=%s: other key kept = %v, data = %v", strategy, kept, updated.Data)
+		}
+	}
+}
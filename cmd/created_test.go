@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// useApply sets USE_SERVER_SIDE_APPLY for the rest of the test.
+func useApply(t *testing.T, enabled bool) {
+	previous := useServerSideApply
+	useServerSideApply = enabled
+	t.Cleanup(func() { useServerSideApply = previous })
+}
+
+// putPolicyJSON sends body as a PUT of the policy as the admin, asking for a JSON
+// response, and returns the status, Location header and outcome.
+func putPolicyJSON(t *testing.T, body string) (int, string, string) {
+	r := asAdmin(httptest.NewRequest("PUT", policyPath, strings.NewReader(body)))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Accept", "application/json")
+	w := serve(newTestHandler(), r)
+
+	var resp struct {
+		Meta struct {
+			Outcome string `json:"outcome"`
+		} `json:"meta"`
+	}
+	if w.Code < 300 {
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%v: %s", err, w.Body)
+		}
+	}
+
+	return w.Code, w.Header().Get("Location"), resp.Meta.Outcome
+}
+
+func TestPutCreatesConfigMap(t *testing.T) {
+	useApply(t, true)
+	client := useFakeClient(t)
+
+	status, location, outcome := putPolicyJSON(t, `{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`)
+	if status != http.StatusCreated || location != policyPath || outcome != "created" {
+		t.Errorf("PUT creating the config map = %d %q %s, want %d %q created", status, location, outcome, http.StatusCreated, policyPath)
+	}
+	if doc := storedDocument(t, client); !strings.Contains(doc, `"UnprocessableFileTypeAction":1`) {
+		t.Errorf("stored policy = %s, want the created policy", doc)
+	}
+}
+
+func TestPutUpdatesConfigMap(t *testing.T) {
+	for _, serverSideApply := range []bool{false, true} {
+		t.Run(map[bool]string{false: "update", true: "apply"}[serverSideApply], func(t *testing.T) {
+			useApply(t, serverSideApply)
+			client := useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`))
+
+			// the fake API keeps the resourceVersion on apply, which reads as unchanged
+			status, location, outcome := putPolicyJSON(t, `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":1}`)
+			if status != http.StatusOK || location != "" || outcome == "created" {
+				t.Errorf("PUT updating the config map = %d %q %s, want %d with no Location", status, location, outcome, http.StatusOK)
+			}
+			if !serverSideApply && outcome != "updated" {
+				t.Errorf("outcome = %s, want updated", outcome)
+			}
+			if doc := storedDocument(t, client); !strings.Contains(doc, `"UnprocessableFileTypeAction":2`) {
+				t.Errorf("stored policy = %s, want the update applied", doc)
+			}
+		})
+	}
+}
+
+func TestPutMissingConfigMapWithoutApply(t *testing.T) {
+	useApply(t, false)
+	useFakeClient(t)
+
+	if status, _, _ := putPolicyJSON(t, `{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`); status != http.StatusNotFound {
+		t.Errorf("PUT to a missing config map = %d, want %d", status, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// debugLogging enables the debug level logs, which trace how each policy in a request
+// was validated. They are skipped before any formatting at other levels.
+var debugLogging = strings.EqualFold(os.Getenv("LOG_LEVEL"), "debug")
+
+// traceValidation logs the outcome of one validation step for the request r at the
+// debug level, with the request attributes of its context, so the steps can be
+// filtered by step and grouped by request.
+func traceValidation(r *http.Request, step, outcome, value string) {
+	slog.DebugContext(r.Context(), "validation", "step", step, "outcome", outcome, "value", value)
+}
+
+// traceDecodedPolicy logs the decode step of a policy and, once it has decoded, the
+// check of each field with its value, subject to LOG_REDACT_POLICY.
+func traceDecodedPolicy(r *http.Request, p Policy, err error) {
+	if !debugLogging {
+		return
+	}
+
+	var invalid *validationError
+	if err != nil && !errors.As(err, &invalid) {
+		traceValidation(r, "decode", "error", redactPolicyError(err))
+		return
+	}
+
+	traceValidation(r, "decode", "ok", "")
+	traceField(r, "UnprocessableFileTypeAction", p.UnprocessableFileTypeAction)
+	traceField(r, "GlasswallBlockedFilesAction", p.GlasswallBlockedFilesAction)
+}
+
+func traceField(r *http.Request, field string, value *ActionValue) {
+	outcome := actionProblem(value)
+	if outcome == "" {
+		outcome = "ok"
+	}
+
+	shown := "null"
+	if value != nil {
+		shown = strconv.Itoa(int(*value))
+	}
+
+	traceValidation(r, "field."+field, outcome, redactPolicy(shown))
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTraceValidation(t *testing.T) {
+	useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`))
+	previous := debugLogging
+	debugLogging = true
+	t.Cleanup(func() { debugLogging = previous })
+	logs := captureLogsAt(t, slog.LevelDebug)
+
+	r := httptest.NewRequest("PUT", "/api/v1/policy", strings.NewReader(`{"GlasswallBlockedFilesAction":1}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-Request-ID", "trace-1")
+	serve(newTestHandler(), asAdmin(r))
+
+	steps := map[string]map[string]interface{}{}
+	for _, record := range logs() {
+		if record["msg"] == "validation" {
+			steps[record["step"].(string)] = record
+		}
+	}
+
+	tests := []struct {
+		step, outcome, value string
+	}{
+		{step: "content_type", outcome: "ok", value: "application/json"},
+		{step: "decode", outcome: "ok", value: ""},
+		{step: "field.UnprocessableFileTypeAction", outcome: "missing", value: "null"},
+		{step: "field.GlasswallBlockedFilesAction", outcome: "ok", value: "1"},
+	}
+	for _, tt := range tests {
+		record, ok := steps[tt.step]
+		if !ok {
+			t.Errorf("step %s not logged", tt.step)
+			continue
+		}
+		if record["level"] != "DEBUG" || record["outcome"] != tt.outcome || record["value"] != tt.value {
+			t.Errorf("step %s = %v, want a debug record with outcome %s and value %q", tt.step, record, tt.outcome, tt.value)
+		}
+		if record["request_id"] != "trace-1" || record["path"] != "/api/v1/policy" {
+			t.Errorf("step %s = %v, want the request attributes", tt.step, record)
+		}
+	}
+}
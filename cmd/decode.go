@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// errTrailingData is returned when a policy body holds anything after the policy object.
+var errTrailingData = errors.New("policy body has data after the policy object")
+
+// validationError marks a policy that decoded cleanly but failed validation.
+type validationError struct {
+	err error
+}
+
+func (e *validationError) Error() string {
+	return e.err.Error()
+}
+
+// bodyReadError marks a failure to read the request body itself, such as a body
+// shorter than its Content-Length or broken chunked encoding, as opposed to a body
+// that was read but isn't a valid policy.
+type bodyReadError struct {
+	err error
+}
+
+func (e *bodyReadError) Error() string {
+	return e.err.Error()
+}
+
+func (e *bodyReadError) Unwrap() error {
+	return e.err
+}
+
+// requestBody fails reads once ctx is done, so a body trickled in byte by byte is
+// abandoned when the request runs out of time. A body that stalls completely is cut
+// off by the server read timeout instead.
+type requestBody struct {
+	ctx context.Context
+	r   io.ReadCloser
+}
+
+func (b *requestBody) Read(p []byte) (int, error) {
+	if err := b.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	n, err := b.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = &bodyReadError{err: err}
+	}
+
+	return n, err
+}
+
+func (b *requestBody) Close() error {
+	return b.r.Close()
+}
+
+// maxBodyBytes is the largest request body accepted.
+const maxBodyBytes = 1048576
+
+// limitRequestBody bounds the request body in size and in time.
+func limitRequestBody(w http.ResponseWriter, r *http.Request) {
+	if debugLogging {
+		switch {
+		case r.ContentLength < 0:
+			traceValidation(r, "size", "unknown", "")
+		case r.ContentLength > maxBodyBytes:
+			traceValidation(r, "size", "too_large", strconv.FormatInt(r.ContentLength, 10))
+		default:
+			traceValidation(r, "size", "ok", strconv.FormatInt(r.ContentLength, 10))
+		}
+	}
+
+	r.Body = http.MaxBytesReader(w, &requestBody{ctx: r.Context(), r: r.Body}, maxBodyBytes)
+}
+
+// decodePolicy is the single strict path from an untrusted body to a valid policy:
+// exactly one JSON object, no unknown fields unless UNKNOWN_FIELDS allows them, every
+// field present and in range. It never panics; callers bound the size of r.
+func decodePolicy(r io.Reader) (Policy, error) {
+	p, err := decodePolicyFields(r)
+	if err != nil {
+		return p, err
+	}
+
+	return p, checkPolicy(p)
+}
+
+// checkPolicy validates a decoded policy, returning a *validationError if it fails.
+func checkPolicy(p Policy) error {
+	if err := validatePolicy(p); err != nil {
+		return &validationError{err: err}
+	}
+
+	return nil
+}
+
+// decodePolicyFields is decodePolicy without the check that every field is present,
+// for a caller that completes the policy before validating it. An empty body decodes
+// as a policy with no fields.
+func decodePolicyFields(r io.Reader) (Policy, error) {
+	dec := json.NewDecoder(r)
+
+	// the raw object is kept to name the fields that are dropped or invalid
+	var p Policy
+	var raw json.RawMessage
+	err := dec.Decode(&raw)
+	if err == nil {
+		fields := json.NewDecoder(bytes.NewReader(raw))
+		if unknownFields == unknownFieldsReject {
+			fields.DisallowUnknownFields()
+		}
+		err = fields.Decode(&p)
+		if unknownFields == unknownFieldsWarn {
+			warnUnknownFields(raw)
+		}
+	}
+	if err == io.EOF {
+		// an empty body is missing every field, like {}
+		return p, nil
+	}
+	if invalid := actionValueError(err, raw); invalid != nil {
+		return p, &validationError{err: invalid}
+	}
+	if err != nil {
+		return p, err
+	}
+
+	_, err = dec.Token()
+	var readErr *bodyReadError
+	if errors.As(err, &readErr) || isTimeout(err) {
+		return p, err
+	}
+	if err != io.EOF {
+		return p, errTrailingData
+	}
+
+	return p, nil
+}
+
+// warnUnknownFields logs each field of the policy object raw that is not a policy
+// field. Field names match case-insensitively, as they do when decoding.
+func warnUnknownFields(raw json.RawMessage) {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(raw, &fields) != nil {
+		return
+	}
+
+	for name := range fields {
+		known := false
+		for field := range policyFields {
+			known = known || strings.EqualFold(name, field)
+		}
+
+		if !known {
+			log.Printf("Ignoring unknown policy field %q", name)
+		}
+	}
+}
+
+// writePolicyError reports an error returned by decodePolicy.
+func writePolicyError(w http.ResponseWriter, r *http.Request, err error) {
+	var invalid *validationError
+	if errors.As(err, &invalid) {
+		var missing *missingFieldsError
+		if errors.As(invalid.err, &missing) {
+			lang := requestLanguage(r)
+			w.Header().Set("Content-Language", lang)
+			writeFieldsError(w, http.StatusBadRequest, codeValidation, missing.localized().in(lang), missing.fields)
+			return
+		}
+
+		var localized localizedError
+		if errors.As(invalid.err, &localized) {
+			writeLocalizedError(w, r, http.StatusBadRequest, codeValidation, localized)
+			return
+		}
+
+		writeError(w, http.StatusBadRequest, codeValidation, invalid.Error())
+		return
+	}
+
+	writeDecodeError(w, err)
+}
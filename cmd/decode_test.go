@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// FuzzPolicyDecode checks that decodePolicy never panics, that a policy it accepts is
+// valid, and that writePolicyError answers anything it rejects with a well-formed 4xx
+// error. Run it with go test -fuzz=FuzzPolicyDecode ./cmd.
+func FuzzPolicyDecode(f *testing.F) {
+	seeds := []string{
+		`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":2}`,
+		``,
+		`{}`,
+		`null`,
+		`[]`,
+		`"policy"`,
+		`{"UnprocessableFileTypeAction":1}`,
+		`{"UnprocessableFileTypeAction":0,"GlasswallBlockedFilesAction":5}`,
+		`{"UnprocessableFileTypeAction":1.5,"GlasswallBlockedFilesAction":2}`,
+		`{"UnprocessableFileTypeAction":1e400,"GlasswallBlockedFilesAction":2}`,
+		`{"UnprocessableFileTypeAction":-9223372036854775809,"GlasswallBlockedFilesAction":2}`,
+		`{"UnprocessableFileTypeAction":"1","GlasswallBlockedFilesAction":true}`,
+		`{"UnprocessableFileTypeAction":null,"GlasswallBlockedFilesAction":null}`,
+		`{"unprocessableFileTypeAction":1,"glasswallBlockedFilesAction":2}`,
+		`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":2,"Other":{}}`,
+		`{"UnprocessableFileTypeAction":1,"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":2}`,
+		`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":2} {}`,
+		`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":2`,
+		`{"UnprocessableFileTypeAction":[[[[[[[[[[[[[[[[[[[[1]]]]]]]]]]]]]]]]]]]}`,
+		strings.Repeat("[", 10000) + strings.Repeat("]", 10000),
+		`{"Other":` + strings.Repeat(`{"a":`, 10000) + `1` + strings.Repeat(`}`, 10000) + `}`,
+		"{\"UnprocessableFileTypeAction\":1,\"GlasswallBlockedFilesAction\":2,\"\xff\":1}",
+		"\xef\xbb\xbf{}",
+	}
+	for _, seed := range seeds {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		p, err := decodePolicy(io.LimitReader(bytes.NewReader(body), maxBodyBytes))
+		if err == nil {
+			if validatePolicy(p) != nil {
+				t.Fatalf("accepted an invalid policy %+v", p)
+			}
+			return
+		}
+
+		w := httptest.NewRecorder()
+		writePolicyError(w, httptest.NewRequest("PUT", policyPath, nil), err)
+		if w.Code < 400 || w.Code >= 500 {
+			t.Fatalf("error %q answered with status %d", err, w.Code)
+		}
+
+		var response errorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || response.Code == "" || response.Message == "" {
+			t.Fatalf("error response %q is not well-formed", w.Body)
+		}
+		if got := w.Header().Get("Content-Type"); got != "application/json" {
+			t.Fatalf("Content-Type = %q, want application/json", got)
+		}
+	})
+}
+
+// slowBody sends one byte of its body every interval, like a client trickling a body
+// to hold a request open.
+type slowBody struct {
+	body     []byte
+	interval time.Duration
+}
+
+func (b *slowBody) Read(p []byte) (int, error) {
+	if len(b.body) == 0 {
+		return 0, io.EOF
+	}
+
+	time.Sleep(b.interval)
+	p[0], b.body = b.body[0], b.body[1:]
+	return 1, nil
+}
+
+// useRequestTimeout sets REQUEST_TIMEOUT for the rest of the test.
+func useRequestTimeout(t *testing.T, d time.Duration) {
+	previous := requestTimeout
+	requestTimeout = d
+	t.Cleanup(func() { requestTimeout = previous })
+}
+
+func TestSlowBodyTimesOut(t *testing.T) {
+	doc := `{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`
+	client := useFakeClient(t, policyConfigMap(doc))
+	useRequestTimeout(t, 200*time.Millisecond)
+
+	// the whole body would take over 3s to arrive
+	body := &slowBody{body: []byte(`{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":2}`), interval: 50 * time.Millisecond}
+	r := httptest.NewRequest("PUT", "/api/v1/policy", body)
+	r.Header.Set("Content-Type", "application/json")
+
+	start := time.Now()
+	w := serve(newTestHandler(), asAdmin(r))
+	if w.Code != http.StatusRequestTimeout {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusRequestTimeout, w.Body)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("the request took %v, want it abandoned at the deadline", elapsed)
+	}
+
+	var resp errorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Code != codeTimeout {
+		t.Errorf("body = %s, want code %s", w.Body, codeTimeout)
+	}
+	if got := storedDocument(t, client); got != doc {
+		t.Errorf("stored policy = %s, want it unchanged", got)
+	}
+}
+
+// sendRaw writes a PUT of the policy with the given extra headers and body to server as
+// is, closes the sending side and returns the response, so a test can send a body that
+// doesn't match its framing.
+func sendRaw(t *testing.T, server *httptest.Server, headers, body string) *http.Response {
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	request := asAdmin(httptest.NewRequest("PUT", policyPath, nil))
+	fmt.Fprintf(conn, "PUT %s HTTP/1.1\r\nHost: %s\r\nAuthorization: %s\r\nContent-Type: application/json\r\n%s\r\n%s",
+		policyPath, server.Listener.Addr(), request.Header.Get("Authorization"), headers, body)
+	conn.(*net.TCPConn).CloseWrite()
+
+	response, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { response.Body.Close() })
+
+	return response
+}
+
+func TestMisframedBodyRejected(t *testing.T) {
+	doc := `{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`
+	client := useFakeClient(t, policyConfigMap(doc))
+	server := httptest.NewServer(newTestHandler())
+	defer server.Close()
+
+	body := `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":2}`
+	tests := []struct {
+		name    string
+		headers string
+		body    string
+	}{
+		{"declared but truncated", "Content-Length: 200\r\n", body},
+		{"shorter content length", "Content-Length: 40\r\n", body},
+		{"malformed chunk size", "Transfer-Encoding: chunked\r\n", "zz\r\n" + body + "\r\n0\r\n\r\n"},
+		{"chunks cut short", "Transfer-Encoding: chunked\r\n", fmt.Sprintf("%x\r\n%s", len(body)+10, body)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := sendRaw(t, server, tt.headers, tt.body)
+			if response.StatusCode != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d", response.StatusCode, http.StatusBadRequest)
+			}
+
+			var resp errorResponse
+			if err := json.NewDecoder(response.Body).Decode(&resp); err != nil || resp.Code != codeJSONError {
+				t.Errorf("body = %+v, %v, want code %s", resp, err, codeJSONError)
+			}
+			if got := storedDocument(t, client); got != doc {
+				t.Errorf("stored policy = %s, want it unchanged", got)
+			}
+		})
+	}
+}
+
+func TestEmptyPolicyMissesEveryField(t *testing.T) {
+	doc := `{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`
+	client := useFakeClient(t, policyConfigMap(doc))
+	want := `{"code":"validation","message":"UnprocessableFileTypeAction, GlasswallBlockedFilesAction are required.","fields":["UnprocessableFileTypeAction","GlasswallBlockedFilesAction"]}` + "\n"
+
+	// an empty body is answered exactly like an empty object
+	for _, body := range []string{``, `{}`, " \n", ` { } `} {
+		w := putPolicy(newTestHandler(), body)
+		if w.Code != http.StatusBadRequest || w.Body.String() != want {
+			t.Errorf("PUT %q = %d %s, want %d %s", body, w.Code, w.Body, http.StatusBadRequest, want)
+		}
+	}
+
+	w := putPolicy(newTestHandler(), `{"GlasswallBlockedFilesAction":1}`)
+	want = `{"code":"validation","message":"UnprocessableFileTypeAction is required.","fields":["UnprocessableFileTypeAction"]}` + "\n"
+	if w.Code != http.StatusBadRequest || w.Body.String() != want {
+		t.Errorf("PUT of a partial policy = %d %s, want %d %s", w.Code, w.Body, http.StatusBadRequest, want)
+	}
+
+	if got := storedDocument(t, client); got != doc {
+		t.Errorf("stored policy = %s, want it unchanged", got)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/golang/gddo/httputil/header"
+)
+
+// envelope is the shape of every JSON success response: the resource in data and
+// anything describing it, such as where it was read from, in meta.
+type envelope struct {
+	Data interface{}            `json:"data"`
+	Meta map[string]interface{} `json:"meta,omitempty"`
+}
+
+func writeData(w http.ResponseWriter, status int, data interface{}, meta map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(envelope{Data: data, Meta: meta})
+}
+
+// acceptsJSON reports whether the client asked for application/json explicitly. The
+// token and update endpoints predate the envelope and keep their plain text bodies
+// for clients that don't.
+func acceptsJSON(r *http.Request) bool {
+	for _, spec := range header.ParseAccept(r.Header, "Accept") {
+		if spec.Value == "application/json" && spec.Q > 0 {
+			return true
+		}
+	}
+
+	return false
+}
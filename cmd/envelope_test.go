@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEnvelope(t *testing.T) {
+	const policyBody = `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":2}`
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		meta   bool
+	}{
+		{name: "policy", method: "GET", path: policyPath, meta: true},
+		{name: "policy update", method: "PUT", path: policyPath, body: policyBody, meta: true},
+		{name: "policy defaults", method: "GET", path: "/api/v1/policy/defaults"},
+		{name: "policy render", method: "POST", path: "/api/v1/policy/render", body: policyBody, meta: true},
+		{name: "token", method: "GET", path: tokenPath, meta: true},
+		{name: "ping", method: "GET", path: "/api/v1/ping"},
+		{name: "status", method: "GET", path: "/api/v1/status"},
+		{name: "whoami", method: "GET", path: whoamiPath},
+		{name: "cache flush", method: "POST", path: "/api/v1/admin/cache/flush"},
+		{name: "audit", method: "GET", path: auditPath, meta: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`))
+
+			r := asAdmin(httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+			r.Header.Set("Accept", "application/json")
+			if tt.body != "" {
+				r.Header.Set("Content-Type", "application/json")
+			}
+
+			w := serve(newTestHandler(), r)
+			if w.Code >= http.StatusBadRequest {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			if contentType := w.Header().Get("Content-Type"); contentType != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", contentType)
+			}
+
+			var body map[string]json.RawMessage
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("body %s is not a JSON object: %v", w.Body, err)
+			}
+			if data, ok := body["data"]; !ok || string(data) == "null" {
+				t.Errorf("body %s has no data", w.Body)
+			}
+			if _, ok := body["meta"]; ok != tt.meta {
+				t.Errorf("body %s has meta %v, want %v", w.Body, ok, tt.meta)
+			}
+			for member := range body {
+				if member != "data" && member != "meta" {
+					t.Errorf("body %s has member %q outside the envelope", w.Body, member)
+				}
+			}
+		})
+	}
+}
+
+func TestLegacyPlainResponses(t *testing.T) {
+	useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`))
+	handler := newTestHandler()
+
+	// without Accept: application/json the token and update endpoints answer as before
+	token := serve(handler, asAdmin(httptest.NewRequest("GET", tokenPath, nil)))
+	if token.Code != http.StatusOK || strings.Count(token.Body.String(), ".") != 2 {
+		t.Errorf("token = %d %s, want a bare JWT", token.Code, token.Body)
+	}
+
+	update := putPolicy(handler, `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":2}`)
+	if update.Code != http.StatusOK || update.Body.String() != "Successfully updated config map." {
+		t.Errorf("update = %d %s, want the plain message", update.Code, update.Body)
+	}
+}
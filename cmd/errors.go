@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	policy "github.com/filetrust/policy-update-service/pkg"
+)
+
+// Error codes returned in the code field of every error response. They are stable
+// and double as the code label of gw_ncfspolicyupdate_errors_total.
+const (
+	codeJSONError            = "json_error"
+	codeValidation           = "validation"
+	codeUnsupportedMediaType = "unsupported_media_type"
+	codeUnauthorized         = "unauthorized"
+	codeForbidden            = "forbidden"
+	codeNotFound             = "not_found"
+	codeMethodNotAllowed     = "method_not_allowed"
+	codeK8sClient            = "k8s_client"
+	codeConfigMap            = "configmap"
+	codeRBAC                 = "rbac"
+	codeConflict             = "conflict"
+	codeOverloaded           = "overloaded"
+	codeRateLimited          = "rate_limited"
+	codeTimeout              = "timeout"
+	codePreconditionFailed   = "precondition_failed"
+	codeFrozen               = "frozen"
+	codeHeadersTooLarge      = "headers_too_large"
+	codeNonceReused          = "nonce_reused"
+	codeInternal             = "internal"
+)
+
+// problemJSON switches error responses to RFC 7807 problem documents.
+var problemJSON = os.Getenv("PROBLEM_JSON") == "true"
+
+// problemTypePrefix is followed by the error code to form the problem type URI.
+const problemTypePrefix = "urn:ncfs-policy-update:error:"
+
+// problemTitles summarises each error code; the message becomes the detail.
+var problemTitles = map[string]string{
+	codeJSONError:            "Malformed request body",
+	codeValidation:           "Invalid request",
+	codeUnsupportedMediaType: "Unsupported media type",
+	codeUnauthorized:         "Authentication failed",
+	codeForbidden:            "Permission denied",
+	codeNotFound:             "Resource not found",
+	codeMethodNotAllowed:     "Method not allowed",
+	codeK8sClient:            "Kubernetes client unavailable",
+	codeConfigMap:            "Config map operation failed",
+	codeRBAC:                 "Config map access denied",
+	codeConflict:             "Config map modified concurrently",
+	codeOverloaded:           "Service overloaded",
+	codeRateLimited:          "Rate limit exceeded",
+	codeTimeout:              "Request timed out",
+	codePreconditionFailed:   "Precondition failed",
+	codeFrozen:               "Policy changes frozen",
+	codeHeadersTooLarge:      "Request headers too large",
+	codeNonceReused:          "Request replayed",
+	codeInternal:             "Internal error",
+}
+
+type errorResponse struct {
+	Code    string   `json:"code"`
+	Message string   `json:"message"`
+	Fields  []string `json:"fields,omitempty"`
+}
+
+type problemResponse struct {
+	Type   string   `json:"type"`
+	Title  string   `json:"title"`
+	Status int      `json:"status"`
+	Detail string   `json:"detail"`
+	Code   string   `json:"code"`
+	Fields []string `json:"fields,omitempty"`
+}
+
+func writeError(w http.ResponseWriter, status int, code, msg string) {
+	writeFieldsError(w, status, code, msg, nil)
+}
+
+// writeFieldsError writes an error that concerns the named request fields, listed in
+// the fields member of the response.
+func writeFieldsError(w http.ResponseWriter, status int, code, msg string, fields []string) {
+	svcMetrics.errors.WithLabelValues(code).Inc()
+
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if problemJSON {
+		title, ok := problemTitles[code]
+		if !ok {
+			title = http.StatusText(status)
+		}
+
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(problemResponse{
+			Type:   problemTypePrefix + code,
+			Title:  title,
+			Status: status,
+			Detail: msg,
+			Code:   code,
+			Fields: fields,
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse{Code: code, Message: msg, Fields: fields})
+}
+
+func notFound(w http.ResponseWriter, r *http.Request) {
+	writeLocalizedError(w, r, http.StatusNotFound, codeNotFound, localizedError{key: msgNotFound})
+}
+
+func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeLocalizedError(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, localizedError{key: msgMethodNotAllowed})
+}
+
+// writeConfigMapError reports a failed ConfigMap operation according to its category.
+func writeConfigMapError(w http.ResponseWriter, err error, msg string) {
+	switch {
+	case errors.Is(err, policy.ErrNotFound):
+		writeError(w, http.StatusNotFound, codeNotFound, "The policy config map does not exist.")
+	case errors.Is(err, policy.ErrPreconditionFailed):
+		var perr *policy.Error
+		errors.As(err, &perr)
+		writeError(w, http.StatusPreconditionFailed, codePreconditionFailed, perr.Err.Error())
+	case errors.Is(err, policy.ErrConflict):
+		if useServerSideApply {
+			writeError(w, http.StatusConflict, codeConflict, "The policy in the config map is owned by another field manager.")
+			return
+		}
+		writeError(w, http.StatusConflict, codeConflict, "The config map was modified concurrently, retry the request.")
+	case errors.Is(err, context.DeadlineExceeded):
+		writeError(w, http.StatusGatewayTimeout, codeTimeout, "The request did not complete within the request timeout.")
+	case errors.Is(err, policy.ErrForbidden):
+		writeError(w, http.StatusInternalServerError, codeRBAC, msg)
+	default:
+		writeError(w, http.StatusInternalServerError, codeConfigMap, msg)
+	}
+}
+
+// isTimeout reports whether reading the request body failed because time ran out.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+}
+
+// writeDecodeError maps a JSON decoding failure of the request body to a client facing error.
+func writeDecodeError(w http.ResponseWriter, err error) {
+	var syntaxError *json.SyntaxError
+	var unmarshalTypeError *json.UnmarshalTypeError
+	var readErr *bodyReadError
+	var formErr *formError
+	switch {
+	case isTimeout(err):
+		msg := "Request body was not received within the request timeout"
+		writeError(w, http.StatusRequestTimeout, codeTimeout, msg)
+	case errors.As(err, &readErr):
+		msg := "Request body is truncated or its transfer encoding is malformed"
+		writeError(w, http.StatusBadRequest, codeJSONError, msg)
+	case errors.As(err, &formErr):
+		writeError(w, http.StatusBadRequest, codeJSONError, formErr.Error())
+	case errors.As(err, &syntaxError):
+		msg := fmt.Sprintf("Request body contains badly-formed JSON (at position %d)", syntaxError.Offset)
+		writeError(w, http.StatusBadRequest, codeJSONError, msg)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		msg := fmt.Sprintf("Request body contains badly-formed JSON")
+		writeError(w, http.StatusBadRequest, codeJSONError, msg)
+	case errors.As(err, &unmarshalTypeError):
+		recordValidationFailure(unmarshalTypeError.Field, reasonWrongType)
+		msg := fmt.Sprintf("Request body contains an invalid value for the %q field (at position %d)", unmarshalTypeError.Field, unmarshalTypeError.Offset)
+		writeError(w, http.StatusBadRequest, codeJSONError, msg)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
+		msg := fmt.Sprintf("Request body contains unknown field %s", fieldName)
+		writeError(w, http.StatusBadRequest, codeJSONError, msg)
+	case errors.Is(err, errTrailingData):
+		msg := "Request body must only contain a single JSON object"
+		writeError(w, http.StatusBadRequest, codeJSONError, msg)
+	case errors.Is(err, io.EOF):
+		msg := "Request body must not be empty"
+		writeError(w, http.StatusBadRequest, codeJSONError, msg)
+	case err.Error() == "http: request body too large":
+		msg := "Request body must not be larger than 1MB"
+		writeError(w, http.StatusRequestEntityTooLarge, codeJSONError, msg)
+	default:
+		log.Println(redactPolicyError(err))
+		writeError(w, http.StatusInternalServerError, codeInternal, http.StatusText(http.StatusInternalServerError))
+	}
+}
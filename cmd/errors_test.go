@@ -0,0 +1,316 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	policy "github.com/filetrust/policy-update-service/pkg"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// useProblemJSON sets PROBLEM_JSON to enabled for the rest of the test.
+func useProblemJSON(t *testing.T, enabled bool) {
+	previous := problemJSON
+	problemJSON = enabled
+	t.Cleanup(func() { problemJSON = previous })
+}
+
+func TestErrorJSONByDefault(t *testing.T) {
+	useProblemJSON(t, false)
+
+	w := serve(newTestHandler(), httptest.NewRequest("GET", policyPath, nil))
+	if contentType := w.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", contentType)
+	}
+
+	var body map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body["code"] != codeUnauthorized || body["message"] == "" || body["type"] != nil {
+		t.Errorf("error = %v, want code and message without problem fields", body)
+	}
+}
+
+func TestProblemJSON(t *testing.T) {
+	useFakeClient(t)
+	useProblemJSON(t, true)
+	handler := newTestHandler()
+
+	tests := []struct {
+		name    string
+		request func() *http.Request
+		status  int
+		code    string
+		title   string
+		detail  string
+		fields  []string
+	}{
+		{
+			name:    "unauthenticated",
+			request: func() *http.Request { return httptest.NewRequest("GET", policyPath, nil) },
+			status:  http.StatusUnauthorized,
+			code:    codeUnauthorized,
+			title:   "Authentication failed",
+		},
+		{
+			name:    "unknown route",
+			request: func() *http.Request { return asAdmin(httptest.NewRequest("GET", "/api/v1/missing", nil)) },
+			status:  http.StatusNotFound,
+			code:    codeNotFound,
+			title:   "Resource not found",
+		},
+		{
+			name: "malformed body",
+			request: func() *http.Request {
+				r := asAdmin(httptest.NewRequest("PUT", policyPath, strings.NewReader(`{"UnprocessableFileTypeAction":`)))
+				r.Header.Set("Content-Type", "application/json")
+				return r
+			},
+			status: http.StatusBadRequest,
+			code:   codeJSONError,
+			title:  "Malformed request body",
+			detail: "Request body contains badly-formed JSON",
+		},
+		{
+			name: "missing fields",
+			request: func() *http.Request {
+				r := asAdmin(httptest.NewRequest("PUT", policyPath, strings.NewReader(`{}`)))
+				r.Header.Set("Content-Type", "application/json")
+				return r
+			},
+			status: http.StatusBadRequest,
+			code:   codeValidation,
+			title:  "Invalid request",
+			detail: "UnprocessableFileTypeAction, GlasswallBlockedFilesAction are required.",
+			fields: []string{"UnprocessableFileTypeAction", "GlasswallBlockedFilesAction"},
+		},
+		{
+			name:    "missing config map",
+			request: func() *http.Request { return asAdmin(httptest.NewRequest("GET", policyPath, nil)) },
+			status:  http.StatusNotFound,
+			code:    codeNotFound,
+			title:   "Resource not found",
+			detail:  "The policy config map does not exist.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(handler, tt.request())
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if contentType := w.Header().Get("Content-Type"); contentType != "application/problem+json" {
+				t.Errorf("Content-Type = %q, want application/problem+json", contentType)
+			}
+
+			var problem problemResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+				t.Fatal(err)
+			}
+			want := problemResponse{Type: problemTypePrefix + tt.code, Title: tt.title, Status: tt.status, Code: tt.code}
+			if problem.Type != want.Type || problem.Title != want.Title || problem.Status != want.Status || problem.Code != want.Code {
+				t.Errorf("problem = %+v, want %+v", problem, want)
+			}
+			if problem.Detail == "" || !strings.HasPrefix(problem.Detail, tt.detail) {
+				t.Errorf("detail = %q, want %q", problem.Detail, tt.detail)
+			}
+			if !slices.Equal(problem.Fields, tt.fields) {
+				t.Errorf("fields = %v, want %v", problem.Fields, tt.fields)
+			}
+		})
+	}
+}
+
+// failConfigMapUpdates makes every config map update of the fake API fail with err.
+func failConfigMapUpdates(t *testing.T, err error) {
+	client := useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`))
+	client.PrependReactor("update", "configmaps", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, err
+	})
+}
+
+func TestErrorCodes(t *testing.T) {
+	const valid = `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":2}`
+	configMaps := schema.GroupResource{Resource: "configmaps"}
+
+	tests := []struct {
+		name    string
+		setup   func(t *testing.T)
+		request func(t *testing.T) *http.Request
+		status  int
+		code    string
+	}{
+		{
+			name:   "malformed body",
+			status: http.StatusBadRequest,
+			code:   codeJSONError,
+			request: func(*testing.T) *http.Request {
+				return policyRequest(`{"UnprocessableFileTypeAction":`)
+			},
+		},
+		{
+			name:   "invalid policy",
+			status: http.StatusBadRequest,
+			code:   codeValidation,
+			request: func(*testing.T) *http.Request {
+				return policyRequest(`{"UnprocessableFileTypeAction":9,"GlasswallBlockedFilesAction":2}`)
+			},
+		},
+		{
+			name:   "wrong content type",
+			status: http.StatusUnsupportedMediaType,
+			code:   codeUnsupportedMediaType,
+			request: func(*testing.T) *http.Request {
+				r := policyRequest(valid)
+				r.Header.Set("Content-Type", "text/plain")
+				return r
+			},
+		},
+		{
+			name:    "unauthenticated",
+			status:  http.StatusUnauthorized,
+			code:    codeUnauthorized,
+			request: func(*testing.T) *http.Request { return httptest.NewRequest("GET", policyPath, nil) },
+		},
+		{
+			name:   "reader writes",
+			status: http.StatusForbidden,
+			code:   codeForbidden,
+			request: func(t *testing.T) *http.Request {
+				r := httptest.NewRequest("PUT", policyPath, strings.NewReader(valid))
+				r.Header.Set("Content-Type", "application/json")
+				r.Header.Set("Authorization", "Bearer "+issueToken(t, "alice"))
+				return r
+			},
+		},
+		{
+			name:    "unknown route",
+			status:  http.StatusNotFound,
+			code:    codeNotFound,
+			request: func(*testing.T) *http.Request { return asAdmin(httptest.NewRequest("GET", "/api/v1/missing", nil)) },
+		},
+		{
+			name:    "unsupported method",
+			status:  http.StatusMethodNotAllowed,
+			code:    codeMethodNotAllowed,
+			request: func(*testing.T) *http.Request { return asAdmin(httptest.NewRequest("DELETE", policyPath, nil)) },
+		},
+		{
+			name:   "no Kubernetes client",
+			status: http.StatusInternalServerError,
+			code:   codeK8sClient,
+			setup: func(t *testing.T) {
+				previous := policy.NewClient
+				policy.NewClient = func() (kubernetes.Interface, error) { return nil, errors.New("no config") }
+				t.Cleanup(func() { policy.NewClient = previous })
+			},
+			request: func(*testing.T) *http.Request { return policyRequest(valid) },
+		},
+		{
+			name:   "update rejected",
+			status: http.StatusInternalServerError,
+			code:   codeConfigMap,
+			setup: func(t *testing.T) {
+				failConfigMapUpdates(t, apierrors.NewBadRequest("rejected"))
+			},
+			request: func(*testing.T) *http.Request { return policyRequest(valid) },
+		},
+		{
+			name:   "update forbidden by RBAC",
+			status: http.StatusInternalServerError,
+			code:   codeRBAC,
+			setup: func(t *testing.T) {
+				failConfigMapUpdates(t, apierrors.NewForbidden(configMaps, configmapName, errors.New("denied")))
+			},
+			request: func(*testing.T) *http.Request { return policyRequest(valid) },
+		},
+		{
+			name:   "concurrent update",
+			status: http.StatusConflict,
+			code:   codeConflict,
+			setup: func(t *testing.T) {
+				// too little time is left to wait for a retry
+				previous := requestTimeout
+				requestTimeout = time.Second
+				t.Cleanup(func() { requestTimeout = previous })
+
+				failConfigMapUpdates(t, apierrors.NewConflict(configMaps, configmapName, errors.New("modified")))
+			},
+			request: func(*testing.T) *http.Request { return policyRequest(valid) },
+		},
+		{
+			name:   "change too soon",
+			status: http.StatusTooManyRequests,
+			code:   codeRateLimited,
+			setup: func(t *testing.T) {
+				useChangeThrottle(t, time.Minute)
+				if w := serve(newTestHandler(), policyRequest(valid)); w.Code != http.StatusOK {
+					t.Fatalf("first PUT = %d %s", w.Code, w.Body)
+				}
+			},
+			request: func(*testing.T) *http.Request {
+				return policyRequest(`{"UnprocessableFileTypeAction":3,"GlasswallBlockedFilesAction":3}`)
+			},
+		},
+		{
+			name:    "frozen",
+			status:  http.StatusLocked,
+			code:    codeFrozen,
+			setup:   func(t *testing.T) { useFreeze(t) },
+			request: func(*testing.T) *http.Request { return policyRequest(valid) },
+		},
+		{
+			name:   "headers too large",
+			status: http.StatusRequestHeaderFieldsTooLarge,
+			code:   codeHeadersTooLarge,
+			request: func(*testing.T) *http.Request {
+				r := asAdmin(httptest.NewRequest("GET", policyPath, nil))
+				for name, value := range manyHeaders(maxHeaderCount + 1) {
+					r.Header.Set(name, value)
+				}
+				return r
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`))
+			if tt.setup != nil {
+				tt.setup(t)
+			}
+
+			w := serve(newTestHandler(), tt.request(t))
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+
+			var body errorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Code != tt.code {
+				t.Errorf("code = %q, want %q", body.Code, tt.code)
+			}
+		})
+	}
+}
+
+// policyRequest returns an admin PUT of body to the policy endpoint.
+func policyRequest(body string) *http.Request {
+	r := asAdmin(httptest.NewRequest("PUT", policyPath, strings.NewReader(body)))
+	r.Header.Set("Content-Type", "application/json")
+	return r
+}
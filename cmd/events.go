@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	policy "github.com/filetrust/policy-update-service/pkg"
+)
+
+var emitK8sEvents = os.Getenv("EMIT_K8S_EVENTS") == "true"
+
+// previousPolicy reads the policy a write is about to replace, for the event recorded
+// after it. It is only read when events are enabled.
+func previousPolicy(ctx context.Context, args policy.PolicyArgs) string {
+	if !emitK8sEvents {
+		return ""
+	}
+
+	previous, err := args.GetPolicy(ctx)
+	if err != nil {
+		loggerFromContext(ctx).Printf("Unable to read policy before update for the event: %v", err)
+	}
+
+	return previous
+}
+
+// recordPolicyEvent records a policy change as an Event on the config map. A failure is
+// logged and otherwise ignored; the change itself has already been made.
+func recordPolicyEvent(args policy.PolicyArgs, reason, actor, previous string) {
+	if !emitK8sEvents {
+		return
+	}
+
+	message := fmt.Sprintf("Policy changed by %s: %s -> %s", actor, redactPolicy(orDash(strings.TrimSpace(previous))), redactPolicy(strings.TrimSpace(args.Policy)))
+
+	err := args.RecordEvent(context.Background(), reason, message)
+	if err != nil {
+		log.Printf("Unable to record %s event on config map %s/%s: %v", reason, args.Namespace, args.ConfigMapName, err)
+	}
+}
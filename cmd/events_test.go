@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// useK8sEvents sets EMIT_K8S_EVENTS to enabled for the rest of the test.
+func useK8sEvents(t *testing.T, enabled bool) {
+	previous := emitK8sEvents
+	emitK8sEvents = enabled
+	t.Cleanup(func() { emitK8sEvents = previous })
+}
+
+func TestPolicyChangeEvent(t *testing.T) {
+	client := useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`))
+	useK8sEvents(t, true)
+
+	if w := putPolicy(newTestHandler(), `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":1}`); w.Code != http.StatusOK {
+		t.Fatalf("PUT status = %d: %s", w.Code, w.Body)
+	}
+
+	events, err := client.CoreV1().Events(namespace).List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events.Items) != 1 {
+		t.Fatalf("got %d events, want 1", len(events.Items))
+	}
+
+	event := events.Items[0]
+	want := `Policy changed by admin (basic auth, no token): {"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1} -> {"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":1}`
+	if event.Message != want {
+		t.Errorf("message = %q, want %q", event.Message, want)
+	}
+	if event.Reason != "PolicyUpdated" || event.Type != corev1.EventTypeNormal {
+		t.Errorf("event %s %s, want a Normal PolicyUpdated event", event.Type, event.Reason)
+	}
+	if object := event.InvolvedObject; object.Kind != "ConfigMap" || object.Namespace != namespace || object.Name != configmapName {
+		t.Errorf("event is about %s %s/%s, want the policy config map", object.Kind, object.Namespace, object.Name)
+	}
+}
+
+func TestPolicyChangeEventFailureIgnored(t *testing.T) {
+	client := useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`))
+	useK8sEvents(t, true)
+	client.PrependReactor("create", "events", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("events are forbidden")
+	})
+
+	if w := putPolicy(newTestHandler(), `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":1}`); w.Code != http.StatusOK {
+		t.Errorf("PUT status = %d, want the update to succeed: %s", w.Code, w.Body)
+	}
+	if doc := storedDocument(t, client); !strings.Contains(doc, `"UnprocessableFileTypeAction":2`) {
+		t.Errorf("stored policy = %s", doc)
+	}
+}
+
+func TestNoPolicyChangeEventByDefault(t *testing.T) {
+	client := useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`))
+	useK8sEvents(t, false)
+
+	putPolicy(newTestHandler(), `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":1}`)
+	for _, action := range client.Actions() {
+		if action.GetResource().Resource == "events" {
+			t.Errorf("unexpected %s of an event", action.GetVerb())
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/slok/go-http-metrics/metrics"
+)
+
+// metricsExemplars attaches the trace ID and request ID of each request as an exemplar
+// to its observation of the request latency histogram, set with METRICS_EXEMPLARS=true.
+// Exemplars are only exported in the OpenMetrics format.
+var metricsExemplars = os.Getenv("METRICS_EXEMPLARS") == "true"
+
+type exemplarKey struct{}
+
+// exemplarMiddleware adds the exemplar labels of a request to its context: trace_id
+// from a W3C traceparent header and request_id from X-Request-ID, when present.
+func exemplarMiddleware(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	labels := prometheus.Labels{}
+	if traceID, ok := traceIDFromParent(r.Header.Get("traceparent")); ok {
+		labels["trace_id"] = traceID
+	}
+	if id := r.Header.Get("X-Request-ID"); id != "" {
+		labels["request_id"] = id
+	}
+
+	// the labels of an exemplar are limited to 128 characters together, and the trace
+	// ID is the one worth keeping
+	if !validExemplar(labels) {
+		delete(labels, "request_id")
+	}
+
+	if len(labels) > 0 {
+		r = r.WithContext(context.WithValue(r.Context(), exemplarKey{}, labels))
+	}
+
+	next(w, r)
+}
+
+// traceIDFromParent returns the trace ID of a version 00 W3C traceparent header,
+// 00-<trace-id>-<parent-id>-<flags>, or false if it has none.
+func traceIDFromParent(traceparent string) (string, bool) {
+	parts := strings.Split(traceparent, "-")
+	if len(parts) != 4 || parts[0] != "00" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return "", false
+	}
+
+	traceID := parts[1]
+	if _, err := hex.DecodeString(traceID); err != nil || traceID != strings.ToLower(traceID) || traceID == strings.Repeat("0", 32) {
+		return "", false
+	}
+
+	return traceID, true
+}
+
+// validExemplar reports whether labels can be attached as an exemplar, which panics
+// for labels that aren't valid UTF-8 or are longer than prometheus.ExemplarMaxRunes.
+func validExemplar(labels prometheus.Labels) bool {
+	runes := 0
+	for name, value := range labels {
+		if !utf8.ValidString(value) {
+			return false
+		}
+		runes += utf8.RuneCountInString(name) + utf8.RuneCountInString(value)
+	}
+
+	return runes <= prometheus.ExemplarMaxRunes
+}
+
+// httpRecorder is the go-http-metrics Prometheus recorder, recording the same metrics,
+// except that it observes request latencies with the exemplar of the request.
+type httpRecorder struct {
+	requestDuration *prometheus.HistogramVec
+	responseSize    *prometheus.HistogramVec
+	inflight        *prometheus.GaugeVec
+}
+
+// newHTTPRecorder creates an httpRecorder registered against reg.
+func newHTTPRecorder(reg prometheus.Registerer) metrics.Recorder {
+	labels := []string{"service", "handler", "method", "code"}
+	r := &httpRecorder{
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "The latency of the HTTP requests.",
+			Buckets: prometheus.DefBuckets,
+		}, labels),
+		responseSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_response_size_bytes",
+			Help:    "The size of the HTTP responses.",
+			Buckets: prometheus.ExponentialBuckets(100, 10, 8),
+		}, labels),
+		inflight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "http_requests_inflight",
+			Help: "The number of inflight requests being handled at the same time.",
+		}, []string{"service", "handler"}),
+	}
+	reg.MustRegister(r.requestDuration, r.responseSize, r.inflight)
+
+	return r
+}
+
+func (r *httpRecorder) ObserveHTTPRequestDuration(ctx context.Context, p metrics.HTTPReqProperties, duration time.Duration) {
+	observer := r.requestDuration.WithLabelValues(p.Service, p.ID, p.Method, p.Code)
+	if labels, ok := ctx.Value(exemplarKey{}).(prometheus.Labels); ok {
+		observer.(prometheus.ExemplarObserver).ObserveWithExemplar(duration.Seconds(), labels)
+		return
+	}
+
+	observer.Observe(duration.Seconds())
+}
+
+func (r *httpRecorder) ObserveHTTPResponseSize(_ context.Context, p metrics.HTTPReqProperties, sizeBytes int64) {
+	r.responseSize.WithLabelValues(p.Service, p.ID, p.Method, p.Code).Observe(float64(sizeBytes))
+}
+
+func (r *httpRecorder) AddInflightRequests(_ context.Context, p metrics.HTTPProperties, quantity int) {
+	r.inflight.WithLabelValues(p.Service, p.ID).Add(float64(quantity))
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/slok/go-http-metrics/middleware"
+	negronimiddleware "github.com/slok/go-http-metrics/middleware/negroni"
+)
+
+const testTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+// useMetricsExemplars sets METRICS_EXEMPLARS for the rest of the test.
+func useMetricsExemplars(t *testing.T, enabled bool) {
+	previous := metricsExemplars
+	metricsExemplars = enabled
+	t.Cleanup(func() { metricsExemplars = previous })
+}
+
+// scrapeWithRequest serves r with request metrics recorded in a registry of their own,
+// and returns the metrics as a scraper asking for OpenMetrics gets them.
+func scrapeWithRequest(t *testing.T, r *http.Request) string {
+	reg := prometheus.NewRegistry()
+	s := &Server{
+		Authenticator: newAuthenticator(),
+		HTTPMetrics: negronimiddleware.Handler("", middleware.New(middleware.Config{
+			Recorder: newHTTPRecorder(reg),
+			Service:  "ncfs-policy-update-service",
+		})),
+	}
+	serve(s.Handler(), r)
+
+	scrape := httptest.NewRequest("GET", "/metrics", nil)
+	scrape.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	w := serve(promhttp.HandlerFor(reg, promhttp.HandlerOpts{EnableOpenMetrics: true}), scrape)
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "application/openmetrics-text") {
+		t.Fatalf("Content-Type = %s, want OpenMetrics", w.Header().Get("Content-Type"))
+	}
+
+	return w.Body.String()
+}
+
+func TestLatencyExemplars(t *testing.T) {
+	useMetricsExemplars(t, true)
+
+	r := asAdmin(httptest.NewRequest("GET", whoamiPath, nil))
+	r.Header.Set("traceparent", "00-"+testTraceID+"-00f067aa0ba902b7-01")
+	r.Header.Set("X-Request-ID", "req-1")
+	metrics := scrapeWithRequest(t, r)
+
+	exemplars := 0
+	for _, line := range strings.Split(metrics, "\n") {
+		_, exemplar, ok := strings.Cut(line, " # {")
+		if !ok {
+			continue
+		}
+		exemplars++
+
+		if !strings.HasPrefix(line, "http_request_duration_seconds_bucket") {
+			t.Errorf("exemplar on %s, want only on the latency histogram", line)
+		}
+		// the order of the labels is not fixed
+		if !strings.Contains(exemplar, `trace_id="`+testTraceID+`"`) || !strings.Contains(exemplar, `request_id="req-1"`) {
+			t.Errorf("exemplar = {%s, want the trace ID and request ID", exemplar)
+		}
+	}
+	if exemplars != 1 {
+		t.Errorf("metrics have %d exemplars, want 1:\n%s", exemplars, metrics)
+	}
+}
+
+func TestLatencyExemplarLabels(t *testing.T) {
+	useMetricsExemplars(t, true)
+
+	tests := []struct {
+		name        string
+		traceparent string
+		requestID   string
+		want        string
+	}{
+		{name: "trace only", traceparent: "00-" + testTraceID + "-00f067aa0ba902b7-01", want: `# {trace_id="` + testTraceID + `"}`},
+		{name: "request ID only", requestID: "req-1", want: `# {request_id="req-1"}`},
+		{name: "request ID too long", traceparent: "00-" + testTraceID + "-00f067aa0ba902b7-01", requestID: strings.Repeat("r", 100), want: `# {trace_id="` + testTraceID + `"}`},
+		{name: "malformed traceparent", traceparent: "00-not-a-trace-01", requestID: "req-1", want: `# {request_id="req-1"}`},
+		{name: "zero trace ID", traceparent: "00-" + strings.Repeat("0", 32) + "-00f067aa0ba902b7-01", requestID: "req-1", want: `# {request_id="req-1"}`},
+		{name: "neither", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := asAdmin(httptest.NewRequest("GET", whoamiPath, nil))
+			if tt.traceparent != "" {
+				r.Header.Set("traceparent", tt.traceparent)
+			}
+			if tt.requestID != "" {
+				r.Header.Set("X-Request-ID", tt.requestID)
+			}
+			metrics := scrapeWithRequest(t, r)
+
+			if tt.want == "" && strings.Contains(metrics, "# {") {
+				t.Errorf("metrics have an exemplar, want none:\n%s", metrics)
+			}
+			if tt.want != "" && !strings.Contains(metrics, tt.want) {
+				t.Errorf("metrics have no exemplar %s:\n%s", tt.want, metrics)
+			}
+		})
+	}
+}
+
+func TestLatencyExemplarsDisabled(t *testing.T) {
+	useMetricsExemplars(t, false)
+
+	r := asAdmin(httptest.NewRequest("GET", whoamiPath, nil))
+	r.Header.Set("traceparent", "00-"+testTraceID+"-00f067aa0ba902b7-01")
+	metrics := scrapeWithRequest(t, r)
+
+	if !strings.Contains(metrics, "http_request_duration_seconds_bucket") {
+		t.Fatalf("metrics have no latency histogram:\n%s", metrics)
+	}
+	if strings.Contains(metrics, "# {") {
+		t.Errorf("metrics have an exemplar without METRICS_EXEMPLARS:\n%s", metrics)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// exportPolicyAs returns the response to an export of the stored policy in format.
+func exportPolicyAs(handler http.Handler, format string) *httptest.ResponseRecorder {
+	return serve(handler, asAdmin(httptest.NewRequest("GET", "/api/v1/policy/export?format="+format, nil)))
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	// as the service writes it
+	const stored = "{\"UnprocessableFileTypeAction\":2,\"GlasswallBlockedFilesAction\":3}\n"
+
+	for _, format := range []string{"", "json", "ncfs"} {
+		t.Run("format="+format, func(t *testing.T) {
+			useFakeClient(t, policyConfigMap(stored))
+			handler := newTestHandler()
+
+			exported := exportPolicyAs(handler, format)
+			if exported.Code != http.StatusOK {
+				t.Fatalf("export = %d %s", exported.Code, exported.Body)
+			}
+			if contentType := exported.Header().Get("Content-Type"); contentType != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", contentType)
+			}
+
+			// importing the export into a config map holding another policy restores it
+			client := useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`))
+			if w := putPolicy(handler, exported.Body.String()); w.Code != http.StatusOK {
+				t.Fatalf("import of %s = %d %s", exported.Body, w.Code, w.Body)
+			}
+			if doc := storedDocument(t, client); doc != stored {
+				t.Errorf("stored policy after the round trip = %s, want %s", doc, stored)
+			}
+
+			if again := exportPolicyAs(handler, format); again.Body.String() != exported.Body.String() {
+				t.Errorf("export after the round trip = %s, want %s", again.Body, exported.Body)
+			}
+		})
+	}
+}
+
+func TestExportNCFSIsStoredDocument(t *testing.T) {
+	const stored = `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":3}`
+	useFakeClient(t, policyConfigMap(stored))
+
+	w := exportPolicyAs(newTestHandler(), "ncfs")
+	if w.Body.String() != stored {
+		t.Errorf("ncfs export = %s, want the stored document %s", w.Body, stored)
+	}
+	if disposition := w.Header().Get("Content-Disposition"); disposition != `attachment; filename="appsettings.json"` {
+		t.Errorf("Content-Disposition = %q", disposition)
+	}
+}
+
+func TestExportUnknownFormat(t *testing.T) {
+	useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":3}`))
+
+	if w := exportPolicyAs(newTestHandler(), "yaml"); w.Code != http.StatusBadRequest {
+		t.Errorf("export as yaml = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const (
+	fieldCasePascal = "pascal"
+	fieldCaseCamel  = "camel"
+)
+
+// jsonFieldCase selects the field names of policies in API responses. Requests are
+// accepted in either case, since JSON field names are matched case-insensitively, and
+// the config map always holds the PascalCase document NCFS reads.
+var jsonFieldCase = os.Getenv("JSON_FIELD_CASE")
+
+type camelCasePolicy struct {
+	UnprocessableFileTypeAction *ActionValue `json:"unprocessableFileTypeAction"`
+	GlasswallBlockedFilesAction *ActionValue `json:"glasswallBlockedFilesAction"`
+}
+
+func setupFieldCase() error {
+	if jsonFieldCase == "" {
+		jsonFieldCase = fieldCasePascal
+	}
+
+	if jsonFieldCase != fieldCasePascal && jsonFieldCase != fieldCaseCamel {
+		return fmt.Errorf("JSON_FIELD_CASE must be one of %s, %s", fieldCasePascal, fieldCaseCamel)
+	}
+
+	return nil
+}
+
+// policyView returns p as it should be encoded in an API response.
+func policyView(p Policy) interface{} {
+	if jsonFieldCase == fieldCaseCamel {
+		return camelCasePolicy(p)
+	}
+
+	return p
+}
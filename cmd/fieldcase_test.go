@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// useFieldCase sets JSON_FIELD_CASE to fieldCase for the rest of the test.
+func useFieldCase(t *testing.T, fieldCase string) {
+	previous := jsonFieldCase
+	jsonFieldCase = fieldCase
+	t.Cleanup(func() { jsonFieldCase = previous })
+}
+
+func TestPutAcceptsEitherCase(t *testing.T) {
+	const want = "{\"UnprocessableFileTypeAction\":2,\"GlasswallBlockedFilesAction\":3}\n"
+	useUnknownFields(t, unknownFieldsReject)
+
+	bodies := map[string]string{
+		"pascal": `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":3}`,
+		"camel":  `{"unprocessableFileTypeAction":2,"glasswallBlockedFilesAction":3}`,
+		"mixed":  `{"unprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":3}`,
+	}
+
+	for _, fieldCase := range []string{fieldCasePascal, fieldCaseCamel} {
+		useFieldCase(t, fieldCase)
+		for name, body := range bodies {
+			client := useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`))
+
+			if w := putPolicy(newTestHandler(), body); w.Code != http.StatusOK {
+				t.Errorf("%s response, %s request: PUT = %d %s", fieldCase, name, w.Code, w.Body)
+				continue
+			}
+			// NCFS reads the PascalCase document whatever the API speaks
+			if doc := storedDocument(t, client); doc != want {
+				t.Errorf("%s response, %s request: stored policy = %s, want %s", fieldCase, name, doc, want)
+			}
+		}
+	}
+}
+
+func TestResponseFieldCase(t *testing.T) {
+	useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":3}`))
+
+	tests := map[string]map[string]int{
+		fieldCasePascal: {"UnprocessableFileTypeAction": 2, "GlasswallBlockedFilesAction": 3},
+		fieldCaseCamel:  {"unprocessableFileTypeAction": 2, "glasswallBlockedFilesAction": 3},
+	}
+
+	for fieldCase, want := range tests {
+		useFieldCase(t, fieldCase)
+
+		w := serve(newTestHandler(), asAdmin(httptest.NewRequest("GET", policyPath, nil)))
+		var resp struct {
+			Data map[string]int `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(resp.Data, want) {
+			t.Errorf("JSON_FIELD_CASE=%s: policy = %v, want %v", fieldCase, resp.Data, want)
+		}
+	}
+}
+
+func TestFieldCaseSetting(t *testing.T) {
+	useFieldCase(t, "")
+	if err := setupFieldCase(); err != nil || jsonFieldCase != fieldCasePascal {
+		t.Errorf("default JSON_FIELD_CASE = %q, %v, want %s", jsonFieldCase, err, fieldCasePascal)
+	}
+
+	jsonFieldCase = "snake"
+	if err := setupFieldCase(); err == nil {
+		t.Error("JSON_FIELD_CASE=snake accepted")
+	}
+}
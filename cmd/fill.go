@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	policy "github.com/filetrust/policy-update-service/pkg"
+)
+
+// fillMissingFromCurrent lets a PUT omit some of the policy fields, which then keep
+// their stored values, so a client can change one action without sending both.
+var fillMissingFromCurrent = os.Getenv("FILL_MISSING_FROM_CURRENT") == "true"
+
+// partiallyMissing reports whether p is missing some, but not all, of its fields. A
+// policy missing every field is still rejected, so an empty PUT can't pass as a no-op.
+func partiallyMissing(p Policy) bool {
+	missing := 0
+	for _, field := range actionFields(p) {
+		if field.value == nil {
+			missing++
+		}
+	}
+
+	return missing > 0 && missing < len(actionFields(p))
+}
+
+// fillFromStored completes p with the stored value of each field it is missing and
+// validates the result. A field that isn't stored either is still reported as
+// missing. It also returns a precondition that fails the write if a filled field no
+// longer holds the value read, so a concurrent change to it isn't overwritten. When it
+// fails it writes the error response and returns false.
+func fillFromStored(w http.ResponseWriter, r *http.Request, p Policy) (Policy, func(string) error, bool) {
+	args := policy.PolicyArgs{
+		Namespace:     namespace,
+		ConfigMapName: configmapName,
+		PolicyKeys:    policyKeys,
+	}
+
+	err := args.GetClient()
+	if err != nil {
+		loggerFromContext(r.Context()).Printf("Unable to get client: %v", err)
+		writeError(w, http.StatusInternalServerError, codeK8sClient, "Something went wrong getting K8 Client.")
+		return p, nil, false
+	}
+
+	current, err := args.GetPolicy(r.Context())
+	if err != nil && !errors.Is(err, policy.ErrNotFound) {
+		loggerFromContext(r.Context()).Printf("Unable to read policy: %v", err)
+		writeConfigMapError(w, err, "Something went wrong when reading the config map.")
+		return p, nil, false
+	}
+
+	var stored Policy
+	if current != "" {
+		var ok bool
+		if stored, ok = parseStoredPolicy(w, current); !ok {
+			return p, nil, false
+		}
+	}
+
+	var filled []actionField
+	if p.UnprocessableFileTypeAction == nil {
+		p.UnprocessableFileTypeAction = stored.UnprocessableFileTypeAction
+		filled = append(filled, actionField{"UnprocessableFileTypeAction", stored.UnprocessableFileTypeAction})
+	}
+	if p.GlasswallBlockedFilesAction == nil {
+		p.GlasswallBlockedFilesAction = stored.GlasswallBlockedFilesAction
+		filled = append(filled, actionField{"GlasswallBlockedFilesAction", stored.GlasswallBlockedFilesAction})
+	}
+
+	err = checkPolicy(p)
+	traceDecodedPolicy(r, p, err)
+	if err != nil {
+		writePolicyError(w, r, err)
+		return p, nil, false
+	}
+
+	return p, filledUnchanged(filled), true
+}
+
+// filledUnchanged returns a precondition that the stored policy still holds the value
+// of each filled field.
+func filledUnchanged(filled []actionField) func(string) error {
+	return func(current string) error {
+		var stored Policy
+		if current != "" {
+			var err error
+			if stored, err = decodeStoredPolicy(current); err != nil {
+				return errors.New("Stored policy is not valid JSON.")
+			}
+		}
+
+		storedFields := map[string]*ActionValue{}
+		for _, field := range actionFields(stored) {
+			storedFields[field.name] = field.value
+		}
+
+		for _, field := range filled {
+			if value := storedFields[field.name]; value == nil || *value != *field.value {
+				return fmt.Errorf("%s changed while it was filled from the stored policy, retry the update.", field.name)
+			}
+		}
+
+		return nil
+	}
+}
+
+// allPreconditions returns a precondition that passes when every non-nil one does.
+func allPreconditions(preconditions ...func(string) error) func(string) error {
+	var set []func(string) error
+	for _, precondition := range preconditions {
+		if precondition != nil {
+			set = append(set, precondition)
+		}
+	}
+	if len(set) == 0 {
+		return nil
+	}
+
+	return func(current string) error {
+		for _, precondition := range set {
+			if err := precondition(current); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
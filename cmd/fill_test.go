@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// useFillMissing sets FILL_MISSING_FROM_CURRENT to enabled for the rest of the test.
+func useFillMissing(t *testing.T, enabled bool) {
+	previous := fillMissingFromCurrent
+	fillMissingFromCurrent = enabled
+	t.Cleanup(func() { fillMissingFromCurrent = previous })
+}
+
+func putPolicy(handler http.Handler, body string) *httptest.ResponseRecorder {
+	r := asAdmin(httptest.NewRequest("PUT", policyPath, strings.NewReader(body)))
+	r.Header.Set("Content-Type", "application/json")
+	return serve(handler, r)
+}
+
+func TestPutOmittingFieldWithoutFill(t *testing.T) {
+	client := useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`))
+	useFillMissing(t, false)
+
+	w := putPolicy(newTestHandler(), `{"GlasswallBlockedFilesAction":3}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "UnprocessableFileTypeAction") {
+		t.Errorf("PUT = %d %s, want 400 naming UnprocessableFileTypeAction", w.Code, w.Body)
+	}
+	if doc := storedDocument(t, client); !strings.Contains(doc, `"GlasswallBlockedFilesAction":1`) {
+		t.Errorf("stored policy changed to %s", doc)
+	}
+}
+
+func TestPutOmittingFieldWithFill(t *testing.T) {
+	client := useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":1}`))
+	useFillMissing(t, true)
+	missing := svcMetrics.validationFailures.WithLabelValues("UnprocessableFileTypeAction", reasonMissing)
+	before := testutil.ToFloat64(missing)
+
+	w := putPolicy(newTestHandler(), `{"GlasswallBlockedFilesAction":3}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT status = %d: %s", w.Code, w.Body)
+	}
+
+	doc := storedDocument(t, client)
+	if !strings.Contains(doc, `"UnprocessableFileTypeAction":2`) || !strings.Contains(doc, `"GlasswallBlockedFilesAction":3`) {
+		t.Errorf("stored policy = %s, want the omitted field kept", doc)
+	}
+	if after := testutil.ToFloat64(missing); after != before {
+		t.Errorf("a filled field was counted as a missing field validation failure")
+	}
+}
+
+func TestPutWithFillRejected(t *testing.T) {
+	useFillMissing(t, true)
+
+	tests := []struct {
+		name   string
+		stored string
+		body   string
+	}{
+		{name: "every field missing", stored: `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":1}`, body: `{}`},
+		{name: "field not stored", stored: `{"GlasswallBlockedFilesAction":1}`, body: `{"GlasswallBlockedFilesAction":3}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFakeClient(t, policyConfigMap(tt.stored))
+
+			if w := putPolicy(newTestHandler(), tt.body); w.Code != http.StatusBadRequest {
+				t.Errorf("PUT status = %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body)
+			}
+		})
+	}
+}
+
+func TestPutWithFillConcurrentChange(t *testing.T) {
+	client := useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":1}`))
+	useFillMissing(t, true)
+
+	// another writer changes the filled field right after the PUT has read it
+	gets := 0
+	client.PrependReactor("get", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if gets++; gets == 2 {
+			changed := policyConfigMap(`{"UnprocessableFileTypeAction":4,"GlasswallBlockedFilesAction":1}`)
+			if err := client.Tracker().Update(corev1.SchemeGroupVersion.WithResource("configmaps"), changed, namespace); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return false, nil, nil
+	})
+
+	w := putPolicy(newTestHandler(), `{"GlasswallBlockedFilesAction":3}`)
+	if w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("PUT status = %d, want %d: %s", w.Code, http.StatusPreconditionFailed, w.Body)
+	}
+	if doc := storedDocument(t, client); !strings.Contains(doc, `"UnprocessableFileTypeAction":4`) {
+		t.Errorf("concurrent change overwritten, stored policy = %s", doc)
+	}
+}
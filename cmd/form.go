@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+)
+
+const formContentType = "application/x-www-form-urlencoded"
+
+// acceptFormEncoded lets PUT /api/v1/policy take the policy as a form as well as JSON.
+var acceptFormEncoded = os.Getenv("ACCEPT_FORM_ENCODED") == "true"
+
+// formError is a form body that can't be turned into a policy document.
+type formError struct {
+	msg string
+}
+
+func (e *formError) Error() string {
+	return e.msg
+}
+
+// formPolicyDocument turns a form-encoded policy into the equivalent JSON document, so
+// it goes through decodePolicy like a JSON body: the same field matching, unknown
+// field handling and validation. Integer values become numbers; anything else stays
+// a string and is rejected as the wrong type.
+func formPolicyDocument(r io.Reader) (string, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+
+	form, err := url.ParseQuery(string(b))
+	if err != nil {
+		return "", &formError{msg: "Request body is not valid form data"}
+	}
+
+	fields := map[string]interface{}{}
+	for name, values := range form {
+		if len(values) > 1 {
+			return "", &formError{msg: fmt.Sprintf("Request body contains field %q more than once", name)}
+		}
+
+		if i, err := strconv.Atoi(values[0]); err == nil {
+			fields[name] = i
+		} else {
+			fields[name] = values[0]
+		}
+	}
+
+	doc, err := json.Marshal(fields)
+	return string(doc), err
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// useFormEncoded sets ACCEPT_FORM_ENCODED to accept for the rest of the test.
+func useFormEncoded(t *testing.T, accept bool) {
+	previous := acceptFormEncoded
+	acceptFormEncoded = accept
+	t.Cleanup(func() { acceptFormEncoded = previous })
+}
+
+// putPolicyForm sends body to the policy endpoint as a form.
+func putPolicyForm(handler http.Handler, body string) *httptest.ResponseRecorder {
+	r := asAdmin(httptest.NewRequest("PUT", policyPath, strings.NewReader(body)))
+	r.Header.Set("Content-Type", formContentType)
+	return serve(handler, r)
+}
+
+func TestPutPolicyForm(t *testing.T) {
+	client := useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`))
+	useFormEncoded(t, true)
+
+	w := putPolicyForm(newTestHandler(), "UnprocessableFileTypeAction=2&GlasswallBlockedFilesAction=3")
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT = %d %s, want %d", w.Code, w.Body, http.StatusOK)
+	}
+
+	doc := storedDocument(t, client)
+	if !strings.Contains(doc, `"UnprocessableFileTypeAction":2`) || !strings.Contains(doc, `"GlasswallBlockedFilesAction":3`) {
+		t.Errorf("stored policy = %s, want the form values", doc)
+	}
+}
+
+func TestPutPolicyFormRejected(t *testing.T) {
+	const stored = `{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`
+	useFormEncoded(t, true)
+	useUnknownFields(t, unknownFieldsReject)
+
+	bodies := map[string]string{
+		"out of range":     "UnprocessableFileTypeAction=9&GlasswallBlockedFilesAction=1",
+		"not a number":     "UnprocessableFileTypeAction=block&GlasswallBlockedFilesAction=1",
+		"unknown field":    "UnprocessableFileTypeAction=2&GlasswallBlockedFilesAction=2&Future=1",
+		"repeated field":   "UnprocessableFileTypeAction=2&UnprocessableFileTypeAction=3&GlasswallBlockedFilesAction=1",
+		"invalid encoding": "UnprocessableFileTypeAction=%zz",
+	}
+
+	for name, body := range bodies {
+		client := useFakeClient(t, policyConfigMap(stored))
+
+		w := putPolicyForm(newTestHandler(), body)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: PUT = %d %s, want %d", name, w.Code, w.Body, http.StatusBadRequest)
+		}
+		if doc := storedDocument(t, client); doc != stored {
+			t.Errorf("%s: stored policy changed to %s", name, doc)
+		}
+	}
+}
+
+func TestPutPolicyFormDisabled(t *testing.T) {
+	const stored = `{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`
+	client := useFakeClient(t, policyConfigMap(stored))
+	useFormEncoded(t, false)
+
+	w := putPolicyForm(newTestHandler(), "UnprocessableFileTypeAction=2&GlasswallBlockedFilesAction=3")
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("PUT = %d %s, want %d", w.Code, w.Body, http.StatusUnsupportedMediaType)
+	}
+	if doc := storedDocument(t, client); doc != stored {
+		t.Errorf("stored policy changed to %s", doc)
+	}
+}
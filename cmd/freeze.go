@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy freeze windows are periods during which policy changes are rejected unless an
+// admin overrides the freeze. POLICY_FREEZE_WINDOWS is a ;-separated list of windows,
+// each either weekly, e.g. "Mon-Fri 09:00-17:00" or "Sat,Sun 00:00-24:00", in
+// FREEZE_TIMEZONE, or a fixed RFC 3339 range, e.g. "2026-12-20T00:00:00Z/2027-01-04T00:00:00Z".
+var (
+	freezeWindowsConfig = os.Getenv("POLICY_FREEZE_WINDOWS")
+	freezeTimezone      = os.Getenv("FREEZE_TIMEZONE")
+	freezeAdminsConfig  = os.Getenv("FREEZE_ADMINS")
+
+	freezeWindows  []freezeWindow
+	freezeLocation = time.UTC
+	freezeAdmins   = map[string]bool{}
+)
+
+// freezeOverrideHeader carries the reason an admin gives for changing the policy during
+// a freeze.
+const freezeOverrideHeader = "X-Freeze-Override"
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// freezeWindow is either a fixed range from start to end, or a weekly range from
+// from to to, as offsets into each day in days. A weekly range whose end is not after
+// its start runs past midnight into the next day.
+type freezeWindow struct {
+	start, end time.Time
+
+	days     [7]bool
+	from, to time.Duration
+}
+
+func setupFreezeWindows() error {
+	if freezeWindowsConfig == "" {
+		return nil
+	}
+
+	if freezeTimezone != "" {
+		loc, err := time.LoadLocation(freezeTimezone)
+		if err != nil {
+			return fmt.Errorf("FREEZE_TIMEZONE is not a known time zone: %v", err)
+		}
+		freezeLocation = loc
+	}
+
+	for _, spec := range strings.Split(freezeWindowsConfig, ";") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		window, err := parseFreezeWindow(spec)
+		if err != nil {
+			return fmt.Errorf("POLICY_FREEZE_WINDOWS: %q %v", spec, err)
+		}
+		freezeWindows = append(freezeWindows, window)
+	}
+
+	for _, admin := range strings.Split(freezeAdminsConfig, ",") {
+		if admin = strings.TrimSpace(admin); admin != "" {
+			freezeAdmins[admin] = true
+		}
+	}
+
+	log.Printf("%d policy freeze windows configured in %s, %d freeze admins", len(freezeWindows), freezeLocation, len(freezeAdmins))
+	return nil
+}
+
+func parseFreezeWindow(spec string) (freezeWindow, error) {
+	if parts := strings.Split(spec, "/"); len(parts) == 2 {
+		start, err := time.Parse(time.RFC3339, parts[0])
+		if err != nil {
+			return freezeWindow{}, fmt.Errorf("has an invalid start: %v", err)
+		}
+
+		end, err := time.Parse(time.RFC3339, parts[1])
+		if err != nil {
+			return freezeWindow{}, fmt.Errorf("has an invalid end: %v", err)
+		}
+
+		if !end.After(start) {
+			return freezeWindow{}, fmt.Errorf("ends before it starts")
+		}
+
+		return freezeWindow{start: start, end: end}, nil
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 2 {
+		return freezeWindow{}, fmt.Errorf("is neither \"<days> HH:MM-HH:MM\" nor \"<start>/<end>\"")
+	}
+
+	var window freezeWindow
+	for _, days := range strings.Split(fields[0], ",") {
+		bounds := strings.SplitN(days, "-", 2)
+		first, ok := weekdays[strings.ToLower(bounds[0])]
+		if !ok {
+			return freezeWindow{}, fmt.Errorf("has an unknown day %q", bounds[0])
+		}
+
+		last := first
+		if len(bounds) == 2 {
+			if last, ok = weekdays[strings.ToLower(bounds[1])]; !ok {
+				return freezeWindow{}, fmt.Errorf("has an unknown day %q", bounds[1])
+			}
+		}
+
+		for d := first; ; d = (d + 1) % 7 {
+			window.days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+
+	times := strings.SplitN(fields[1], "-", 2)
+	if len(times) != 2 {
+		return freezeWindow{}, fmt.Errorf("has no HH:MM-HH:MM time range")
+	}
+
+	var err error
+	if window.from, err = parseTimeOfDay(times[0]); err != nil {
+		return freezeWindow{}, err
+	}
+	if window.to, err = parseTimeOfDay(times[1]); err != nil {
+		return freezeWindow{}, err
+	}
+
+	return window, nil
+}
+
+// parseTimeOfDay parses HH:MM, allowing 24:00 for the end of the day.
+func parseTimeOfDay(value string) (time.Duration, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) == 2 && len(parts[0]) == 2 && len(parts[1]) == 2 {
+		h, herr := strconv.Atoi(parts[0])
+		m, merr := strconv.Atoi(parts[1])
+		if herr == nil && merr == nil && m >= 0 && m < 60 && h >= 0 && (h < 24 || h == 24 && m == 0) {
+			return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+		}
+	}
+
+	return 0, fmt.Errorf("has an invalid time %q, expected HH:MM", value)
+}
+
+// activeUntil reports whether now is in the window and, if so, when the window ends.
+func (fw freezeWindow) activeUntil(now time.Time) (time.Time, bool) {
+	if !fw.start.IsZero() {
+		return fw.end, !now.Before(fw.start) && now.Before(fw.end)
+	}
+
+	t := now.In(freezeLocation)
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, freezeLocation)
+	offset := t.Sub(midnight)
+	today := t.Weekday()
+	yesterday := (today + 6) % 7
+
+	if fw.from < fw.to {
+		return midnight.Add(fw.to), fw.days[today] && offset >= fw.from && offset < fw.to
+	}
+
+	switch {
+	case fw.days[today] && offset >= fw.from:
+		return midnight.AddDate(0, 0, 1).Add(fw.to), true
+	case fw.days[yesterday] && offset < fw.to:
+		return midnight.Add(fw.to), true
+	default:
+		return time.Time{}, false
+	}
+}
+
+// policyFrozenUntil returns the end of the latest freeze window now is in, or false when
+// policy changes are not frozen.
+func policyFrozenUntil(now time.Time) (time.Time, bool) {
+	var until time.Time
+	frozen := false
+	for _, window := range freezeWindows {
+		if end, ok := window.activeUntil(now); ok {
+			frozen = true
+			if end.After(until) {
+				until = end
+			}
+		}
+	}
+
+	return until, frozen
+}
+
+// isFreezeAdmin reports whether the user of r, or one of its groups, prefixed with
+// "group:", is listed in FREEZE_ADMINS. Service tokens are never freeze admins.
+func isFreezeAdmin(r *http.Request) bool {
+	id, _ := r.Context().Value(identityKey{}).(identity)
+	if id.info == nil || isServiceTokenUser(r) {
+		return false
+	}
+
+	if freezeAdmins[id.info.UserName()] {
+		return true
+	}
+
+	for _, group := range id.info.Groups() {
+		if freezeAdmins["group:"+group] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkFreeze rejects a policy change during a freeze window with 423, writing the error
+// response, unless a freeze admin overrides it with a reason in X-Freeze-Override.
+func checkFreeze(w http.ResponseWriter, r *http.Request) bool {
+	until, frozen := policyFrozenUntil(time.Now())
+	if !frozen {
+		return true
+	}
+
+	reason := strings.TrimSpace(r.Header.Get(freezeOverrideHeader))
+	if reason != "" {
+		if isFreezeAdmin(r) {
+			loggerFromContext(r.Context()).Printf("Policy freeze until %s overridden by %s: %s", until.Format(time.RFC3339), requestActor(r), reason)
+			recordAudit(requestUser(r), "freeze.overridden", fmt.Sprintf("Policy freeze until %s overridden", until.Format(time.RFC3339)), reason)
+			return true
+		}
+
+		loggerFromContext(r.Context()).Printf("Policy freeze override by %s rejected, not a freeze admin", requestActor(r))
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(until).Seconds()))))
+	writeError(w, http.StatusLocked, codeFrozen, fmt.Sprintf("Policy changes are frozen until %s.", until.In(freezeLocation).Format(time.RFC3339)))
+	return false
+}
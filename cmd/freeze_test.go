@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useFreeze freezes policy changes for the next hour for the rest of the test, with
+// admins as the freeze admins.
+func useFreeze(t *testing.T, admins ...string) {
+	previousWindows, previousAdmins := freezeWindows, freezeAdmins
+	now := time.Now()
+	freezeWindows = []freezeWindow{{start: now.Add(-time.Hour), end: now.Add(time.Hour)}}
+	freezeAdmins = map[string]bool{}
+	for _, admin := range admins {
+		freezeAdmins[admin] = true
+	}
+	t.Cleanup(func() { freezeWindows, freezeAdmins = previousWindows, previousAdmins })
+}
+
+func TestFreezeWindowActive(t *testing.T) {
+	// 2026-01-05 is a Monday
+	monday := func(hour, minute int) time.Time {
+		return time.Date(2026, 1, 5, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name      string
+		spec      string
+		now       time.Time
+		active    bool
+		wantUntil time.Time
+	}{
+		{name: "in business hours", spec: "Mon-Fri 09:00-17:00", now: monday(12, 0), active: true, wantUntil: monday(17, 0)},
+		{name: "end is exclusive", spec: "Mon-Fri 09:00-17:00", now: monday(17, 0)},
+		{name: "other day", spec: "Sat,Sun 00:00-24:00", now: monday(12, 0)},
+		{name: "overnight before midnight", spec: "Mon 22:00-06:00", now: monday(23, 0), active: true, wantUntil: monday(30, 0)},
+		{name: "overnight after midnight", spec: "Sun 22:00-06:00", now: monday(5, 0), active: true, wantUntil: monday(6, 0)},
+		{name: "in fixed range", spec: "2026-01-01T00:00:00Z/2026-01-10T00:00:00Z", now: monday(12, 0), active: true, wantUntil: time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC)},
+		{name: "after fixed range", spec: "2025-12-20T00:00:00Z/2026-01-04T00:00:00Z", now: monday(12, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			window, err := parseFreezeWindow(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			until, active := window.activeUntil(tt.now)
+			if active != tt.active || (active && !until.Equal(tt.wantUntil)) {
+				t.Errorf("activeUntil() = %v, %v, want %v, %v", until, active, tt.wantUntil, tt.active)
+			}
+		})
+	}
+}
+
+func TestFreezeRejectsChanges(t *testing.T) {
+	doc := `{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`
+	client := useFakeClient(t, policyConfigMap(doc))
+	useFreeze(t, username)
+	handler := newTestHandler()
+
+	w := putPolicy(handler, `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":2}`)
+	if w.Code != http.StatusLocked || !strings.Contains(w.Body.String(), `"code":"frozen"`) {
+		t.Fatalf("PUT during a freeze = %d %s, want 423 frozen", w.Code, w.Body)
+	}
+	if seconds, err := strconv.Atoi(w.Header().Get("Retry-After")); err != nil || seconds <= 0 || seconds > 3600 {
+		t.Errorf("Retry-After = %q, want the seconds until the freeze ends", w.Header().Get("Retry-After"))
+	}
+	if got := storedDocument(t, client); got != doc {
+		t.Errorf("stored policy = %s, want it unchanged", got)
+	}
+
+	// reads stay allowed
+	if w := serve(handler, asAdmin(httptest.NewRequest("GET", policyPath, nil))); w.Code != http.StatusOK {
+		t.Errorf("GET during a freeze = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestFreezeOverride(t *testing.T) {
+	tests := []struct {
+		name   string
+		admins []string
+		reason string
+		want   int
+	}{
+		{name: "freeze admin with a reason", admins: []string{username}, reason: "incident 42", want: http.StatusOK},
+		{name: "freeze admin by group", admins: []string{"group:" + roleAdmin}, reason: "incident 42", want: http.StatusOK},
+		{name: "freeze admin without a reason", admins: []string{username}, want: http.StatusLocked},
+		{name: "not a freeze admin", admins: []string{"someone-else"}, reason: "incident 42", want: http.StatusLocked},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`))
+			useFreeze(t, tt.admins...)
+			audit := useAuditLog(t, 10)
+
+			r := asAdmin(httptest.NewRequest("PUT", policyPath, strings.NewReader(`{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":2}`)))
+			r.Header.Set("Content-Type", "application/json")
+			if tt.reason != "" {
+				r.Header.Set(freezeOverrideHeader, tt.reason)
+			}
+
+			w := serve(newTestHandler(), r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+
+			overridden := false
+			for _, entry := range audit.list(func(auditEntry) bool { return true }) {
+				if entry.Action == "freeze.overridden" && entry.Reason == tt.reason {
+					overridden = true
+				}
+			}
+			if overridden != (tt.want == http.StatusOK) {
+				t.Errorf("override audited = %v, want %v", overridden, tt.want == http.StatusOK)
+			}
+		})
+	}
+}
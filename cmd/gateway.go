@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/shaj13/go-guardian/auth"
+)
+
+// trustGatewayIdentity accepts the user named by an upstream gateway that has already
+// authenticated it, for deployments where the gateway or mesh owns authentication.
+// The identity headers are only believed on connections from TRUSTED_PROXY_CIDRS;
+// anyone else could set them.
+var trustGatewayIdentity = os.Getenv("TRUST_GATEWAY_IDENTITY") == "true"
+
+const gatewayStrategyKey = auth.StrategyKey("gateway")
+
+// gatewayExtension marks users whose identity came from the gateway headers.
+const gatewayExtension = "gateway"
+
+var (
+	trustedProxies     []*net.IPNet
+	gatewayUserHeader  = "X-Authenticated-User"
+	gatewayRolesHeader = "X-Authenticated-Roles"
+)
+
+var errUntrustedGateway = errors.New("Gateway identity not trusted")
+
+func setupGatewayIdentity() error {
+	cidrs := strings.TrimSpace(os.Getenv("TRUSTED_PROXY_CIDRS"))
+	for _, cidr := range strings.Split(cidrs, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf("TRUSTED_PROXY_CIDRS contains an invalid CIDR %q", cidr)
+		}
+		trustedProxies = append(trustedProxies, network)
+	}
+
+	if !trustGatewayIdentity {
+		return nil
+	}
+
+	if len(trustedProxies) == 0 {
+		return errors.New("TRUST_GATEWAY_IDENTITY requires TRUSTED_PROXY_CIDRS")
+	}
+
+	if header := strings.TrimSpace(os.Getenv("GATEWAY_USER_HEADER")); header != "" {
+		gatewayUserHeader = header
+	}
+	if header := strings.TrimSpace(os.Getenv("GATEWAY_ROLES_HEADER")); header != "" {
+		gatewayRolesHeader = header
+	}
+
+	log.Printf("Trusting %s and %s from proxies in %s", gatewayUserHeader, gatewayRolesHeader, cidrs)
+	return nil
+}
+
+// fromTrustedProxy reports whether the connection of r comes from a trusted proxy. Only
+// the peer address counts; forwarding headers can be set by anyone.
+func fromTrustedProxy(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// gatewayStrategy authenticates requests by the user and roles headers of a trusted
+// proxy. Roles are a comma-separated list and become the user's groups.
+type gatewayStrategy struct{}
+
+func (gatewayStrategy) Authenticate(ctx context.Context, r *http.Request) (auth.Info, error) {
+	user := strings.TrimSpace(r.Header.Get(gatewayUserHeader))
+	if user == "" || !fromTrustedProxy(r) {
+		return nil, errUntrustedGateway
+	}
+
+	var roles []string
+	for _, role := range strings.Split(r.Header.Get(gatewayRolesHeader), ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			roles = append(roles, role)
+		}
+	}
+
+	return auth.NewDefaultUser(user, "", roles, map[string][]string{gatewayExtension: {"true"}}), nil
+}
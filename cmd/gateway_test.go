@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// useGatewayIdentity sets TRUST_GATEWAY_IDENTITY to enabled with cidrs as the
+// TRUSTED_PROXY_CIDRS for the rest of the test.
+func useGatewayIdentity(t *testing.T, enabled bool, cidrs string) {
+	t.Setenv("TRUSTED_PROXY_CIDRS", cidrs)
+	previous, previousProxies := trustGatewayIdentity, trustedProxies
+	trustGatewayIdentity, trustedProxies = enabled, nil
+	t.Cleanup(func() { trustGatewayIdentity, trustedProxies = previous, previousProxies })
+
+	if err := setupGatewayIdentity(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// whoamiOf returns the status of a whoami request r and the identity it reports.
+func whoamiOf(t *testing.T, r *http.Request) (int, whoamiResponse) {
+	w := serve(newTestHandler(), r)
+
+	var resp struct {
+		Data whoamiResponse `json:"data"`
+	}
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return w.Code, resp.Data
+}
+
+// gatewayRequest returns a whoami request from peer with the gateway identity headers.
+func gatewayRequest(peer string) *http.Request {
+	r := httptest.NewRequest("GET", whoamiPath, nil)
+	r.RemoteAddr = peer
+	r.Header.Set("X-Authenticated-User", "alice")
+	r.Header.Set("X-Authenticated-Roles", "policy-reader, policy-writer")
+	return r
+}
+
+func TestGatewayIdentityFromTrustedProxy(t *testing.T) {
+	useGatewayIdentity(t, true, "10.0.0.0/8, fd00::/8")
+
+	for _, peer := range []string{"10.1.2.3:41000", "[fd00::1]:41000"} {
+		status, identity := whoamiOf(t, gatewayRequest(peer))
+		if status != http.StatusOK {
+			t.Fatalf("whoami from %s = %d, want %d", peer, status, http.StatusOK)
+		}
+
+		want := whoamiResponse{User: "alice", Groups: []string{"policy-reader", "policy-writer"}, Strategy: strategyGateway}
+		if !reflect.DeepEqual(identity, want) {
+			t.Errorf("whoami from %s = %+v, want %+v", peer, identity, want)
+		}
+	}
+}
+
+func TestGatewayIdentityIgnored(t *testing.T) {
+	useGatewayIdentity(t, true, "10.0.0.0/8")
+
+	// forwarding headers don't make a peer trusted
+	spoofed := gatewayRequest("192.0.2.10:41000")
+	spoofed.Header.Set("X-Forwarded-For", "10.1.2.3")
+	if status, _ := whoamiOf(t, spoofed); status != http.StatusUnauthorized {
+		t.Errorf("whoami with the headers from an untrusted peer = %d, want %d", status, http.StatusUnauthorized)
+	}
+
+	// a request from an untrusted peer still authenticates as usual, as itself
+	withBasicAuth := asAdmin(gatewayRequest("192.0.2.10:41000"))
+	if status, identity := whoamiOf(t, withBasicAuth); status != http.StatusOK || identity.User != username || identity.Strategy != strategyBasic {
+		t.Errorf("whoami with basic auth from an untrusted peer = %d %+v, want %s by basic auth", status, identity, username)
+	}
+
+	// a trusted proxy that names no user doesn't authenticate anyone
+	anonymous := gatewayRequest("10.1.2.3:41000")
+	anonymous.Header.Del("X-Authenticated-User")
+	if status, _ := whoamiOf(t, anonymous); status != http.StatusUnauthorized {
+		t.Errorf("whoami from a trusted peer without a user = %d, want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestGatewayIdentityDisabled(t *testing.T) {
+	useGatewayIdentity(t, false, "10.0.0.0/8")
+
+	if status, _ := whoamiOf(t, gatewayRequest("10.1.2.3:41000")); status != http.StatusUnauthorized {
+		t.Errorf("whoami with the headers and TRUST_GATEWAY_IDENTITY unset = %d, want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestGatewayIdentityRequiresProxies(t *testing.T) {
+	t.Setenv("TRUSTED_PROXY_CIDRS", "")
+	previous, previousProxies := trustGatewayIdentity, trustedProxies
+	trustGatewayIdentity, trustedProxies = true, nil
+	t.Cleanup(func() { trustGatewayIdentity, trustedProxies = previous, previousProxies })
+
+	if err := setupGatewayIdentity(); err == nil {
+		t.Error("TRUST_GATEWAY_IDENTITY without TRUSTED_PROXY_CIDRS was accepted")
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	policy "github.com/filetrust/policy-update-service/pkg"
+)
+
+// gitPolicyURL is the raw URL of a policy JSON file kept in Git, e.g. on a Git host's
+// raw file endpoint. When set the service polls it and applies the policy it holds,
+// acting as a small GitOps applier for the policy.
+var (
+	gitPolicyURL    = os.Getenv("GIT_POLICY_URL")
+	gitPollInterval time.Duration
+)
+
+func setupGitPolicySource() error {
+	if gitPolicyURL == "" {
+		return nil
+	}
+
+	source, err := url.Parse(gitPolicyURL)
+	if err != nil || (source.Scheme != "https" && source.Scheme != "http") || source.Host == "" {
+		return errors.New("GIT_POLICY_URL must be an absolute http or https URL")
+	}
+
+	if targetLabelSelector != "" {
+		return errors.New("GIT_POLICY_URL is not supported with TARGET_LABEL_SELECTOR")
+	}
+
+	gitPollInterval, err = durationFromEnv("GIT_POLL_INTERVAL", 5*time.Minute)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Applying policy from %s every %v", source.Redacted(), gitPollInterval)
+	return nil
+}
+
+// gitSyncState is the outcome of the latest poll, for the status endpoint.
+type gitSyncState struct {
+	LastAttempt time.Time  `json:"lastAttempt"`
+	LastSuccess *time.Time `json:"lastSuccess,omitempty"`
+	Outcome     string     `json:"outcome"`
+	Error       string     `json:"error,omitempty"`
+}
+
+var (
+	gitSyncMu sync.Mutex
+	gitSync   gitSyncState
+)
+
+func recordGitSync(outcome string, err error) {
+	gitSyncMu.Lock()
+	defer gitSyncMu.Unlock()
+
+	now := time.Now().UTC()
+	gitSync.LastAttempt = now
+	gitSync.Outcome = outcome
+	gitSync.Error = ""
+	if err != nil {
+		gitSync.Error = redactPolicyError(err)
+		return
+	}
+	gitSync.LastSuccess = &now
+}
+
+// gitSyncStatus reports the latest poll. A failed poll degrades the service: the
+// policy is still served, but changes in Git are not being applied.
+func gitSyncStatus() componentStatus {
+	gitSyncMu.Lock()
+	defer gitSyncMu.Unlock()
+
+	if gitSync.LastAttempt.IsZero() {
+		return componentStatus{Status: statusOK, Detail: "not synced yet"}
+	}
+
+	if gitSync.Error != "" {
+		return componentStatus{Status: statusDegraded, Detail: gitSync}
+	}
+
+	return componentStatus{Status: statusOK, Detail: gitSync}
+}
+
+// runGitPolicySync polls GIT_POLICY_URL at startup and then every interval until ctx
+// is cancelled.
+func runGitPolicySync(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		syncGitPolicy(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// gitSyncUser is the user the Git sync writes the policy as, in the audit trail and
+// events, and in the SubjectAccessReview of its writes with K8S_SAR_AUTHZ.
+const gitSyncUser = "policy-update-service:git"
+
+// syncGitPolicy applies the policy in Git if it is valid and differs from the stored
+// one, so the config map is also brought back in line if it drifted from Git. Its
+// writes are checked and recorded like those of a PUT: nothing is applied while the
+// policy is frozen or changed too recently, or with K8S_SAR_AUTHZ, unless RBAC allows
+// gitSyncUser to update the config map.
+func syncGitPolicy(ctx context.Context) {
+	if until, frozen := policyFrozenUntil(time.Now()); frozen {
+		recordGitSync("frozen", nil)
+		log.Printf("Git policy sync skipped, policy changes are frozen until %s", until.Format(time.RFC3339))
+		return
+	}
+
+	p, err := fetchGitPolicy(ctx)
+	if err != nil {
+		recordGitSync("error", err)
+		log.Printf("Git policy sync failed: %s", redactPolicyError(err))
+		return
+	}
+
+	str := renderPolicy(p)
+	args := policy.PolicyArgs{
+		Policy:          str,
+		Namespace:       namespace,
+		ConfigMapName:   configmapName,
+		ServerSideApply: useServerSideApply,
+		PolicyKeys:      policyKeys,
+		ReplaceData:     updateStrategy == updateStrategyReplace,
+		Written:         recordConfigMapSize,
+	}
+
+	if err := args.GetClient(); err != nil {
+		recordGitSync("error", err)
+		log.Printf("Git policy sync failed, unable to get client: %v", err)
+		return
+	}
+
+	// the policy is only written, and the change reserved, if it differs from Git
+	if current, err := args.GetPolicy(ctx); err == nil && current == str {
+		recordGitSync(policy.Unchanged.String(), nil)
+		return
+	}
+
+	if sarAuthz {
+		allowed, reason, err := reviewPolicyWrite(ctx, policy.Subject{User: gitSyncUser})
+		if err != nil {
+			recordGitSync("error", err)
+			log.Printf("Git policy sync failed, unable to review access: %v", err)
+			return
+		}
+		if !allowed {
+			recordGitSync("forbidden", fmt.Errorf("user %s is not allowed to update the policy config map", gitSyncUser))
+			log.Printf("SubjectAccessReview denied Git policy sync: %s", orDash(reason))
+			return
+		}
+	}
+
+	wait, release := reserveChange()
+	if wait > 0 {
+		recordGitSync("throttled", nil)
+		log.Printf("Git policy sync skipped, the policy was changed less than %v ago", minChangeInterval)
+		return
+	}
+
+	changed := false
+	defer func() { release(changed) }()
+
+	result, err := writePolicy(ctx, args, gitSyncUser, "git", "")
+	if err != nil {
+		recordGitSync("error", err)
+		log.Printf("Git policy sync failed, unable to update policy: %v", err)
+		return
+	}
+
+	changed = result.Outcome != policy.Unchanged
+	recordGitSync(result.Outcome.String(), nil)
+}
+
+// fetchGitPolicy downloads the policy file and decodes it with the same checks as a
+// PUT of it. OUTBOUND_TIMEOUT bounds the download.
+func fetchGitPolicy(ctx context.Context) (Policy, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", gitPolicyURL, nil)
+	if err != nil {
+		return Policy{}, err
+	}
+
+	res, err := outboundClient.Do(req)
+	if err != nil {
+		// the error quotes the URL, which may carry credentials
+		return Policy{}, fmt.Errorf("unable to fetch the policy file: %v", errors.Unwrap(err))
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return Policy{}, fmt.Errorf("fetching the policy file returned %s", res.Status)
+	}
+
+	p, err := decodePolicy(io.LimitReader(res.Body, maxBodyBytes))
+	if err != nil {
+		return Policy{}, fmt.Errorf("the policy file is not a valid policy: %w", err)
+	}
+
+	return p, nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	policy "github.com/filetrust/policy-update-service/pkg"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// useGitSource points GIT_POLICY_URL at a mock Git host serving document, and resets
+// the sync status and the records of the latest write, for the rest of the test.
+func useGitSource(t *testing.T, document string) {
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/policy.json" {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, document)
+	}))
+	t.Cleanup(source.Close)
+
+	previous := gitPolicyURL
+	gitPolicyURL = source.URL + "/policy.json"
+	reset := func() {
+		gitSync = gitSyncState{}
+		lastWriteAt, lastWriteErr, lastWriteOKAt = time.Time{}, nil, time.Time{}
+	}
+	reset()
+	t.Cleanup(func() {
+		gitPolicyURL = previous
+		reset()
+	})
+}
+
+// configMapUpdates counts the writes to config maps made through client.
+func configMapUpdates(client interface {
+	PrependReactor(verb, resource string, reaction k8stesting.ReactionFunc)
+}) *int {
+	updates := 0
+	client.PrependReactor("update", "configmaps", func(k8stesting.Action) (bool, runtime.Object, error) {
+		updates++
+		return false, nil, nil
+	})
+
+	return &updates
+}
+
+func TestSyncGitPolicyApplies(t *testing.T) {
+	client := useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`))
+	useGitSource(t, `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":3}`)
+	useAuditLog(t, 10)
+	events := useEventBroker(t).subscribe()
+
+	syncGitPolicy(context.Background())
+
+	if gitSync.Outcome != policy.Updated.String() || gitSync.Error != "" {
+		t.Fatalf("sync = %+v, want updated", gitSync)
+	}
+	if doc := storedDocument(t, client); strings.TrimSpace(doc) != `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":3}` {
+		t.Errorf("stored policy = %s", doc)
+	}
+
+	// recorded like any other write
+	if lastWriteOKAt.IsZero() || lastUpdateStatus().Status != statusOK {
+		t.Errorf("last update not recorded: %+v", lastUpdateStatus())
+	}
+	if entries := auditTrail.list(func(auditEntry) bool { return true }); len(entries) != 1 || entries[0].User != gitSyncUser {
+		t.Errorf("audit entries = %+v, want one by %s", entries, gitSyncUser)
+	}
+	select {
+	case event := <-events:
+		if !strings.Contains(string(event), `"GlasswallBlockedFilesAction":3`) {
+			t.Errorf("event = %s", event)
+		}
+	default:
+		t.Error("no event published")
+	}
+}
+
+func TestSyncGitPolicyUnchanged(t *testing.T) {
+	client := useFakeClient(t, policyConfigMap("{\"UnprocessableFileTypeAction\":2,\"GlasswallBlockedFilesAction\":3}\n"))
+	updates := configMapUpdates(client)
+	useGitSource(t, `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":3}`)
+	useChangeThrottle(t, time.Hour)
+	changeThrottle.lastChange = time.Now()
+
+	syncGitPolicy(context.Background())
+
+	// an unchanged policy is neither written nor throttled
+	if gitSync.Outcome != policy.Unchanged.String() || *updates != 0 {
+		t.Errorf("sync = %+v with %d writes, want unchanged with none", gitSync, *updates)
+	}
+}
+
+func TestSyncGitPolicySkipped(t *testing.T) {
+	const stored = `{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`
+
+	tests := []struct {
+		name     string
+		document string
+		setup    func(t *testing.T)
+		outcome  string
+	}{
+		{
+			name:     "invalid policy",
+			document: `{"UnprocessableFileTypeAction":9,"GlasswallBlockedFilesAction":1}`,
+			outcome:  "error",
+		},
+		{
+			name:     "frozen",
+			document: `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":1}`,
+			setup: func(t *testing.T) {
+				previous := freezeWindows
+				freezeWindows = []freezeWindow{{start: time.Now().Add(-time.Hour), end: time.Now().Add(time.Hour)}}
+				t.Cleanup(func() { freezeWindows = previous })
+			},
+			outcome: "frozen",
+		},
+		{
+			name:     "throttled",
+			document: `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":1}`,
+			setup: func(t *testing.T) {
+				useChangeThrottle(t, time.Hour)
+				changeThrottle.lastChange = time.Now()
+			},
+			outcome: "throttled",
+		},
+		{
+			name:     "not authorized",
+			document: `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":1}`,
+			setup: func(t *testing.T) {
+				useSubjectAccessReview(t, func(user string) bool { return user != gitSyncUser })
+			},
+			outcome: "forbidden",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := useFakeClient(t, policyConfigMap(stored))
+			updates := configMapUpdates(client)
+			useGitSource(t, tt.document)
+			if tt.setup != nil {
+				tt.setup(t)
+			}
+
+			syncGitPolicy(context.Background())
+
+			if gitSync.Outcome != tt.outcome {
+				t.Errorf("outcome = %q, want %q", gitSync.Outcome, tt.outcome)
+			}
+			if *updates != 0 {
+				t.Errorf("policy written %d times", *updates)
+			}
+		})
+	}
+}
+
+func TestSyncGitPolicyWriteFailure(t *testing.T) {
+	client := useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`))
+	client.PrependReactor("update", "configmaps", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, io.ErrUnexpectedEOF
+	})
+	useGitSource(t, `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":1}`)
+	previous := consecutiveWriteFailures
+	t.Cleanup(func() { consecutiveWriteFailures = previous })
+	consecutiveWriteFailures = 0
+
+	// the write is retried until the context ends
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	syncGitPolicy(ctx)
+
+	if gitSync.Outcome != "error" || gitSyncStatus().Status != statusDegraded {
+		t.Errorf("sync = %+v, want a degraded error", gitSync)
+	}
+	if consecutiveWriteFailures != 1 || lastWriteErr == nil {
+		t.Errorf("failed write not recorded: %d failures, error %v", consecutiveWriteFailures, lastWriteErr)
+	}
+}
+
+// useSubjectAccessReview turns on K8S_SAR_AUTHZ against a fake API that allows the
+// users allowed accepts, for the rest of the test.
+func useSubjectAccessReview(t *testing.T, allowed func(user string) bool) {
+	client := testClient.(interface {
+		PrependReactor(verb, resource string, reaction k8stesting.ReactionFunc)
+	})
+	client.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		review.Status.Allowed = allowed(review.Spec.User)
+		return true, review, nil
+	})
+
+	previousAuthz, previousReviewer := sarAuthz, reviewer
+	sarAuthz, reviewer = true, &policy.Reviewer{Client: testClient}
+	t.Cleanup(func() { sarAuthz, reviewer = previousAuthz, previousReviewer })
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+)
+
+var (
+	// maxHeaderCount and maxHeaderBytes bound the request headers accepted ahead of
+	// authentication and body decoding.
+	maxHeaderCount int
+	maxHeaderBytes int
+)
+
+func setupHeaderLimits() error {
+	var err error
+	maxHeaderCount, err = intFromEnv("MAX_HEADER_COUNT", 100)
+	if err != nil {
+		return err
+	}
+
+	maxHeaderBytes, err = intFromEnv("MAX_HEADER_BYTES", 16384)
+	return err
+}
+
+// headerLimitsMiddleware rejects requests with more header lines, or more header bytes
+// as sent on the wire, than the configured limits.
+func headerLimitsMiddleware(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	count, size := 0, 0
+	for name, values := range r.Header {
+		for _, value := range values {
+			count++
+			// name, ": ", value and the line ending
+			size += len(name) + len(value) + 4
+		}
+	}
+
+	if count > maxHeaderCount || size > maxHeaderBytes {
+		loggerFromContext(r.Context()).Printf("Rejected request from %s with %d headers of %d bytes", r.RemoteAddr, count, size)
+		writeError(w, http.StatusRequestHeaderFieldsTooLarge, codeHeadersTooLarge, "Request headers exceed the allowed count or size.")
+		return
+	}
+
+	next(w, r)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestHeaderLimits(t *testing.T) {
+	handler := handlerFor(headerLimitsMiddleware)
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    int
+	}{
+		{name: "within limits", headers: map[string]string{"X-Small": "value"}, want: http.StatusNoContent},
+		{name: "too many headers", headers: manyHeaders(maxHeaderCount + 1), want: http.StatusRequestHeaderFieldsTooLarge},
+		{name: "too many bytes", headers: map[string]string{"X-Large": strings.Repeat("a", maxHeaderBytes)}, want: http.StatusRequestHeaderFieldsTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/v1/policy", nil)
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+
+			w := serve(handler, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func manyHeaders(n int) map[string]string {
+	headers := map[string]string{}
+	for i := 0; i < n; i++ {
+		headers["X-Header-"+strconv.Itoa(i)] = "v"
+	}
+
+	return headers
+}
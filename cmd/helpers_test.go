@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	policy "github.com/filetrust/policy-update-service/pkg"
+	"github.com/shaj13/go-guardian/auth"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// testClient is the Kubernetes client every handler gets; useFakeClient replaces it.
+var testClient kubernetes.Interface = fake.NewClientset()
+
+// TestMain configures the service as main would with no optional settings, against a
+// fake Kubernetes API.
+func TestMain(m *testing.M) {
+	namespace, configmapName = "ncfs", "ncfs-policy"
+	username, password = "admin", "admin-password"
+	jwtSecret = "a-test-secret-of-at-least-32-bytes"
+
+	setups := []func() error{
+		setupUpdateStrategy,
+		setupUnknownFields,
+		setupRoles,
+		setupMessages,
+		setupPolicyRules,
+		setupDefaults,
+		setupChangeThrottle,
+		setupFreezeWindows,
+		setupNonces,
+		setupAuthFailureDelay,
+		setupHeaderLimits,
+		setupConcurrencyLimits,
+		setupFieldCase,
+		setupPolicyCache,
+		setupRequestTimeout,
+		setupEventStreams,
+		setupAuditLog,
+	}
+	for _, setup := range setups {
+		if err := setup(); err != nil {
+			log.Fatalf("test setup failed: %v", err)
+		}
+	}
+
+	policy.NewClient = func() (kubernetes.Interface, error) {
+		return testClient, nil
+	}
+
+	os.Exit(m.Run())
+}
+
+// useFakeClient points the handlers at a fake Kubernetes API holding objects for the
+// rest of the test.
+func useFakeClient(t *testing.T, objects ...runtime.Object) *fake.Clientset {
+	client := fake.NewClientset(objects...)
+
+	previous := testClient
+	testClient = client
+	storedPolicyCache.invalidate()
+	t.Cleanup(func() {
+		testClient = previous
+		storedPolicyCache.invalidate()
+	})
+
+	return client
+}
+
+// policyConfigMap returns the policy config map holding doc under appsettings.json.
+func policyConfigMap(doc string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: configmapName, Namespace: namespace, ResourceVersion: "1"},
+		Data:       map[string]string{"appsettings.json": doc},
+	}
+}
+
+// storedDocument returns the appsettings.json document of the policy config map.
+func storedDocument(t *testing.T, client kubernetes.Interface) string {
+	configMap, err := client.CoreV1().ConfigMaps(namespace).Get(context.Background(), configmapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return configMap.Data["appsettings.json"]
+}
+
+// newTestHandler returns the API with its full middleware chain and the default
+// authenticator.
+func newTestHandler() http.Handler {
+	s := &Server{Authenticator: newAuthenticator()}
+	return s.Handler()
+}
+
+// serve sends r to h and returns the recorded response.
+func serve(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// asAdmin authenticates r with the basic auth credentials of the USERNAME account.
+func asAdmin(r *http.Request) *http.Request {
+	r.SetBasicAuth(username, password)
+	return r
+}
+
+// withIdentity returns r as authenticated by authMiddleware for user with groups.
+func withIdentity(r *http.Request, user string, groups ...string) *http.Request {
+	info := auth.NewDefaultUser(user, "", groups, nil)
+	return r.WithContext(context.WithValue(r.Context(), identityKey{}, identity{user: user, info: info}))
+}
+
+// handlerFor returns a middleware wrapped around a handler that answers 204, so tests
+// can tell whether the middleware let the request through.
+func handlerFor(middleware func(http.ResponseWriter, *http.Request, http.HandlerFunc)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		middleware(w, r, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
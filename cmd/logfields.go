@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+
+	policy "github.com/filetrust/policy-update-service/pkg"
+)
+
+// setupLogging makes every log, including those of the standard logger, a slog record
+// written as logfmt to stderr, with the request attributes of its context. Debug
+// records are only written with LOG_LEVEL=debug.
+func setupLogging() {
+	level := slog.LevelInfo
+	if debugLogging {
+		level = slog.LevelDebug
+	}
+
+	handler := slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})
+	slog.SetDefault(slog.New(policy.NewContextHandler(handler)))
+}
+
+// loggerFromContext returns a logger whose lines carry the request attributes of ctx:
+// request_id, method, path and, once authenticated, user.
+func loggerFromContext(ctx context.Context) *log.Logger {
+	return policy.Logger(ctx)
+}
+
+// logFieldsMiddleware adds the request ID, method and path of each request to its
+// context for loggerFromContext. The pkg layer logs with the same attributes.
+func logFieldsMiddleware(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	var fields []string
+	if id := r.Header.Get("X-Request-ID"); id != "" {
+		fields = append(fields, "request_id", id)
+	}
+	fields = append(fields, "method", r.Method, "path", r.URL.Path)
+
+	next(w, r.WithContext(policy.WithLogFields(r.Context(), fields...)))
+}
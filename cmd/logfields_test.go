@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	policy "github.com/filetrust/policy-update-service/pkg"
+)
+
+// captureLogs sends every log to a JSON handler for the rest of the test and returns
+// a func decoding the records logged so far.
+func captureLogs(t *testing.T) func() []map[string]interface{} {
+	return captureLogsAt(t, slog.LevelInfo)
+}
+
+// captureLogsAt is captureLogs for the records at level and above.
+func captureLogsAt(t *testing.T, level slog.Level) func() []map[string]interface{} {
+	var buf bytes.Buffer
+	previous, writer, flags := slog.Default(), log.Writer(), log.Flags()
+	slog.SetDefault(slog.New(policy.NewContextHandler(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: level}))))
+	t.Cleanup(func() {
+		slog.SetDefault(previous)
+		log.SetOutput(writer)
+		log.SetFlags(flags)
+	})
+
+	return func() []map[string]interface{} {
+		var records []map[string]interface{}
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			var record map[string]interface{}
+			if err := json.Unmarshal([]byte(line), &record); err != nil {
+				t.Fatalf("log line %q is not a record: %v", line, err)
+			}
+			records = append(records, record)
+		}
+
+		return records
+	}
+}
+
+func TestRequestLogAttributes(t *testing.T) {
+	useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`))
+	records := captureLogs(t)
+
+	r := asAdmin(httptest.NewRequest("PUT", policyPath, strings.NewReader(`{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":1}`)))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-Request-ID", "req-123")
+	if w := serve(newTestHandler(), r); w.Code != http.StatusOK {
+		t.Fatalf("PUT status = %d: %s", w.Code, w.Body)
+	}
+
+	want := map[string]interface{}{"request_id": "req-123", "method": "PUT", "path": policyPath, "user": "admin"}
+	found := false
+	for _, record := range records() {
+		msg, _ := record["msg"].(string)
+		if !strings.HasPrefix(msg, "Policy in config map") {
+			continue
+		}
+
+		found = true
+		for key, value := range want {
+			if record[key] != value {
+				t.Errorf("%s = %v, want %v in %v", key, record[key], value, record)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("no record of the update in %v", records())
+	}
+}
+
+func TestContextHandlerAddsAttributes(t *testing.T) {
+	records := captureLogs(t)
+
+	ctx := policy.WithLogFields(httptest.NewRequest("GET", "/", nil).Context(), "request_id", "req-1", "path", "/a")
+	ctx = policy.WithLogFields(ctx, "user", "alice")
+	slog.InfoContext(ctx, "from slog", "step", "decode")
+	loggerFromContext(ctx).Printf("from log")
+	slog.Info("without a context")
+
+	got := records()
+	if len(got) != 3 {
+		t.Fatalf("got %d records, want 3", len(got))
+	}
+	for _, record := range got[:2] {
+		if record["request_id"] != "req-1" || record["path"] != "/a" || record["user"] != "alice" {
+			t.Errorf("record %v is missing the context attributes", record)
+		}
+	}
+	if got[0]["step"] != "decode" {
+		t.Errorf("record %v lost its own attributes", got[0])
+	}
+	if _, ok := got[2]["user"]; ok {
+		t.Errorf("record %v without a context has request attributes", got[2])
+	}
+}
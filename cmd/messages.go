@@ -0,0 +1,177 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/golang/gddo/httputil/header"
+)
+
+// defaultLanguage is used when Accept-Language names no language with a bundle. Its
+// bundle must hold every message.
+const defaultLanguage = "en"
+
+// Keys of the user-facing messages that are localized. The error code sent with a
+// message never depends on the language.
+const (
+	msgNotFound         = "not_found"
+	msgMethodNotAllowed = "method_not_allowed"
+	msgNoPolicyStored   = "no_policy_stored"
+
+	// The field messages are shared by every policy field, so their wording can't
+	// drift apart. They take the field name and, for ranges, the bounds.
+	msgFieldRequired   = "field_required"
+	msgFieldsRequired  = "fields_required"
+	msgFieldOutOfRange = "field_out_of_range"
+	msgFieldNotWhole   = "field_not_whole"
+	msgFieldsConflict  = "fields_conflict"
+)
+
+// bundledMessages holds the built-in message bundles, one <language>.json file per
+// language mapping message keys to their formats.
+//
+//go:embed messages/*.json
+var bundledMessages embed.FS
+
+// messageBundles holds the localized messages by language, as loaded by
+// setupMessages. A message missing from a bundle falls back to the default language.
+var messageBundles map[string]map[string]string
+
+// formatVerbs matches the fmt verbs of a message, which every translation must use in
+// the same order as the default language.
+var formatVerbs = regexp.MustCompile(`%[a-z]`)
+
+// setupMessages loads the built-in message bundles and then any in MESSAGES_DIR, which
+// add languages or replace messages of the built-in ones. Their messages must be
+// known, take the same arguments as the default language and have no stray
+// whitespace; the built-in bundles are held to the same rules by the tests.
+func setupMessages() error {
+	bundles, err := loadMessageBundles(bundledMessages, "messages")
+	if err != nil {
+		return err
+	}
+
+	if dir := os.Getenv("MESSAGES_DIR"); dir != "" {
+		extra, err := loadMessageBundles(os.DirFS(dir), ".")
+		if err != nil {
+			return fmt.Errorf("invalid MESSAGES_DIR: %w", err)
+		}
+
+		for lang, bundle := range extra {
+			if err := checkMessageBundle(lang, bundle, bundles[defaultLanguage]); err != nil {
+				return fmt.Errorf("invalid MESSAGES_DIR: %w", err)
+			}
+
+			if bundles[lang] == nil {
+				bundles[lang] = map[string]string{}
+			}
+			for key, format := range bundle {
+				bundles[lang][key] = format
+			}
+		}
+		log.Printf("Loaded message bundles from %s", dir)
+	}
+
+	messageBundles = bundles
+	return nil
+}
+
+// loadMessageBundles reads the <language>.json files in dir of fsys.
+func loadMessageBundles(fsys fs.FS, dir string) (map[string]map[string]string, error) {
+	names, err := fs.Glob(fsys, path.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	bundles := map[string]map[string]string{}
+	for _, name := range names {
+		b, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+
+		var bundle map[string]string
+		if err := json.Unmarshal(b, &bundle); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		bundles[strings.ToLower(strings.TrimSuffix(path.Base(name), ".json"))] = bundle
+	}
+
+	return bundles, nil
+}
+
+// checkMessageBundle checks the messages of the lang bundle against those of the
+// default language in base.
+func checkMessageBundle(lang string, bundle, base map[string]string) error {
+	for key, format := range bundle {
+		baseFormat, ok := base[key]
+		if !ok {
+			return fmt.Errorf("message %s in bundle %s is not in the %s bundle", key, lang, defaultLanguage)
+		}
+
+		if strings.Join(formatVerbs.FindAllString(format, -1), "") != strings.Join(formatVerbs.FindAllString(baseFormat, -1), "") {
+			return fmt.Errorf("message %s in bundle %s does not take the same arguments as in the %s bundle", key, lang, defaultLanguage)
+		}
+
+		if strings.Contains(format, "  ") || strings.TrimSpace(format) != format {
+			return fmt.Errorf("message %s in bundle %s has stray whitespace", key, lang)
+		}
+	}
+
+	return nil
+}
+
+// localizedError is an error whose message comes from the message bundles. Error
+// returns it in the default language, for logs.
+type localizedError struct {
+	key  string
+	args []interface{}
+}
+
+func (e localizedError) Error() string {
+	return e.in(defaultLanguage)
+}
+
+// in renders the message in lang, falling back to the default language.
+func (e localizedError) in(lang string) string {
+	format, ok := messageBundles[lang][e.key]
+	if !ok {
+		format = messageBundles[defaultLanguage][e.key]
+	}
+
+	return fmt.Sprintf(format, e.args...)
+}
+
+// requestLanguage picks the bundle for the most preferred language in the
+// Accept-Language header of r. A regional tag such as de-AT matches the de bundle.
+func requestLanguage(r *http.Request) string {
+	lang, best := defaultLanguage, 0.0
+	for _, spec := range header.ParseAccept(r.Header, "Accept-Language") {
+		tag := strings.ToLower(spec.Value)
+		if i := strings.IndexByte(tag, '-'); i >= 0 {
+			tag = tag[:i]
+		}
+
+		if _, ok := messageBundles[tag]; ok && spec.Q > best {
+			lang, best = tag, spec.Q
+		}
+	}
+
+	return lang
+}
+
+// writeLocalizedError is writeError with the message of e in the language requested
+// by r, named in the Content-Language header.
+func writeLocalizedError(w http.ResponseWriter, r *http.Request, status int, code string, e localizedError) {
+	lang := requestLanguage(r)
+	w.Header().Set("Content-Language", lang)
+	writeError(w, status, code, e.in(lang))
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMessageBundles guards against the kind of slip that once put a double space in
+// a validation message: every translation must exist in the default bundle, take the
+// same arguments, and be free of doubled or trailing whitespace.
+func TestMessageBundles(t *testing.T) {
+	keys := []string{msgNotFound, msgMethodNotAllowed, msgNoPolicyStored, msgFieldRequired, msgFieldsRequired, msgFieldOutOfRange, msgFieldNotWhole, msgFieldsConflict}
+	for _, key := range keys {
+		if _, ok := messageBundles[defaultLanguage][key]; !ok {
+			t.Errorf("message %s is not in the %s bundle", key, defaultLanguage)
+		}
+	}
+
+	for lang, bundle := range messageBundles {
+		if err := checkMessageBundle(lang, bundle, messageBundles[defaultLanguage]); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// useMessagesDir loads the message bundles with MESSAGES_DIR set to a directory holding
+// files, restoring the built-in bundles after the test.
+func useMessagesDir(t *testing.T, files map[string]string) error {
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	previous := messageBundles
+	t.Setenv("MESSAGES_DIR", dir)
+	t.Cleanup(func() { messageBundles = previous })
+
+	return setupMessages()
+}
+
+func TestMessagesDir(t *testing.T) {
+	err := useMessagesDir(t, map[string]string{
+		"fr.json": `{"field_required": "%s est obligatoire."}`,
+		"de.json": `{"not_found": "Nicht gefunden."}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := (localizedError{key: msgFieldRequired, args: []interface{}{"X"}}).in("fr"); got != "X est obligatoire." {
+		t.Errorf("added language = %q", got)
+	}
+	if got := (localizedError{key: msgFieldNotWhole, args: []interface{}{"X"}}).in("fr"); got != "X must be a whole number." {
+		t.Errorf("message missing from an added language = %q, want the default", got)
+	}
+	if got := (localizedError{key: msgNotFound}).in("de"); got != "Nicht gefunden." {
+		t.Errorf("replaced message = %q", got)
+	}
+	if got := (localizedError{key: msgNoPolicyStored}).in("de"); got != "Es wurde noch keine Richtlinie gespeichert." {
+		t.Errorf("built-in message of a language with replacements = %q", got)
+	}
+}
+
+func TestMessagesDirRejected(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+	}{
+		{name: "not json", files: map[string]string{"fr.json": `field_required: "%s"`}},
+		{name: "unknown message", files: map[string]string{"fr.json": `{"no_such_message": "x"}`}},
+		{name: "other arguments", files: map[string]string{"fr.json": `{"field_out_of_range": "%s est hors limites."}`}},
+		{name: "stray whitespace", files: map[string]string{"fr.json": `{"field_required": "%s est  obligatoire."}`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := useMessagesDir(t, tt.files); err == nil {
+				t.Error("bundles accepted")
+			}
+		})
+	}
+}
+
+func TestLocalizedValidationMessage(t *testing.T) {
+	r := httptest.NewRequest("POST", "/api/v1/policy/render", strings.NewReader(`{"UnprocessableFileTypeAction":5,"GlasswallBlockedFilesAction":1}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Accept-Language", "fr;q=0.9, de-AT;q=0.8")
+
+	w := serve(newTestHandler(), asAdmin(r))
+	var resp errorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "UnprocessableFileTypeAction muss zwischen 1 und 4 (einschließlich) liegen."; resp.Message != want {
+		t.Errorf("message = %q, want %q", resp.Message, want)
+	}
+	if resp.Code != codeValidation {
+		t.Errorf("code = %q, want %q in every language", resp.Code, codeValidation)
+	}
+	if lang := w.Header().Get("Content-Language"); lang != "de" {
+		t.Errorf("Content-Language = %q, want de", lang)
+	}
+}
+
+// validationMessage returns the error message the render endpoint gives for body.
+func validationMessage(t *testing.T, body string) string {
+	r := httptest.NewRequest("POST", "/api/v1/policy/render", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+
+	w := serve(newTestHandler(), asAdmin(r))
+	var resp errorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%d %s: %v", w.Code, w.Body, err)
+	}
+
+	return resp.Message
+}
+
+// TestValidationMessages snapshots the exact validation messages, so a change to
+// their wording or spacing is deliberate.
+func TestValidationMessages(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "missing unprocessable", body: `{"GlasswallBlockedFilesAction":1}`, want: "UnprocessableFileTypeAction is required."},
+		{name: "missing blocked", body: `{"UnprocessableFileTypeAction":1}`, want: "GlasswallBlockedFilesAction is required."},
+		{name: "missing both", body: `{}`, want: "UnprocessableFileTypeAction, GlasswallBlockedFilesAction are required."},
+		{name: "unprocessable out of range", body: `{"UnprocessableFileTypeAction":5,"GlasswallBlockedFilesAction":1}`, want: "UnprocessableFileTypeAction must be between 1-4 inclusive."},
+		{name: "blocked out of range", body: `{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":0}`, want: "GlasswallBlockedFilesAction must be between 1-4 inclusive."},
+		{name: "unprocessable not whole", body: `{"UnprocessableFileTypeAction":1.5,"GlasswallBlockedFilesAction":1}`, want: "UnprocessableFileTypeAction must be a whole number."},
+		{name: "blocked not whole", body: `{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":2.5}`, want: "GlasswallBlockedFilesAction must be a whole number."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validationMessage(t, tt.body); got != tt.want {
+				t.Errorf("message = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// serviceMetrics holds the metrics exported by the service itself, as opposed to
+// the HTTP metrics recorded by the go-http-metrics middleware.
+type serviceMetrics struct {
+	reconciliations    *prometheus.CounterVec
+	certificateReloads prometheus.Counter
+	errors             *prometheus.CounterVec
+	queueDepth         *prometheus.GaugeVec
+	validationFailures *prometheus.CounterVec
+	configMapBytes     *prometheus.GaugeVec
+	authCacheLookups   *prometheus.CounterVec
+	authCacheEntries   prometheus.GaugeFunc
+	eventSubscribers   prometheus.GaugeFunc
+
+	consecutiveWriteFailures prometheus.Gauge
+	secondsSinceWriteFailure prometheus.GaugeFunc
+}
+
+// svcMetrics starts out unregistered so handlers can be used without a registry;
+// main replaces it with metrics registered against the default registry.
+var svcMetrics = newServiceMetrics()
+
+func newServiceMetrics() *serviceMetrics {
+	return &serviceMetrics{
+		reconciliations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gw_ncfspolicyupdate_reconciliations_total",
+			Help: "Number of reconciler passes by result (in_sync, corrected, frozen, throttled, error)",
+		}, []string{"result"}),
+		certificateReloads: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "gw_ncfspolicyupdate_certificate_reloads_total",
+			Help: "Number of times the TLS certificate was reloaded from disk",
+		}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gw_ncfspolicyupdate_errors_total",
+			Help: "Number of error responses by code",
+		}, []string{"code"}),
+		queueDepth: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gw_ncfspolicyupdate_queue_depth",
+			Help: "Number of requests waiting for a concurrency slot by kind (read, write)",
+		}, []string{"kind"}),
+		validationFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gw_ncfspolicyupdate_validation_failure_total",
+			Help: "Number of policy validation failures by field and reason (missing, out_of_range, wrong_type, conflict)",
+		}, []string{"field", "reason"}),
+		configMapBytes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gw_ncfspolicyupdate_configmap_bytes",
+			Help: "Serialized size in bytes of each policy config map, as of the last read at startup or write",
+		}, []string{"namespace", "configmap"}),
+		authCacheLookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gw_ncfspolicyupdate_auth_cache_lookups_total",
+			Help: "Number of authentication cache lookups by result (hit, miss)",
+		}, []string{"result"}),
+		authCacheEntries: prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "gw_ncfspolicyupdate_auth_cache_entries",
+			Help: "Number of live entries in the authentication caches",
+		}, authCacheEntries),
+		eventSubscribers: prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "gw_ncfspolicyupdate_event_subscribers",
+			Help: "Number of open policy event streams",
+		}, func() float64 { return float64(policyEvents.count()) }),
+		consecutiveWriteFailures: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "gw_ncfspolicyupdate_consecutive_write_failures",
+			Help: "Number of policy writes that have failed in a row; reset by a successful write",
+		}),
+		secondsSinceWriteFailure: prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "gw_ncfspolicyupdate_seconds_since_last_write_failure",
+			Help: "Seconds since a policy write last failed, or since startup if none has",
+		}, secondsSinceWriteFailure),
+	}
+}
+
+func (m *serviceMetrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.reconciliations,
+		m.certificateReloads,
+		m.errors,
+		m.queueDepth,
+		m.validationFailures,
+		m.configMapBytes,
+		m.authCacheLookups,
+		m.authCacheEntries,
+		m.eventSubscribers,
+		m.consecutiveWriteFailures,
+		m.secondsSinceWriteFailure,
+	}
+}
+
+// recordConfigMapSize keeps gw_ncfspolicyupdate_configmap_bytes current; it is the
+// Written callback of every policy write.
+func recordConfigMapSize(namespace, configMapName string, size int) {
+	svcMetrics.configMapBytes.WithLabelValues(namespace, configMapName).Set(float64(size))
+}
+
+// registerMetrics creates a fresh set of service metrics registered against reg. The
+// metrics are registered all or none: if one fails, those already registered are
+// unregistered again, so a retry doesn't fail on them.
+func registerMetrics(reg prometheus.Registerer) (*serviceMetrics, error) {
+	m := newServiceMetrics()
+	collectors := m.collectors()
+	for i, c := range collectors {
+		if err := reg.Register(c); err != nil {
+			for _, registered := range collectors[:i] {
+				reg.Unregister(registered)
+			}
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+func TestRegisterMetricsAllOrNone(t *testing.T) {
+	reg := prometheus.NewRegistry()
+
+	// a collector already registered under one of the names makes registration fail
+	// part way
+	conflict := newServiceMetrics().queueDepth
+	reg.MustRegister(conflict)
+
+	if _, err := registerMetrics(reg); err == nil {
+		t.Fatal("registerMetrics() succeeded despite the conflict")
+	}
+
+	// the metrics registered before the failure were unregistered again
+	other := newServiceMetrics()
+	for _, c := range []prometheus.Collector{other.reconciliations, other.certificateReloads, other.errors} {
+		if err := reg.Register(c); err != nil {
+			t.Errorf("a metric was left registered after the failure: %v", err)
+		}
+		reg.Unregister(c)
+	}
+
+	reg.Unregister(conflict)
+	if _, err := registerMetrics(reg); err != nil {
+		t.Errorf("registerMetrics() retried after the failure: %v", err)
+	}
+}
+
+// configMapBytes returns gw_ncfspolicyupdate_configmap_bytes of the policy config map.
+func configMapBytes() float64 {
+	return testutil.ToFloat64(svcMetrics.configMapBytes.WithLabelValues(namespace, configmapName))
+}
+
+// storedConfigMapSize returns the serialized size of the policy config map in client.
+func storedConfigMapSize(t *testing.T, client kubernetes.Interface) float64 {
+	configMap, err := client.CoreV1().ConfigMaps(namespace).Get(context.Background(), configmapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return float64(configMap.Size())
+}
+
+func TestConfigMapBytesAtStartup(t *testing.T) {
+	client := useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`))
+	svcMetrics.configMapBytes.WithLabelValues(namespace, configmapName).Set(0)
+
+	if err := validateStoredPolicy(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := configMapBytes(), storedConfigMapSize(t, client); got != want || got == 0 {
+		t.Errorf("configmap_bytes at startup = %v, want %v", got, want)
+	}
+}
+
+func TestConfigMapBytesAfterWrite(t *testing.T) {
+	client := useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`))
+	svcMetrics.configMapBytes.WithLabelValues(namespace, configmapName).Set(0)
+
+	w := putPolicy(newTestHandler(), `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":3}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT = %d %s", w.Code, w.Body)
+	}
+
+	if got, want := configMapBytes(), storedConfigMapSize(t, client); got != want || got == 0 {
+		t.Errorf("configmap_bytes after the write = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/urfave/negroni"
+)
+
+var (
+	requireNonce = os.Getenv("REQUIRE_NONCE") == "true"
+	nonceTTL     time.Duration
+)
+
+// maxNonceLength bounds what a client can make the cache hold per request.
+const maxNonceLength = 128
+
+var usedNonces = nonceCache{seen: map[nonceKey]time.Time{}}
+
+func setupNonces() error {
+	var err error
+	nonceTTL, err = durationFromEnv("NONCE_TTL", 10*time.Minute)
+	return err
+}
+
+// nonceKey is a nonce as used by one user. Nonces are kept per user so one user can't
+// use up the nonces of another.
+type nonceKey struct {
+	user, nonce string
+}
+
+// nonceCache remembers nonces until they expire. Expired entries are dropped at most
+// once per TTL, so the cache holds roughly two TTLs' worth of nonces.
+type nonceCache struct {
+	mu     sync.Mutex
+	seen   map[nonceKey]time.Time
+	pruned time.Time
+}
+
+// use records nonce for user and reports whether user had not used it within the TTL.
+func (c *nonceCache) use(user, nonce string, ttl time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.pruned) > ttl {
+		for n, expires := range c.seen {
+			if now.After(expires) {
+				delete(c.seen, n)
+			}
+		}
+		c.pruned = now
+	}
+
+	key := nonceKey{user: user, nonce: nonce}
+	if expires, ok := c.seen[key]; ok && now.Before(expires) {
+		return false
+	}
+
+	c.seen[key] = now.Add(ttl)
+	return true
+}
+
+// release forgets that user used nonce, so it can be used again.
+func (c *nonceCache) release(user, nonce string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.seen, nonceKey{user: user, nonce: nonce})
+}
+
+// nonceMiddleware rejects a mutating request whose X-Nonce header is missing or was
+// already used by the same user within NONCE_TTL, so a captured request can't be
+// replayed. A nonce is only used up by a request that succeeds: it is held while the
+// request runs, so a concurrent replay is still rejected, and released again by an
+// error response, so the client can retry with it. It runs after authentication so
+// unauthenticated requests can't use up nonces.
+func nonceMiddleware(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if !isMutation(r.Method) {
+		next(w, r)
+		return
+	}
+
+	nonce := r.Header.Get("X-Nonce")
+	if nonce == "" || len(nonce) > maxNonceLength {
+		writeError(w, http.StatusBadRequest, codeValidation, "X-Nonce header must be set to a unique value of at most 128 characters.")
+		return
+	}
+
+	user := requestUser(r)
+	if !usedNonces.use(user, nonce, nonceTTL) {
+		writeError(w, http.StatusConflict, codeNonceReused, "X-Nonce has already been used, send the request with a new nonce.")
+		return
+	}
+
+	res, ok := w.(negroni.ResponseWriter)
+	if !ok {
+		res = negroni.NewResponseWriter(w)
+	}
+
+	next(res, r)
+
+	if status := res.Status(); status != 0 && (status < 200 || status > 299) {
+		usedNonces.release(user, nonce)
+	}
+}
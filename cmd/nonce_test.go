@@ -0,0 +1,125 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useNonces empties the nonce cache for the rest of the test.
+func useNonces(t *testing.T) {
+	previous := usedNonces.seen
+	usedNonces.seen = map[nonceKey]time.Time{}
+	t.Cleanup(func() { usedNonces.seen = previous })
+}
+
+func TestNonceMiddleware(t *testing.T) {
+	useNonces(t)
+	handler := handlerFor(nonceMiddleware)
+
+	send := func(user, method, nonce string) int {
+		r := withIdentity(httptest.NewRequest(method, policyPath, nil), user, roleWriter)
+		if nonce != "" {
+			r.Header.Set("X-Nonce", nonce)
+		}
+		return serve(handler, r).Code
+	}
+
+	tests := []struct {
+		name   string
+		user   string
+		method string
+		nonce  string
+		want   int
+	}{
+		{name: "first use", user: "alice", method: "PUT", nonce: "n-1", want: http.StatusNoContent},
+		{name: "replay", user: "alice", method: "PUT", nonce: "n-1", want: http.StatusConflict},
+		{name: "replay with another method", user: "alice", method: "DELETE", nonce: "n-1", want: http.StatusConflict},
+		{name: "same nonce by another user", user: "bob", method: "PUT", nonce: "n-1", want: http.StatusNoContent},
+		{name: "new nonce", user: "alice", method: "PUT", nonce: "n-2", want: http.StatusNoContent},
+		{name: "missing nonce", user: "alice", method: "PUT", want: http.StatusBadRequest},
+		{name: "nonce too long", user: "alice", method: "PUT", nonce: strings.Repeat("n", maxNonceLength+1), want: http.StatusBadRequest},
+		{name: "read without nonce", user: "alice", method: "GET", want: http.StatusNoContent},
+	}
+
+	// the cases run in order, each seeing the nonces used before it
+	for _, tt := range tests {
+		if got := send(tt.user, tt.method, tt.nonce); got != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNonceExpires(t *testing.T) {
+	c := nonceCache{seen: map[nonceKey]time.Time{}}
+	if !c.use("alice", "n", time.Millisecond) {
+		t.Fatal("first use rejected")
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	if !c.use("alice", "n", time.Millisecond) {
+		t.Error("nonce still rejected after its TTL")
+	}
+	if c.use("alice", "n", time.Minute) {
+		t.Error("nonce accepted again within its TTL")
+	}
+}
+
+func TestNonceUsedOnlyOnSuccess(t *testing.T) {
+	useNonces(t)
+	status := http.StatusServiceUnavailable
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		nonceMiddleware(w, r, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		})
+	}
+
+	send := func() int {
+		r := withIdentity(httptest.NewRequest("PUT", policyPath, nil), "alice", roleWriter)
+		r.Header.Set("X-Nonce", "n-1")
+		return serve(http.HandlerFunc(handler), r).Code
+	}
+
+	// a failed request leaves its nonce for the retry
+	for _, failed := range []int{http.StatusServiceUnavailable, http.StatusBadRequest} {
+		status = failed
+		if got := send(); got != failed {
+			t.Errorf("failing request = %d, want %d", got, failed)
+		}
+	}
+
+	status = http.StatusOK
+	if got := send(); got != http.StatusOK {
+		t.Errorf("retry after a failure = %d, want %d", got, http.StatusOK)
+	}
+	if got := send(); got != http.StatusConflict {
+		t.Errorf("replay after a success = %d, want %d", got, http.StatusConflict)
+	}
+}
+
+func TestNonceHeldWhileRequestRuns(t *testing.T) {
+	useNonces(t)
+
+	var replay int
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		nonceMiddleware(w, r, func(w http.ResponseWriter, r *http.Request) {
+			// the same nonce arrives while the first request is still running
+			if replay == 0 {
+				replay = -1
+				second := withIdentity(httptest.NewRequest("PUT", policyPath, nil), "alice", roleWriter)
+				second.Header.Set("X-Nonce", "n-1")
+				replay = serve(handlerFor(nonceMiddleware), second).Code
+			}
+			w.WriteHeader(http.StatusOK)
+		})
+	}
+
+	r := withIdentity(httptest.NewRequest("PUT", policyPath, nil), "alice", roleWriter)
+	r.Header.Set("X-Nonce", "n-1")
+	serve(http.HandlerFunc(handler), r)
+	if replay != http.StatusConflict {
+		t.Errorf("replay during the request = %d, want %d", replay, http.StatusConflict)
+	}
+}
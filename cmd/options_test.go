@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOptions(t *testing.T) {
+	handler := newTestHandler()
+
+	tests := []struct {
+		path  string
+		allow string
+	}{
+		{path: policyPath, allow: "GET, PUT, PATCH, OPTIONS"},
+		{path: "/api/v1/policy/render", allow: "POST, OPTIONS"},
+		{path: "/api/v1/ping", allow: "GET, OPTIONS"},
+		{path: tokenPath, allow: "GET, OPTIONS"},
+		{path: "/api/v1/admin/cache/flush", allow: "POST, OPTIONS"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			// no credentials: preflight requests are answered before authentication
+			w := serve(handler, httptest.NewRequest("OPTIONS", tt.path, nil))
+			if w.Code != http.StatusNoContent {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusNoContent, w.Body)
+			}
+			if allow := w.Header().Get("Allow"); allow != tt.allow {
+				t.Errorf("Allow = %q, want %q", allow, tt.allow)
+			}
+			if origin := w.Header().Get("Access-Control-Allow-Origin"); origin != "*" {
+				t.Errorf("Access-Control-Allow-Origin = %q, want *", origin)
+			}
+		})
+	}
+}
+
+func TestOptionsUnknownPath(t *testing.T) {
+	if w := serve(newTestHandler(), httptest.NewRequest("OPTIONS", "/api/v1/nothing", nil)); w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// outboundClient makes every HTTP call the service starts itself, such as fetching the
+// policy from GIT_POLICY_URL. Calls go through HTTP_PROXY, HTTPS_PROXY and NO_PROXY,
+// or through OUTBOUND_PROXY when it is set. Calls to the Kubernetes API go through
+// client-go instead.
+var outboundClient = newOutboundClient(nil, 30*time.Second, 10*time.Second)
+
+// setupOutboundClient reads OUTBOUND_PROXY, OUTBOUND_TIMEOUT, which bounds a whole call
+// including reading the response, and OUTBOUND_CONNECT_TIMEOUT, which bounds
+// connecting to the server or proxy, including the TLS handshake.
+func setupOutboundClient() error {
+	var proxy *url.URL
+	if value := os.Getenv("OUTBOUND_PROXY"); value != "" {
+		var err error
+		proxy, err = url.Parse(value)
+		if err != nil || (proxy.Scheme != "http" && proxy.Scheme != "https" && proxy.Scheme != "socks5") || proxy.Host == "" {
+			return errors.New("OUTBOUND_PROXY must be an absolute http, https or socks5 URL")
+		}
+	}
+
+	timeout, err := durationFromEnv("OUTBOUND_TIMEOUT", 30*time.Second)
+	if err != nil {
+		return err
+	}
+
+	connectTimeout, err := durationFromEnv("OUTBOUND_CONNECT_TIMEOUT", 10*time.Second)
+	if err != nil {
+		return err
+	}
+
+	outboundClient = newOutboundClient(proxy, timeout, connectTimeout)
+	return nil
+}
+
+// newOutboundClient returns a client that goes through proxy, or the proxy from the
+// environment when it is nil.
+func newOutboundClient(proxy *url.URL, timeout, connectTimeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	if proxy != nil {
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	transport.DialContext = (&net.Dialer{Timeout: connectTimeout, KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = connectTimeout
+
+	return &http.Client{Transport: transport, Timeout: timeout}
+}
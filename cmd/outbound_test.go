@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestOutboundClientUsesProxy(t *testing.T) {
+	var proxied *http.Request
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r
+		io.WriteString(w, "from the proxy")
+	}))
+	defer proxy.Close()
+
+	t.Setenv("OUTBOUND_PROXY", proxy.URL)
+	previous := outboundClient
+	t.Cleanup(func() { outboundClient = previous })
+	if err := setupOutboundClient(); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := outboundClient.Get("http://policy.example.invalid/policy.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if body, _ := io.ReadAll(res.Body); string(body) != "from the proxy" {
+		t.Errorf("body = %q, want the proxy's response", body)
+	}
+	if proxied == nil || proxied.Host != "policy.example.invalid" || proxied.URL.Path != "/policy.json" {
+		t.Errorf("proxy got %v, want the request for policy.example.invalid", proxied)
+	}
+}
+
+func TestOutboundClientTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	client := newOutboundClient(nil, 50*time.Millisecond, time.Second)
+	if _, err := client.Get(server.URL); err == nil {
+		t.Error("a call slower than the timeout succeeded")
+	}
+}
+
+func TestSetupOutboundClientRejected(t *testing.T) {
+	tests := []struct {
+		name  string
+		env   string
+		value string
+	}{
+		{name: "relative proxy", env: "OUTBOUND_PROXY", value: "proxy:3128"},
+		{name: "unsupported proxy scheme", env: "OUTBOUND_PROXY", value: "ftp://proxy:21"},
+		{name: "invalid timeout", env: "OUTBOUND_TIMEOUT", value: "soon"},
+		{name: "zero connect timeout", env: "OUTBOUND_CONNECT_TIMEOUT", value: "0s"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(tt.env, tt.value)
+			if err := setupOutboundClient(); err == nil {
+				t.Errorf("%s=%q accepted", tt.env, tt.value)
+			}
+		})
+	}
+}
+
+func TestOutboundClientProxyFromEnvironment(t *testing.T) {
+	transport := newOutboundClient(nil, time.Second, time.Second).Transport.(*http.Transport)
+	// ProxyFromEnvironment reads the environment once per process, so only check that
+	// it is the proxy func used
+	if transport.Proxy == nil {
+		t.Fatal("no proxy func")
+	}
+
+	override, _ := url.Parse("http://proxy.example.invalid:3128")
+	transport = newOutboundClient(override, time.Second, time.Second).Transport.(*http.Transport)
+	got, err := transport.Proxy(httptest.NewRequest("GET", "https://policy.example.invalid/", nil))
+	if err != nil || got.String() != override.String() {
+		t.Errorf("proxy = %v, %v, want %v", got, err, override)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	policy "github.com/filetrust/policy-update-service/pkg"
+	"github.com/golang/gddo/httputil/header"
+)
+
+// patchPolicy applies an RFC 7386 JSON merge patch to the stored policy.
+func patchPolicy(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Methods", "*")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "*")
+	w.Header().Set("Access-Control-Expose-Headers", "*")
+
+	value, _ := header.ParseValueAndParams(r.Header, "Content-Type")
+	if value != "application/merge-patch+json" {
+		traceValidation(r, "content_type", "rejected", value)
+		msg := "Content-Type header is not application/merge-patch+json"
+		writeError(w, http.StatusUnsupportedMediaType, codeUnsupportedMediaType, msg)
+		return
+	}
+
+	traceValidation(r, "content_type", "ok", value)
+
+	// enforce body size and time limits
+	limitRequestBody(w, r)
+
+	patch, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	patch, bodyReason, err := takeChangeReason(patch)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, codeValidation, err.Error())
+		return
+	}
+
+	reason, ok := changeReason(w, r, bodyReason)
+	if !ok {
+		return
+	}
+
+	args := policy.PolicyArgs{
+		Namespace:     namespace,
+		ConfigMapName: configmapName,
+		PolicyKeys:    policyKeys,
+	}
+
+	err = args.GetClient()
+	if err != nil {
+		loggerFromContext(r.Context()).Printf("Unable to get client: %v", err)
+		writeError(w, http.StatusInternalServerError, codeK8sClient, "Something went wrong getting K8 Client.")
+		return
+	}
+
+	current, err := args.GetPolicy(r.Context())
+	if err != nil {
+		loggerFromContext(r.Context()).Printf("Unable to read policy: %v", err)
+		writeConfigMapError(w, err, "Something went wrong when reading the config map.")
+		return
+	}
+
+	// patch against the schema fields only, so stray stored keys can't leak into the result
+	var stored Policy
+	if current != "" {
+		stored, err = decodeStoredPolicy(current)
+		if err != nil {
+			loggerFromContext(r.Context()).Printf("Unable to parse stored policy: %s", redactPolicyError(err))
+			writeError(w, http.StatusInternalServerError, codeConfigMap, "Stored policy is not valid JSON.")
+			return
+		}
+	}
+
+	original, _ := json.Marshal(stored)
+
+	merged, err := jsonpatch.MergePatch(original, normalizePatchCase(patch))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, codeJSONError, "Request body is not a valid JSON merge patch")
+		return
+	}
+
+	p, err := decodePolicy(bytes.NewReader(merged))
+	traceDecodedPolicy(r, p, err)
+	if err != nil {
+		writePolicyError(w, r, err)
+		return
+	}
+
+	// the targets of a label selector may each hold a different policy than the one read
+	var unchanged func(string) error
+	if targetLabelSelector == "" {
+		unchanged = policyUnchanged(current)
+	}
+
+	storePolicy(w, r, p, nil, unchanged, reason)
+}
+
+// normalizePatchCase renames the fields of a merge patch to the PascalCase names the
+// stored policy is merged with, since merging matches field names exactly where
+// decoding does not. A field already in PascalCase wins over another casing of it.
+func normalizePatchCase(patch []byte) []byte {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(patch, &fields) != nil {
+		return patch
+	}
+
+	normalized := make(map[string]json.RawMessage, len(fields))
+	for name, value := range fields {
+		for _, field := range actionFields(Policy{}) {
+			if name != field.name && strings.EqualFold(name, field.name) {
+				if _, ok := fields[field.name]; ok {
+					break
+				}
+				name = field.name
+			}
+		}
+		normalized[name] = value
+	}
+
+	rest, err := json.Marshal(normalized)
+	if err != nil {
+		return patch
+	}
+
+	return rest
+}
+
+// policyUnchanged returns a precondition that the stored policy is still the one a
+// patch was merged into, so a change made meanwhile isn't overwritten.
+func policyUnchanged(read string) func(string) error {
+	return func(current string) error {
+		if current != read {
+			return errors.New("The policy changed while it was patched, retry the request.")
+		}
+
+		return nil
+	}
+}
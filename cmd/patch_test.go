@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// patchPolicyWith sends body as a merge patch of the policy as the admin.
+func patchPolicyWith(handler http.Handler, body string) *httptest.ResponseRecorder {
+	r := asAdmin(httptest.NewRequest("PATCH", policyPath, strings.NewReader(body)))
+	r.Header.Set("Content-Type", "application/merge-patch+json")
+	return serve(handler, r)
+}
+
+func TestPatchChangesOneField(t *testing.T) {
+	for _, patch := range []string{`{"GlasswallBlockedFilesAction":3}`, `{"glasswallBlockedFilesAction":3}`} {
+		t.Run(patch, func(t *testing.T) {
+			client := useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`))
+
+			if w := patchPolicyWith(newTestHandler(), patch); w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+			}
+			if doc := storedDocument(t, client); !strings.Contains(doc, `"UnprocessableFileTypeAction":1`) || !strings.Contains(doc, `"GlasswallBlockedFilesAction":3`) {
+				t.Errorf("stored policy = %s, want only GlasswallBlockedFilesAction changed", doc)
+			}
+		})
+	}
+}
+
+func TestPatchRemovesFieldWithNull(t *testing.T) {
+	// both fields are required, so removing one leaves a policy that is rejected
+	for _, patch := range []string{`{"GlasswallBlockedFilesAction":null}`, `{"glasswallBlockedFilesAction":null}`} {
+		t.Run(patch, func(t *testing.T) {
+			stored := `{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`
+			client := useFakeClient(t, policyConfigMap(stored))
+
+			w := patchPolicyWith(newTestHandler(), patch)
+			if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"fields":["GlasswallBlockedFilesAction"]`) {
+				t.Errorf("PATCH = %d %s, want 400 naming GlasswallBlockedFilesAction", w.Code, w.Body)
+			}
+			if doc := storedDocument(t, client); doc != stored {
+				t.Errorf("stored policy changed to %s", doc)
+			}
+		})
+	}
+}
+
+func TestPatchRejectsInvalidResult(t *testing.T) {
+	stored := `{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`
+	client := useFakeClient(t, policyConfigMap(stored))
+
+	for _, patch := range []string{`{"UnprocessableFileTypeAction":9}`, `{"UnprocessableFileTypeAction":"block"}`, `[1]`} {
+		if w := patchPolicyWith(newTestHandler(), patch); w.Code != http.StatusBadRequest {
+			t.Errorf("PATCH %s = %d %s, want %d", patch, w.Code, w.Body, http.StatusBadRequest)
+		}
+	}
+	if doc := storedDocument(t, client); doc != stored {
+		t.Errorf("stored policy changed to %s", doc)
+	}
+}
+
+func TestPatchKeepsConcurrentChange(t *testing.T) {
+	client := useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":1}`))
+
+	// the first read sees the policy as it was before another client changed it
+	reads := 0
+	client.PrependReactor("get", "configmaps", func(k8stesting.Action) (bool, runtime.Object, error) {
+		reads++
+		if reads > 1 {
+			return false, nil, nil
+		}
+		return true, policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`), nil
+	})
+
+	w := patchPolicyWith(newTestHandler(), `{"GlasswallBlockedFilesAction":3}`)
+	if w.Code != http.StatusPreconditionFailed {
+		t.Errorf("status = %d, want %d: %s", w.Code, http.StatusPreconditionFailed, w.Body)
+	}
+	if doc := storedDocument(t, client); !strings.Contains(doc, `"UnprocessableFileTypeAction":2`) || !strings.Contains(doc, `"GlasswallBlockedFilesAction":1`) {
+		t.Errorf("stored policy = %s, want the concurrent change kept", doc)
+	}
+}
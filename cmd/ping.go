@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	policy "github.com/filetrust/policy-update-service/pkg"
+	"golang.org/x/time/rate"
+)
+
+// ping is unauthenticated, so it is rate limited across all callers to keep it from
+// being used to load the API server.
+var pingLimiter = rate.NewLimiter(rate.Limit(1), 5)
+
+type pingResponse struct {
+	LatencyMs float64 `json:"latencyMs"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// ping measures the round trip of a config map read against the API server. It reports
+// failures in the body rather than the status so it can be graphed.
+func ping(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Methods", "*")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "*")
+	w.Header().Set("Access-Control-Expose-Headers", "*")
+
+	if !pingLimiter.Allow() {
+		w.Header().Set("Retry-After", "1")
+		writeError(w, http.StatusTooManyRequests, codeRateLimited, "Too many ping requests, retry later.")
+		return
+	}
+
+	var resp pingResponse
+
+	args := policy.PolicyArgs{
+		Namespace:     namespace,
+		ConfigMapName: configmapName,
+	}
+
+	err := args.GetClient()
+	if err == nil {
+		start := time.Now()
+		_, err = args.GetPolicy(r.Context())
+		resp.LatencyMs = float64(time.Since(start)) / float64(time.Millisecond)
+	}
+
+	// the caller is anonymous, so the cause, which can name cluster internals, is only logged
+	if err != nil {
+		loggerFromContext(r.Context()).Printf("Ping of config map %s/%s failed: %v", namespace, configmapName, err)
+		resp.Error = "Unable to read the policy ConfigMap."
+	}
+
+	writeData(w, http.StatusOK, resp, nil)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/time/rate"
+)
+
+func usePingLimiter(t *testing.T) {
+	previous := pingLimiter
+	pingLimiter = rate.NewLimiter(rate.Limit(1), 5)
+	t.Cleanup(func() { pingLimiter = previous })
+}
+
+func TestPing(t *testing.T) {
+	usePingLimiter(t)
+	useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":1}`))
+
+	w := serve(newTestHandler(), httptest.NewRequest("GET", "/api/v1/ping", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+
+	var body struct {
+		Data pingResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Data.Error != "" {
+		t.Errorf("error = %q, want none", body.Data.Error)
+	}
+}
+
+func TestPingHidesErrorDetail(t *testing.T) {
+	usePingLimiter(t)
+	useFakeClient(t)
+	logs := captureLogs(t)
+
+	w := serve(newTestHandler(), httptest.NewRequest("GET", "/api/v1/ping", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	if body := w.Body.String(); !strings.Contains(body, "Unable to read the policy ConfigMap.") || strings.Contains(body, "ncfs-policy") {
+		t.Errorf("body = %s, want only the fixed error message", body)
+	}
+
+	logged := false
+	for _, record := range logs() {
+		if msg, _ := record["msg"].(string); strings.Contains(msg, `configmaps "ncfs-policy" not found`) {
+			logged = true
+		}
+	}
+	if !logged {
+		t.Error("the cause of the failure was not logged")
+	}
+}
@@ -3,48 +3,83 @@ package main
 import (
 	"bytes"
 	"context"
-	"encoding/json"
-	"errors"
+	"crypto/subtle"
+	"crypto/tls"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
+	"math"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
-	"github.com/dgrijalva/jwt-go"
 	policy "github.com/filetrust/policy-update-service/pkg"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/golang/gddo/httputil/header"
-	"github.com/gorilla/mux"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/shaj13/go-guardian/auth"
 	"github.com/shaj13/go-guardian/auth/strategies/basic"
 	"github.com/shaj13/go-guardian/auth/strategies/bearer"
 	"github.com/shaj13/go-guardian/store"
-	metrics "github.com/slok/go-http-metrics/metrics/prometheus"
-	"github.com/slok/go-http-metrics/middleware"
-	negronimiddleware "github.com/slok/go-http-metrics/middleware/negroni"
-	"github.com/urfave/negroni"
 )
 
 var (
 	listeningPort = os.Getenv("LISTENING_PORT")
+	bindAddress   = os.Getenv("BIND_ADDRESS")
 	metricsPort   = os.Getenv("METRICS_PORT")
-	namespace     = os.Getenv("NAMESPACE")
-	configmapName = os.Getenv("CONFIGMAP_NAME")
+	namespace     = strings.TrimSpace(os.Getenv("NAMESPACE"))
+	configmapName = strings.TrimSpace(os.Getenv("CONFIGMAP_NAME"))
 	username      = os.Getenv("USERNAME")
 	password      = os.Getenv("PASSWORD")
 
-	authenticator auth.Authenticator
-	cache         store.Cache
+	defaultUnprocessableFileTypeAction = os.Getenv("DEFAULT_UNPROCESSABLE_FILE_TYPE_ACTION")
+	defaultGlasswallBlockedFilesAction = os.Getenv("DEFAULT_GLASSWALL_BLOCKED_FILES_ACTION")
+	reconcileInterval                  = os.Getenv("RECONCILE_INTERVAL")
+	strictBootValidation               = os.Getenv("STRICT_BOOT_VALIDATION")
+	tokenEndpointEnabled               = os.Getenv("TOKEN_ENDPOINT_ENABLED") != "false"
+	useServerSideApply                 = os.Getenv("USE_SERVER_SIDE_APPLY") == "true"
+
+	// authExemptPaths are served without authentication.
+	authExemptPaths = map[string]bool{
+		"/api/v1/ping": true,
+	}
+
+	defaultPolicy Policy
+)
+
+const (
+	tokenIssuer = "auth-app"
+
+	// policyPath is where the stored policy is read and written.
+	policyPath = "/api/v1/policy"
+
+	// tokenIDExtension carries a bearer token's jti in the authenticated user's extensions.
+	tokenIDExtension = "jti"
+
+	// tokenExpiryExtension carries a bearer token's exp, in Unix seconds, alongside its jti.
+	tokenExpiryExtension = "exp"
 )
 
 type Policy struct {
-	UnprocessableFileTypeAction *int
-	GlasswallBlockedFilesAction *int
+	UnprocessableFileTypeAction *ActionValue `json:"UnprocessableFileTypeAction"`
+	GlasswallBlockedFilesAction *ActionValue `json:"GlasswallBlockedFilesAction"`
+}
+
+// policyKeys lists the config map keys of a split policy, one per Policy field. When
+// nil the policy is stored as one document under appsettings.json.
+var policyKeys []string
+
+func setupPolicyKeys() {
+	if os.Getenv("SPLIT_POLICY_KEYS") == "true" {
+		policyKeys = []string{"UnprocessableFileTypeAction", "GlasswallBlockedFilesAction"}
+	}
 }
 
 func updatePolicy(w http.ResponseWriter, r *http.Request) {
@@ -53,131 +88,261 @@ func updatePolicy(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Headers", "*")
 	w.Header().Set("Access-Control-Expose-Headers", "*")
 
-	if r.Method == "OPTIONS" {
-		return
-	}
-
+	form := false
 	if r.Header.Get("Content-Type") != "" {
 		value, _ := header.ParseValueAndParams(r.Header, "Content-Type")
-		if value != "application/json" {
+		form = acceptFormEncoded && value == formContentType
+		if value != "application/json" && !form {
+			traceValidation(r, "content_type", "rejected", value)
 			msg := "Content-Type header is not application/json"
-			http.Error(w, msg, http.StatusUnsupportedMediaType)
+			writeError(w, http.StatusUnsupportedMediaType, codeUnsupportedMediaType, msg)
 			return
 		}
 	}
 
-	// enforce body size limit
-	r.Body = http.MaxBytesReader(w, r.Body, 1048576)
+	traceValidation(r, "content_type", "ok", r.Header.Get("Content-Type"))
 
-	dec := json.NewDecoder(r.Body)
+	// enforce body size and time limits
+	limitRequestBody(w, r)
 
-	// enforce body properties
-	dec.DisallowUnknownFields()
+	var body io.Reader = r.Body
+	if form {
+		doc, err := formPolicyDocument(r.Body)
+		if err != nil {
+			writeDecodeError(w, err)
+			return
+		}
+		body = strings.NewReader(doc)
+	}
 
-	var p Policy
-	err := dec.Decode(&p)
+	raw, err := ioutil.ReadAll(body)
 	if err != nil {
-		var syntaxError *json.SyntaxError
-		var unmarshalTypeError *json.UnmarshalTypeError
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		switch {
-		case errors.As(err, &syntaxError):
-			msg := fmt.Sprintf("Request body contains badly-formed JSON (at position %d)", syntaxError.Offset)
-			http.Error(w, msg, http.StatusBadRequest)
-		case errors.Is(err, io.ErrUnexpectedEOF):
-			msg := fmt.Sprintf("Request body contains badly-formed JSON")
-			http.Error(w, msg, http.StatusBadRequest)
-		case errors.As(err, &unmarshalTypeError):
-			msg := fmt.Sprintf("Request body contains an invalid value for the %q field (at position %d)", unmarshalTypeError.Field, unmarshalTypeError.Offset)
-			http.Error(w, msg, http.StatusBadRequest)
-		case strings.HasPrefix(err.Error(), "json: unknown field "):
-			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
-			msg := fmt.Sprintf("Request body contains unknown field %s", fieldName)
-			http.Error(w, msg, http.StatusBadRequest)
-		case errors.Is(err, io.EOF):
-			msg := "Request body must not be empty"
-			http.Error(w, msg, http.StatusBadRequest)
-		case err.Error() == "http: request body too large":
-			msg := "Request body must not be larger than 1MB"
-			http.Error(w, msg, http.StatusRequestEntityTooLarge)
-		default:
-			log.Println(err.Error())
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		}
+		writeDecodeError(w, err)
 		return
 	}
 
-	if p.UnprocessableFileTypeAction == nil {
-		http.Error(w, "UnprocessableFileTypeAction is required.", http.StatusBadRequest)
+	raw, bodyReason, err := takeChangeReason(raw)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, codeValidation, err.Error())
 		return
 	}
 
-	if *p.UnprocessableFileTypeAction <= 0 || *p.UnprocessableFileTypeAction >= 5 {
-		http.Error(w, "UnprocessableFileTypeAction must be between 1-4 inclusive.", http.StatusBadRequest)
+	// fields missing from the body are only counted as validation failures once it is
+	// known they can't be filled
+	p, err := decodePolicyFields(bytes.NewReader(raw))
+	var unchanged func(string) error
+	if err == nil && fillMissingFromCurrent && partiallyMissing(p) {
+		var filled bool
+		if p, unchanged, filled = fillFromStored(w, r, p); !filled {
+			return
+		}
+	} else {
+		if err == nil {
+			err = checkPolicy(p)
+		}
+		traceDecodedPolicy(r, p, err)
+		if err != nil {
+			writePolicyError(w, r, err)
+			return
+		}
+	}
+
+	reason, ok := changeReason(w, r, bodyReason)
+	if !ok {
 		return
 	}
 
-	if p.GlasswallBlockedFilesAction == nil {
-		http.Error(w, "GlasswallBlockedFilesAction is required.", http.StatusBadRequest)
+	canary, err := canaryAnnotations(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, codeValidation, err.Error())
 		return
 	}
 
-	if *p.GlasswallBlockedFilesAction <= 0 || *p.GlasswallBlockedFilesAction >= 5 {
-		http.Error(w, "GlasswallBlockedFilesAction  must be between 1-4 inclusive.", http.StatusBadRequest)
+	precondition, err := currentActionPrecondition(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, codeValidation, err.Error())
 		return
 	}
 
-	b := bytes.Buffer{}
-	enc := json.NewEncoder(&b)
-	enc.Encode(p)
-	str := string(b.Bytes())
+	storePolicy(w, r, p, canary, allPreconditions(precondition, unchanged), reason)
+}
+
+// storePolicy writes a validated policy, and any annotations to set with it, to the
+// config map and reports the result. A non-nil precondition must accept the stored
+// policy for the write to happen. The reason for the change is only audited. The
+// response is 201 when the write created the config map, which only server-side apply
+// does, and 200 otherwise.
+func storePolicy(w http.ResponseWriter, r *http.Request, p Policy, annotations map[string]string, precondition func(string) error, reason string) {
+	str := renderPolicy(p)
 
 	args := policy.PolicyArgs{
-		Policy:        str,
-		Namespace:     namespace,
-		ConfigMapName: configmapName,
+		Policy:          str,
+		Namespace:       namespace,
+		ConfigMapName:   configmapName,
+		Annotations:     annotations,
+		ServerSideApply: useServerSideApply,
+		Precondition:    precondition,
+		Written:         recordConfigMapSize,
+		PolicyKeys:      policyKeys,
+		ReplaceData:     updateStrategy == updateStrategyReplace,
+	}
+
+	if !authorizeWrite(w, r) || !checkFreeze(w, r) {
+		return
 	}
 
-	err = args.GetClient()
+	wait, release := reserveChange()
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		writeError(w, http.StatusTooManyRequests, codeRateLimited, fmt.Sprintf("The policy was changed less than %v ago, retry later.", minChangeInterval))
+		return
+	}
+
+	changed := false
+	defer func() { release(changed) }()
+
+	err := args.GetClient()
 	if err != nil {
-		log.Printf("Unable to get client: %v", err)
-		http.Error(w, "Something went wrong getting K8 Client.", http.StatusInternalServerError)
+		loggerFromContext(r.Context()).Printf("Unable to get client: %v", err)
+		writeError(w, http.StatusInternalServerError, codeK8sClient, "Something went wrong getting K8 Client.")
+		return
+	}
+
+	if targetLabelSelector != "" {
+		changed = storePolicyBySelector(w, r, args, reason)
+		if changed {
+			publishPolicyChange(str, policy.Updated.String(), "", requestActor(r))
+			recordAudit(requestUser(r), "policy.updated", fmt.Sprintf("Policy updated in config maps matching %q", targetLabelSelector), reason)
+		}
 		return
 	}
 
-	err = args.UpdatePolicy()
+	result, err := writePolicy(r.Context(), args, requestUser(r), requestActor(r), reason)
 	if err != nil {
-		log.Printf("Unable to update policy: %v", err)
-		http.Error(w, "Something went wrong when updating the config map.", http.StatusInternalServerError)
+		writeConfigMapError(w, err, "Something went wrong when updating the config map.")
+		return
+	}
+	changed = result.Outcome != policy.Unchanged
+
+	status := http.StatusOK
+	if result.Outcome == policy.Created {
+		status = http.StatusCreated
+		w.Header().Set("Location", policyPath)
+	}
+
+	setTargetHeaders(w)
+	if acceptsJSON(r) {
+		meta := targetMeta()
+		meta["outcome"] = result.Outcome.String()
+		meta["resourceVersion"] = result.ResourceVersion
+		writeData(w, status, policyView(p), meta)
 		return
 	}
 
+	w.WriteHeader(status)
+	if result.Outcome == policy.Created {
+		w.Write([]byte("Successfully created config map."))
+		return
+	}
 	w.Write([]byte("Successfully updated config map."))
 }
 
+// writePolicy writes the policy in args to the config map and keeps the records of
+// every write, whether a request or the Git sync makes it: the status and metrics of
+// the latest write, and for a change the Kubernetes event, the audit entry and the
+// event stream. The caller has authorized the write and reserved the change.
+func writePolicy(ctx context.Context, args policy.PolicyArgs, user, actor, reason string) (policy.UpdateResult, error) {
+	previous := previousPolicy(ctx, args)
+
+	result, err := args.UpdatePolicy(ctx)
+	// a failed write may still have reached the config map, so invalidate either way
+	storedPolicyCache.invalidate()
+	recordWrite(err)
+	if err != nil {
+		loggerFromContext(ctx).Printf("Unable to update policy: %v", err)
+		return result, err
+	}
+
+	setLastAppliedPolicy(args.Policy)
+	loggerFromContext(ctx).Printf("Policy in config map %s/%s %s by %s", namespace, configmapName, result.Outcome, withReason(actor, reason))
+	if result.Outcome != policy.Unchanged {
+		recordPolicyEvent(args, "PolicyUpdated", withReason(actor, reason), previous)
+		recordAudit(user, "policy."+result.Outcome.String(), fmt.Sprintf("Policy in config map %s/%s %s, resourceVersion %s", namespace, configmapName, result.Outcome, result.ResourceVersion), reason)
+		publishPolicyChange(args.Policy, result.Outcome.String(), result.ResourceVersion, actor)
+	}
+
+	return result, nil
+}
+
+func getPolicyDefaults(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Methods", "*")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "*")
+	w.Header().Set("Access-Control-Expose-Headers", "*")
+
+	writeData(w, http.StatusOK, policyView(defaultPolicy), nil)
+}
+
 func createToken(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Methods", "*")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Headers", "*")
 	w.Header().Set("Access-Control-Expose-Headers", "*")
 
-	if r.Method == "OPTIONS" {
+	// the token is for whoever authenticated to get it, except that a token issuer
+	// mints tokens for the policy account, whose roles they carry
+	subject := requestUser(r)
+	if tokenIssuerUsername != "" {
+		subject = username
+	}
+	expiresAt := time.Now().Add(tokenLifetime)
+	jti := uuid.New().String()
+	key := tokenSigningKey()
+	if key == nil {
+		writeError(w, http.StatusNotFound, codeNotFound, "This instance verifies tokens but does not issue them.")
 		return
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"iss": "auth-app",
-		"sub": username,
-		"aud": "any",
-		"exp": time.Now().Add(time.Minute * 5).Unix(),
+	// the token carries the roles it was issued with
+	roles := []string{}
+	if id, _ := r.Context().Value(identityKey{}).(identity); id.info != nil && id.info.Groups() != nil {
+		roles = id.info.Groups()
+	}
+
+	token := jwt.NewWithClaims(tokenSigningMethod, jwt.MapClaims{
+		"iss":   tokenIssuer,
+		"sub":   subject,
+		"aud":   tokenAudience,
+		"exp":   expiresAt.Unix(),
+		"jti":   jti,
+		"roles": roles,
 	})
-	jwtToken, _ := token.SignedString([]byte("secret"))
+	jwtToken, err := token.SignedString(key)
+	if err != nil {
+		loggerFromContext(r.Context()).Printf("Unable to sign token: %v", err)
+		writeError(w, http.StatusInternalServerError, codeInternal, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	countActivity(&activity.tokensIssued)
+	loggerFromContext(r.Context()).Printf("Issued token %s to %s for audience %q, expires %s", jti, subject, tokenAudience, expiresAt.UTC().Format(time.RFC3339))
+
+	if acceptsJSON(r) {
+		writeData(w, http.StatusOK, map[string]string{"token": jwtToken}, map[string]interface{}{
+			"expiresAt": expiresAt.UTC().Format(time.RFC3339),
+		})
+		return
+	}
 	w.Write([]byte(jwtToken))
 }
 
 func validateUser(ctx context.Context, r *http.Request, usr, pass string) (auth.Info, error) {
-	if usr == username && pass == password {
-		return auth.NewDefaultUser(usr, "1", nil, nil), nil
+	// compare both in constant time so neither match leaks through response timing
+	userMatch := subtle.ConstantTimeCompare([]byte(usr), []byte(username))
+	passMatch := subtle.ConstantTimeCompare([]byte(pass), []byte(password))
+
+	if userMatch&passMatch == 1 {
+		return auth.NewDefaultUser(usr, "1", ownerRoles(), nil), nil
 	}
 
 	return nil, fmt.Errorf("Invalid credentials")
@@ -185,90 +350,402 @@ func validateUser(ctx context.Context, r *http.Request, usr, pass string) (auth.
 
 func verifyToken(ctx context.Context, r *http.Request, tokenString string) (auth.Info, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		if token.Method != tokenSigningMethod {
 			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
 		}
-		return []byte("secret"), nil
-	})
+		return verificationKeys(), nil
+	},
+		// only the configured algorithm is ever issued, so reject anything else before
+		// the key is used
+		jwt.WithValidMethods([]string{tokenSigningMethod.Alg()}),
+		jwt.WithIssuer(tokenIssuer),
+		jwt.WithAudience(tokenAudience),
+		jwt.WithExpirationRequired(),
+	)
 
 	if err != nil {
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		user := auth.NewDefaultUser(claims["sub"].(string), "", nil, nil)
-		return user, nil
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, fmt.Errorf("Invalid token")
+	}
+
+	sub, err := claims.GetSubject()
+	if err != nil || sub == "" {
+		return nil, fmt.Errorf("Invalid token")
+	}
+
+	extensions := map[string][]string{}
+	if jti, ok := claims["jti"].(string); ok && jti != "" {
+		extensions[tokenIDExtension] = []string{jti}
+	}
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		extensions[tokenExpiryExtension] = []string{strconv.FormatInt(exp.Unix(), 10)}
+	}
+
+	// tokens without roles, such as those issued before roles existed, get none
+	var roles []string
+	if claimed, ok := claims["roles"].([]interface{}); ok {
+		for _, role := range claimed {
+			if name, ok := role.(string); ok {
+				roles = append(roles, name)
+			}
+		}
 	}
 
-	return nil, fmt.Errorf("Invalid token")
+	return auth.NewDefaultUser(sub, "", roles, extensions), nil
 }
 
-func authMiddleware(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+func (s *Server) authMiddleware(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
 	w.Header().Set("Access-Control-Allow-Methods", "*")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Headers", "*")
 	w.Header().Set("Access-Control-Expose-Headers", "*")
 
-	if r.Method == "OPTIONS" {
+	if authExemptPaths[r.URL.Path] {
+		next.ServeHTTP(w, r)
 		return
 	}
-	log.Println("Executing Auth Middleware")
-	user, err := authenticator.Authenticate(r)
+
+	loggerFromContext(r.Context()).Println("Executing Auth Middleware")
+	start := time.Now()
+	user, err := s.authenticatorFor(r).Authenticate(r)
 	if err != nil {
-		code := http.StatusUnauthorized
-		http.Error(w, err.Error(), code)
+		countActivity(&activity.authFailures)
+		delayAuthFailure(r, start)
+		writeError(w, http.StatusUnauthorized, codeUnauthorized, err.Error())
 		return
 	}
 
-	log.Printf("User %s Authenticated\n", user.UserName())
-	next.ServeHTTP(w, r)
+	countActivity(&activity.authSuccesses)
+	loggerFromContext(r.Context()).Printf("User %s Authenticated\n", user.UserName())
+	setAccessLogUser(r, user.UserName())
+	id := identity{user: user.UserName(), info: user}
+	if jti := user.Extensions()[tokenIDExtension]; len(jti) > 0 {
+		id.tokenID = jti[0]
+	}
+
+	ctx := policy.WithLogFields(r.Context(), "user", id.user)
+	next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, identityKey{}, id)))
 }
 
-func setupGoGuardian() {
-	authenticator = auth.New()
-	cache = store.NewFIFO(context.Background(), time.Minute*10)
+type identityKey struct{}
 
-	basicStrategy := basic.New(validateUser, cache)
-	tokenStrategy := bearer.New(verifyToken, cache)
+// identity is who authenticated a request and, for bearer auth, with which token.
+type identity struct {
+	user    string
+	tokenID string
+	info    auth.Info
+}
+
+// requestUser returns the name of the user that authenticated r, or "" on routes
+// served without authentication.
+func requestUser(r *http.Request) string {
+	id, _ := r.Context().Value(identityKey{}).(identity)
+	return id.user
+}
+
+// requestActor describes who made a change for audit entries. For bearer auth it
+// includes the token's jti, which links back to the entry logged when it was issued.
+func requestActor(r *http.Request) string {
+	id, _ := r.Context().Value(identityKey{}).(identity)
+	switch {
+	case id.user == "":
+		return "-"
+	case id.tokenID != "":
+		return fmt.Sprintf("%s (token %s)", id.user, id.tokenID)
+	case id.info != nil && len(id.info.Extensions()[gatewayExtension]) > 0:
+		return fmt.Sprintf("%s (gateway)", id.user)
+	default:
+		return fmt.Sprintf("%s (basic auth, no token)", id.user)
+	}
+}
+
+// parseDefaultAction reads an optional default action value, leaving it nil when unset.
+func parseDefaultAction(name, value string) (*ActionValue, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	action, ok := parseActionValue(value)
+	if !ok {
+		return nil, fmt.Errorf("%s must be between %d-%d inclusive", name, minPolicyAction, maxPolicyAction)
+	}
+
+	return &action, nil
+}
+
+func setupDefaults() error {
+	var err error
+
+	defaultPolicy.UnprocessableFileTypeAction, err = parseDefaultAction("DEFAULT_UNPROCESSABLE_FILE_TYPE_ACTION", defaultUnprocessableFileTypeAction)
+	if err != nil {
+		return err
+	}
+
+	defaultPolicy.GlasswallBlockedFilesAction, err = parseDefaultAction("DEFAULT_GLASSWALL_BLOCKED_FILES_ACTION", defaultGlasswallBlockedFilesAction)
+	return err
+}
 
+// newAuthenticator creates the default authenticator: basic auth, bearer tokens when
+// anything can issue them, and gateway identity headers when trusted.
+func newAuthenticator() auth.Authenticator {
+	authenticator := auth.New()
+	cache := newFlushableCache(store.NewFIFO(context.Background(), time.Minute*10))
+	authCaches = append(authCaches, cache)
+
+	basicStrategy := basic.New(validateUser, cache)
 	authenticator.EnableStrategy(basic.StrategyKey, basicStrategy)
-	authenticator.EnableStrategy(bearer.CachedStrategyKey, tokenStrategy)
+
+	// without the token endpoint nothing issues JWTs, so only service and Kubernetes
+	// tokens can be accepted
+	if tokenEndpointEnabled || tokenReviewAuth || serviceTokenStore != nil {
+		tokenStrategy := bearer.New(verifyBearer, cache)
+		authenticator.EnableStrategy(bearer.CachedStrategyKey, tokenStrategy)
+	}
+
+	if trustGatewayIdentity {
+		authenticator.EnableStrategy(gatewayStrategyKey, gatewayStrategy{})
+	}
+
+	return authenticator
 }
 
 func main() {
-	if listeningPort == "" || metricsPort == "" || namespace == "" || configmapName == "" || username == "" || password == "" {
-		log.Fatalf("init failed: LISTENTING_PORT, METRICS_PORT, NAMESPACE, CONFIGMAP_NAME, USERNAME or PASSWORD environment variables not set")
+	setupLogging()
+
+	if (listeningPort == "" && bindAddress == "") || metricsPort == "" || namespace == "" || configmapName == "" || username == "" || password == "" {
+		log.Fatalf("init failed: LISTENTING_PORT (or BIND_ADDRESS), METRICS_PORT, NAMESPACE, CONFIGMAP_NAME, USERNAME or PASSWORD environment variables not set")
 	}
 
-	log.Printf("Listening on port with TLS :%v", listeningPort)
+	if err := policy.ValidateNames(namespace, configmapName); err != nil {
+		log.Fatalf("init failed: %v", err)
+	}
 
-	mdlw := middleware.New(middleware.Config{
-		Recorder: metrics.NewRecorder(metrics.Config{}),
-		Service:  "ncfs-policy-update-service",
-	})
+	setupPolicyKeys()
+
+	if err := setupUpdateStrategy(); err != nil {
+		log.Fatalf("init failed: %v", err)
+	}
+
+	if err := setupUnknownFields(); err != nil {
+		log.Fatalf("init failed: %v", err)
+	}
+
+	setupWebUI()
+
+	if err := setupRootPath(); err != nil {
+		log.Fatalf("init failed: %v", err)
+	}
+
+	setupTokenAudience()
+
+	if err := setupRoles(); err != nil {
+		log.Fatalf("init failed: %v", err)
+	}
+
+	if err := setupSigning(); err != nil {
+		log.Fatalf("init failed: %v", err)
+	}
+
+	if err := setupJWTSecret(); err != nil {
+		log.Fatalf("init failed: %v", err)
+	}
+
+	if err := setupSecretRotation(); err != nil {
+		log.Fatalf("init failed: %v", err)
+	}
+
+	if err := setupMessages(); err != nil {
+		log.Fatalf("init failed: %v", err)
+	}
+
+	if err := setupPolicyRules(); err != nil {
+		log.Fatalf("init failed: %v", err)
+	}
+
+	if err := setupDefaults(); err != nil {
+		log.Fatalf("init failed: %v", err)
+	}
+
+	if err := setupChangeThrottle(); err != nil {
+		log.Fatalf("init failed: %v", err)
+	}
+
+	if err := setupFreezeWindows(); err != nil {
+		log.Fatalf("init failed: %v", err)
+	}
+
+	if err := setupNonces(); err != nil {
+		log.Fatalf("init failed: %v", err)
+	}
+
+	if err := setupAuthFailureDelay(); err != nil {
+		log.Fatalf("init failed: %v", err)
+	}
+
+	if err := setupGatewayIdentity(); err != nil {
+		log.Fatalf("init failed: %v", err)
+	}
+
+	if err := setupHeaderLimits(); err != nil {
+		log.Fatalf("init failed: %v", err)
+	}
+
+	if err := setupConcurrencyLimits(); err != nil {
+		log.Fatalf("init failed: %v", err)
+	}
+
+	if err := setupFieldCase(); err != nil {
+		log.Fatalf("init failed: %v", err)
+	}
+
+	if err := setupShutdownTimeout(); err != nil {
+		log.Fatalf("init failed: %v", err)
+	}
+
+	if err := setupPolicyTemplates(); err != nil {
+		log.Fatalf("init failed: %v", err)
+	}
 
-	setupGoGuardian()
-	router := mux.NewRouter()
-	router.HandleFunc("/api/v1/auth/token", createToken).Methods("GET", "OPTIONS")
-	router.HandleFunc("/api/v1/policy", updatePolicy).Methods("PUT", "OPTIONS")
+	if err := setupPolicyCache(); err != nil {
+		log.Fatalf("init failed: %v", err)
+	}
+
+	if err := setupTokenIssuer(); err != nil {
+		log.Fatalf("init failed: %v", err)
+	}
+
+	if err := setupTokenReview(); err != nil {
+		log.Fatalf("init failed: %v", err)
+	}
+
+	if err := setupServiceTokens(); err != nil {
+		log.Fatalf("init failed: %v", err)
+	}
+
+	if err := setupSubjectAccessReview(); err != nil {
+		log.Fatalf("init failed: %v", err)
+	}
+
+	if err := setupRequestTimeout(); err != nil {
+		log.Fatalf("init failed: %v", err)
+	}
+
+	if err := setupEventStreams(); err != nil {
+		log.Fatalf("init failed: %v", err)
+	}
+
+	if err := setupAuditLog(); err != nil {
+		log.Fatalf("init failed: %v", err)
+	}
+
+	if err := setupCompareNamespaces(); err != nil {
+		log.Fatalf("init failed: %v", err)
+	}
+
+	if err := setupOutboundClient(); err != nil {
+		log.Fatalf("init failed: %v", err)
+	}
+
+	if err := setupGitPolicySource(); err != nil {
+		log.Fatalf("init failed: %v", err)
+	}
+
+	if err := setupTargets(); err != nil {
+		log.Fatalf("init failed: %v", err)
+	}
+
+	// registered before the startup checks so they can already record metrics
+	if m, err := registerMetrics(prometheus.DefaultRegisterer); err != nil {
+		log.Printf("Unable to register metrics, continuing without service metrics: %v", err)
+	} else {
+		svcMetrics = m
+	}
+
+	if err := seedPolicy(); err != nil {
+		log.Fatalf("init failed: %v", err)
+	}
+
+	if err := validateStoredPolicy(); err != nil {
+		if strictBootValidation == "true" {
+			log.Fatalf("init failed: %v", err)
+		}
+
+		log.Printf("WARNING: %v", err)
+	}
+
+	addr, err := listenAddress(bindAddress, listeningPort)
+	if err != nil {
+		log.Fatalf("init failed: %v", err)
+	}
+
+	log.Printf("Listening with TLS on %v", addr)
+
+	s, err := NewServer()
+	if err != nil {
+		log.Fatalf("init failed: %v", err)
+	}
+
+	reloader, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		log.Fatalf("init failed: unable to load TLS certificate: %v", err)
+	}
 
-	n := negroni.New()
-	n.Use(negroni.NewRecovery())
-	n.Use(negroni.NewLogger())
-	n.Use(negronimiddleware.Handler("", mdlw))
-	n.Use(negroni.HandlerFunc(authMiddleware))
-	n.UseHandler(router)
+	server := &http.Server{
+		Addr:      addr,
+		Handler:   s.Handler(),
+		TLSConfig: &tls.Config{GetCertificate: reloader.GetCertificate},
+		// cuts off a request body that stops arriving altogether
+		ReadTimeout: requestTimeout,
+		// stops reading headers far beyond MAX_HEADER_BYTES before they are buffered;
+		// net/http allows 4096 bytes more, so headerLimitsMiddleware answers the rest
+		MaxHeaderBytes: maxHeaderBytes,
+	}
+	// event streams only end when their client leaves, so end them on shutdown
+	server.RegisterOnShutdown(policyEvents.close)
+
+	metricsServer := &http.Server{
+		Addr: fmt.Sprintf(":%v", metricsPort),
+		// scrapers that ask for OpenMetrics get it, everyone else the text format
+		Handler: promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+			promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true})),
+	}
 
 	go func() {
-		log.Printf("server listening at %v", listeningPort)
-		if err := http.ListenAndServeTLS(fmt.Sprintf(":%v", listeningPort), "/etc/ssl/certs/server.crt", "/etc/ssl/private/server.key", n); err != nil {
+		log.Printf("server listening at %v", addr)
+		if err := server.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("error while serving: %s", err)
 		}
 	}()
 
+	// every background goroutine observes ctx, which is cancelled on shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	tasks := newBackgroundTasks()
+
+	if reconcileInterval != "" {
+		interval, err := time.ParseDuration(reconcileInterval)
+		if err != nil || interval <= 0 {
+			log.Fatalf("init failed: RECONCILE_INTERVAL must be a positive duration")
+		}
+
+		log.Printf("Reconciling policy every %v", interval)
+		tasks.start(ctx, "reconciler", func(ctx context.Context) {
+			runReconciler(ctx, interval)
+		})
+	}
+
+	if gitPolicyURL != "" {
+		tasks.start(ctx, "git policy sync", func(ctx context.Context) {
+			runGitPolicySync(ctx, gitPollInterval)
+		})
+	}
+
 	go func() {
 		log.Printf("server listening at %v", metricsPort)
-		if err := http.ListenAndServe(fmt.Sprintf(":%v", metricsPort), promhttp.Handler()); err != nil {
+		if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("error while serving: %s", err)
 		}
 	}()
@@ -276,5 +753,10 @@ func main() {
 	// Wait until some signal is captured.
 	sigC := make(chan os.Signal, 1)
 	signal.Notify(sigC, syscall.SIGTERM, syscall.SIGINT)
-	<-sigC
+	sig := <-sigC
+
+	log.Printf("Received %v, shutting down", sig)
+	shutdown(server, cancel, tasks)
+
+	metricsServer.Close()
 }
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	policy "github.com/filetrust/policy-update-service/pkg"
+)
+
+// policyCacheTTL is how long a policy read from the config map is served from memory.
+// Zero, the default, disables the cache.
+var policyCacheTTL time.Duration
+
+var storedPolicyCache policyCache
+
+// policyCache holds the last policy read from the config map. Writes through this
+// service invalidate it; the generation keeps a read that started before a write from
+// caching the value the write replaced.
+type policyCache struct {
+	mu         sync.Mutex
+	stored     policy.StoredPolicy
+	expires    time.Time
+	generation uint64
+}
+
+func setupPolicyCache() error {
+	var err error
+	policyCacheTTL, err = optionalDurationFromEnv("POLICY_CACHE_TTL")
+	return err
+}
+
+// get returns the cached policy when it is still fresh, and the generation to pass to
+// set after reading it from the config map otherwise.
+func (c *policyCache) get() (policy.StoredPolicy, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if policyCacheTTL == 0 || time.Now().After(c.expires) {
+		return policy.StoredPolicy{}, c.generation, false
+	}
+
+	return c.stored, c.generation, true
+}
+
+func (c *policyCache) set(stored policy.StoredPolicy, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if policyCacheTTL == 0 || generation != c.generation {
+		return
+	}
+
+	c.stored = stored
+	c.expires = time.Now().Add(policyCacheTTL)
+}
+
+func (c *policyCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.expires = time.Time{}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// usePolicyCache sets POLICY_CACHE_TTL to ttl for the rest of the test.
+func usePolicyCache(t *testing.T, ttl time.Duration) {
+	previous := policyCacheTTL
+	policyCacheTTL = ttl
+	storedPolicyCache.invalidate()
+	t.Cleanup(func() {
+		policyCacheTTL = previous
+		storedPolicyCache.invalidate()
+	})
+}
+
+// configMapReads returns how often the policy config map was read from client.
+func configMapReads(client *fake.Clientset) int {
+	reads := 0
+	for _, action := range client.Actions() {
+		if action.Matches("get", "configmaps") {
+			reads++
+		}
+	}
+
+	return reads
+}
+
+// changeStoredPolicy writes doc to the config map behind the service's back.
+func changeStoredPolicy(t *testing.T, client *fake.Clientset, doc string) {
+	if _, err := client.CoreV1().ConfigMaps(namespace).Update(context.Background(), policyConfigMap(doc), metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func getPolicyBody(t *testing.T, handler http.Handler) string {
+	w := serve(handler, asAdmin(httptest.NewRequest("GET", policyPath, nil)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET status = %d: %s", w.Code, w.Body)
+	}
+
+	return w.Body.String()
+}
+
+func TestPolicyCacheHitAndMiss(t *testing.T) {
+	client := useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`))
+	usePolicyCache(t, 100*time.Millisecond)
+	handler := newTestHandler()
+
+	getPolicyBody(t, handler)
+	if reads := configMapReads(client); reads != 1 {
+		t.Fatalf("first GET read the config map %d times, want 1", reads)
+	}
+
+	// a fresh entry is served without asking the API server, even if it changed since
+	changeStoredPolicy(t, client, `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":1}`)
+	if body := getPolicyBody(t, handler); !strings.Contains(body, `"UnprocessableFileTypeAction":1`) {
+		t.Errorf("cached GET = %s, want the cached policy", body)
+	}
+	if reads := configMapReads(client); reads != 1 {
+		t.Errorf("cached GET read the config map, %d reads", reads)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if body := getPolicyBody(t, handler); !strings.Contains(body, `"UnprocessableFileTypeAction":2`) {
+		t.Errorf("GET after the TTL = %s, want the changed policy", body)
+	}
+	if reads := configMapReads(client); reads != 2 {
+		t.Errorf("GET after the TTL made %d reads in total, want 2", reads)
+	}
+}
+
+func TestPolicyCacheInvalidatedByWrite(t *testing.T) {
+	useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`))
+	usePolicyCache(t, time.Minute)
+	handler := newTestHandler()
+
+	getPolicyBody(t, handler)
+	if w := putPolicy(handler, `{"UnprocessableFileTypeAction":3,"GlasswallBlockedFilesAction":1}`); w.Code != http.StatusOK {
+		t.Fatalf("PUT status = %d: %s", w.Code, w.Body)
+	}
+
+	if body := getPolicyBody(t, handler); !strings.Contains(body, `"UnprocessableFileTypeAction":3`) {
+		t.Errorf("GET after a PUT = %s, want the written policy", body)
+	}
+}
+
+func TestPolicyCacheDisabled(t *testing.T) {
+	client := useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`))
+	usePolicyCache(t, 0)
+	handler := newTestHandler()
+
+	getPolicyBody(t, handler)
+	getPolicyBody(t, handler)
+	if reads := configMapReads(client); reads != 2 {
+		t.Errorf("two GETs read the config map %d times, want 2", reads)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+var pprofEnabled = os.Getenv("PPROF_ENABLED") == "true"
+
+// registerPprof serves the runtime profiles under /debug/pprof on the API router, so
+// they sit behind the same authentication as the policy routes and require the
+// admin role. Nothing is served on the unauthenticated metrics port. The profiles are
+// written with runtime/pprof, as importing net/http/pprof would also register them on
+// http.DefaultServeMux.
+func registerPprof(router *mux.Router) {
+	router.HandleFunc("/debug/pprof/", requireAdmin(pprofIndex)).Methods("GET")
+	router.HandleFunc("/debug/pprof/cmdline", requireAdmin(pprofCmdline)).Methods("GET")
+	router.HandleFunc("/debug/pprof/profile", requireAdmin(pprofCPU)).Methods("GET")
+	router.HandleFunc("/debug/pprof/trace", requireAdmin(pprofTrace)).Methods("GET")
+	router.HandleFunc("/debug/pprof/{name}", requireAdmin(pprofProfile)).Methods("GET")
+}
+
+// pprofIndex lists the profiles with their current counts.
+func pprofIndex(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, p := range pprof.Profiles() {
+		fmt.Fprintf(w, "%d\t%s\n", p.Count(), p.Name())
+	}
+	fmt.Fprintln(w, "-\tprofile (CPU, for ?seconds=)")
+	fmt.Fprintln(w, "-\ttrace (execution trace, for ?seconds=)")
+}
+
+func pprofCmdline(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, strings.Join(os.Args, "\x00"))
+}
+
+// pprofProfile writes a named profile, such as heap or goroutine, in the binary
+// format, or as text with ?debug=1. ?gc=1 runs a garbage collection first.
+func pprofProfile(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	p := pprof.Lookup(name)
+	if p == nil {
+		notFound(w, r)
+		return
+	}
+
+	debug, _ := strconv.Atoi(r.URL.Query().Get("debug"))
+	if gc, _ := strconv.Atoi(r.URL.Query().Get("gc")); gc > 0 && name == "heap" {
+		runtime.GC()
+	}
+
+	if debug != 0 {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	}
+
+	p.WriteTo(w, debug)
+}
+
+// pprofCPU profiles the CPU for ?seconds= (default 5, to stay within REQUEST_TIMEOUT).
+func pprofCPU(w http.ResponseWriter, r *http.Request) {
+	seconds, ok := profileSeconds(w, r, 5)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="profile"`)
+	if err := pprof.StartCPUProfile(w); err != nil {
+		writeError(w, http.StatusConflict, codeConflict, fmt.Sprintf("Unable to start a CPU profile: %v.", err))
+		return
+	}
+
+	waitProfile(r, seconds)
+	pprof.StopCPUProfile()
+}
+
+// pprofTrace records an execution trace for ?seconds= (default 1).
+func pprofTrace(w http.ResponseWriter, r *http.Request) {
+	seconds, ok := profileSeconds(w, r, 1)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="trace"`)
+	if err := trace.Start(w); err != nil {
+		writeError(w, http.StatusConflict, codeConflict, fmt.Sprintf("Unable to start a trace: %v.", err))
+		return
+	}
+
+	waitProfile(r, seconds)
+	trace.Stop()
+}
+
+// profileSeconds reads the duration of a CPU profile or trace, which must end before
+// the request times out, writing the error response if it is invalid.
+func profileSeconds(w http.ResponseWriter, r *http.Request, def int) (time.Duration, bool) {
+	seconds := def
+	if value := r.URL.Query().Get("seconds"); value != "" {
+		var err error
+		if seconds, err = strconv.Atoi(value); err != nil || seconds <= 0 {
+			writeError(w, http.StatusBadRequest, codeValidation, "seconds must be a positive integer.")
+			return 0, false
+		}
+	}
+
+	d := time.Duration(seconds) * time.Second
+	if deadline, ok := r.Context().Deadline(); ok && time.Until(deadline) <= d {
+		writeError(w, http.StatusBadRequest, codeValidation, fmt.Sprintf("seconds must be less than REQUEST_TIMEOUT (%v).", requestTimeout))
+		return 0, false
+	}
+
+	return d, true
+}
+
+// waitProfile waits while a profile is recorded, stopping early if the client leaves.
+func waitProfile(r *http.Request, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-r.Context().Done():
+	}
+}
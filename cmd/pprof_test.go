@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// usePprof sets PPROF_ENABLED for the rest of the test.
+func usePprof(t *testing.T, enabled bool) {
+	previous := pprofEnabled
+	pprofEnabled = enabled
+	t.Cleanup(func() { pprofEnabled = previous })
+}
+
+func TestPprofNotFoundWhenDisabled(t *testing.T) {
+	usePprof(t, false)
+	h := newTestHandler()
+
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/heap", "/debug/pprof/profile"} {
+		if w := serve(h, asAdmin(httptest.NewRequest("GET", path, nil))); w.Code != http.StatusNotFound {
+			t.Errorf("GET %s status = %d, want %d", path, w.Code, http.StatusNotFound)
+		}
+	}
+}
+
+func TestPprofRequiresAuth(t *testing.T) {
+	usePprof(t, true)
+	h := newTestHandler()
+
+	if w := serve(h, httptest.NewRequest("GET", "/debug/pprof/heap", nil)); w.Code != http.StatusUnauthorized {
+		t.Errorf("unauthenticated status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	w := serve(h, asAdmin(httptest.NewRequest("GET", "/debug/pprof/heap?debug=1", nil)))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "heap profile") {
+		t.Errorf("admin status = %d, want %d with the heap profile", w.Code, http.StatusOK)
+	}
+}
+
+func TestPprofRequiresAdminRole(t *testing.T) {
+	usePprof(t, true)
+	router := (&Server{}).Router()
+
+	tests := []struct {
+		path   string
+		groups []string
+		want   int
+	}{
+		{path: "/debug/pprof/", groups: []string{roleWriter}, want: http.StatusForbidden},
+		{path: "/debug/pprof/goroutine", groups: []string{roleReader}, want: http.StatusForbidden},
+		{path: "/debug/pprof/", groups: []string{roleAdmin}, want: http.StatusOK},
+		{path: "/debug/pprof/goroutine?debug=1", groups: []string{roleAdmin}, want: http.StatusOK},
+		{path: "/debug/pprof/nonexistent", groups: []string{roleAdmin}, want: http.StatusNotFound},
+		{path: "/debug/pprof/profile?seconds=0", groups: []string{roleAdmin}, want: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			r := withIdentity(httptest.NewRequest("GET", tt.path, nil), "someone", tt.groups...)
+			if w := serve(router, r); w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// currentActionPrecondition reads the If-Current-Unprocessable-Action header of a PUT,
+// which makes the update a compare-and-swap on the stored UnprocessableFileTypeAction.
+// It returns nil when the header is absent.
+func currentActionPrecondition(r *http.Request) (func(string) error, error) {
+	value := r.Header.Get("If-Current-Unprocessable-Action")
+	if value == "" {
+		return nil, nil
+	}
+
+	expected, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, errors.New("If-Current-Unprocessable-Action must be an integer.")
+	}
+
+	return func(current string) error {
+		var stored Policy
+		if current != "" {
+			var err error
+			if stored, err = decodeStoredPolicy(current); err != nil {
+				return errors.New("Stored policy is not valid JSON.")
+			}
+		}
+
+		if stored.UnprocessableFileTypeAction == nil {
+			return fmt.Errorf("UnprocessableFileTypeAction is not set, expected %d.", expected)
+		}
+
+		if *stored.UnprocessableFileTypeAction != ActionValue(expected) {
+			return fmt.Errorf("UnprocessableFileTypeAction is %d, expected %d.", *stored.UnprocessableFileTypeAction, expected)
+		}
+
+		return nil
+	}, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// putPolicyIfCurrent PUTs body with an If-Current-Unprocessable-Action header of current.
+func putPolicyIfCurrent(handler http.Handler, body, current string) *httptest.ResponseRecorder {
+	r := asAdmin(httptest.NewRequest("PUT", policyPath, strings.NewReader(body)))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("If-Current-Unprocessable-Action", current)
+	return serve(handler, r)
+}
+
+func TestIfCurrentActionMatches(t *testing.T) {
+	client := useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":1}`))
+
+	w := putPolicyIfCurrent(newTestHandler(), `{"UnprocessableFileTypeAction":3,"GlasswallBlockedFilesAction":1}`, "2")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	if doc := storedDocument(t, client); !strings.Contains(doc, `"UnprocessableFileTypeAction":3`) {
+		t.Errorf("stored policy = %s, want the update applied", doc)
+	}
+}
+
+func TestIfCurrentActionMismatch(t *testing.T) {
+	doc := `{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`
+	client := useFakeClient(t, policyConfigMap(doc))
+
+	w := putPolicyIfCurrent(newTestHandler(), `{"UnprocessableFileTypeAction":3,"GlasswallBlockedFilesAction":1}`, "2")
+	if w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusPreconditionFailed, w.Body)
+	}
+
+	var resp errorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Code != codePreconditionFailed || resp.Message != "UnprocessableFileTypeAction is 1, expected 2." {
+		t.Errorf("body = %s, want the stored and expected values", w.Body)
+	}
+	if got := storedDocument(t, client); got != doc {
+		t.Errorf("stored policy = %s, want it unchanged", got)
+	}
+}
+
+func TestIfCurrentActionInvalid(t *testing.T) {
+	useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`))
+
+	w := putPolicyIfCurrent(newTestHandler(), `{"UnprocessableFileTypeAction":3,"GlasswallBlockedFilesAction":1}`, "two")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	policy "github.com/filetrust/policy-update-service/pkg"
+)
+
+// setTargetHeaders identifies the config map a response refers to.
+func setTargetHeaders(w http.ResponseWriter) {
+	w.Header().Set("X-ConfigMap-Namespace", namespace)
+	w.Header().Set("X-ConfigMap-Name", configmapName)
+}
+
+// targetMeta identifies the config map a response refers to in the envelope meta.
+func targetMeta() map[string]interface{} {
+	return map[string]interface{}{
+		"namespace":     namespace,
+		"configMapName": configmapName,
+	}
+}
+
+// loadStoredPolicy reads the raw policy document and annotations from the config map.
+// When it can't, it writes the error response and returns false.
+func loadStoredPolicy(w http.ResponseWriter, r *http.Request) (policy.StoredPolicy, bool) {
+	stored, generation, ok := storedPolicyCache.get()
+	if ok {
+		return checkStoredPolicy(w, r, stored)
+	}
+
+	args := policy.PolicyArgs{
+		Namespace:     namespace,
+		ConfigMapName: configmapName,
+		PolicyKeys:    policyKeys,
+	}
+
+	err := args.GetClient()
+	if err != nil {
+		loggerFromContext(r.Context()).Printf("Unable to get client: %v", err)
+		writeError(w, http.StatusInternalServerError, codeK8sClient, "Something went wrong getting K8 Client.")
+		return policy.StoredPolicy{}, false
+	}
+
+	stored, err = args.GetStoredPolicy(r.Context())
+	if err != nil {
+		loggerFromContext(r.Context()).Printf("Unable to read policy: %v", err)
+		writeConfigMapError(w, err, "Something went wrong when reading the config map.")
+		return stored, false
+	}
+
+	storedPolicyCache.set(stored, generation)
+	return checkStoredPolicy(w, r, stored)
+}
+
+// checkStoredPolicy writes a not found response when no policy has been stored yet.
+func checkStoredPolicy(w http.ResponseWriter, r *http.Request, stored policy.StoredPolicy) (policy.StoredPolicy, bool) {
+	if stored.Policy == "" {
+		writeLocalizedError(w, r, http.StatusNotFound, codeNotFound, localizedError{key: msgNoPolicyStored})
+		return stored, false
+	}
+
+	return stored, true
+}
+
+// parseStoredPolicy decodes a stored policy document with decodeStoredPolicy, writing
+// the error response and returning false when it isn't valid JSON.
+func parseStoredPolicy(w http.ResponseWriter, current string) (Policy, bool) {
+	p, err := decodeStoredPolicy(current)
+	if err != nil {
+		log.Printf("Unable to parse stored policy: %s", redactPolicyError(err))
+		writeError(w, http.StatusInternalServerError, codeConfigMap, "Stored policy is not valid JSON.")
+		return p, false
+	}
+
+	return p, true
+}
+
+// storedActions mirrors Policy with the raw action values, so a stored document is
+// read even if it holds values a request could not set, e.g. written by hand.
+type storedActions struct {
+	UnprocessableFileTypeAction json.RawMessage
+	GlasswallBlockedFilesAction json.RawMessage
+}
+
+// decodeStoredPolicy decodes a stored policy document leniently, where decodePolicy
+// decodes a request strictly: an out of range action is kept, to be reported and
+// replaced, and an action that isn't a whole number is left out, as if missing. It
+// only fails if the document isn't a JSON object.
+func decodeStoredPolicy(current string) (Policy, error) {
+	var stored storedActions
+	if err := json.Unmarshal([]byte(current), &stored); err != nil {
+		return Policy{}, err
+	}
+
+	return Policy{
+		UnprocessableFileTypeAction: storedAction(stored.UnprocessableFileTypeAction),
+		GlasswallBlockedFilesAction: storedAction(stored.GlasswallBlockedFilesAction),
+	}, nil
+}
+
+// validateStoredDocument decodes a stored policy as decodeStoredPolicy does and
+// validates it, returning a *validationError if it fails. Unlike decodePolicy it counts no
+// validation failures and ignores UNKNOWN_FIELDS, so the health checks of a stored
+// policy neither raise the metric alerts are based on nor depend on request settings.
+func validateStoredDocument(current string) error {
+	p, err := decodeStoredPolicy(current)
+	if err != nil {
+		return err
+	}
+
+	if _, err := policyFailures(p); err != nil {
+		return &validationError{err: err}
+	}
+
+	return nil
+}
+
+// storedAction returns a stored action value if it is a whole number that fits an
+// ActionValue, in range or not, and nil otherwise.
+func storedAction(raw json.RawMessage) *ActionValue {
+	if len(raw) == 0 || jsonKind(raw) != "number" {
+		return nil
+	}
+
+	f, err := strconv.ParseFloat(string(raw), 64)
+	if err != nil || f != math.Trunc(f) || f < math.MinInt32 || f > math.MaxInt32 {
+		return nil
+	}
+
+	a := ActionValue(f)
+	return &a
+}
+
+func getPolicy(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Methods", "*")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "*")
+	w.Header().Set("Access-Control-Expose-Headers", "*")
+
+	stored, ok := loadStoredPolicy(w, r)
+	if !ok {
+		return
+	}
+
+	if !stored.LastModified.IsZero() {
+		w.Header().Set("Last-Modified", stored.LastModified.UTC().Format(http.TimeFormat))
+		if notModifiedSince(r, stored.LastModified) {
+			setTargetHeaders(w)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	p, ok := parseStoredPolicy(w, stored.Policy)
+	if !ok {
+		return
+	}
+
+	meta := targetMeta()
+	if percent := canaryPercentFromAnnotations(stored.Annotations); percent != nil {
+		meta["canaryPercent"] = *percent
+	}
+	if !stored.CreationTimestamp.IsZero() {
+		meta["creationTimestamp"] = stored.CreationTimestamp.UTC().Format(time.RFC3339)
+		meta["lastModified"] = stored.LastModified.UTC().Format(time.RFC3339)
+	}
+
+	setTargetHeaders(w)
+	writeData(w, http.StatusOK, policyView(p), meta)
+}
+
+// notModifiedSince reports whether r has an If-Modified-Since header and nothing has
+// been modified since then. HTTP dates have whole seconds, so neither has lastModified.
+func notModifiedSince(r *http.Request, lastModified time.Time) bool {
+	value := r.Header.Get("If-Modified-Since")
+	if value == "" {
+		return false
+	}
+
+	since, err := http.ParseTime(value)
+	if err != nil {
+		return false
+	}
+
+	return !lastModified.Truncate(time.Second).After(since)
+}
+
+func exportPolicy(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Methods", "*")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "*")
+	w.Header().Set("Access-Control-Expose-Headers", "*")
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "ncfs" {
+		writeError(w, http.StatusBadRequest, codeValidation, "format must be one of json, ncfs.")
+		return
+	}
+
+	stored, ok := loadStoredPolicy(w, r)
+	if !ok {
+		return
+	}
+
+	current := stored.Policy
+	setTargetHeaders(w)
+
+	// The ncfs format is the document exactly as NCFS reads it from the config map.
+	if format == "ncfs" {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="appsettings.json"`)
+		w.Write([]byte(current))
+		return
+	}
+
+	p, ok := parseStoredPolicy(w, current)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(policyView(p))
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	policyCreated  = time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	policyModified = time.Date(2024, 5, 20, 14, 30, 0, 0, time.UTC)
+)
+
+// timestampedConfigMap returns the policy config map created at policyCreated and
+// written at each of the managed field times.
+func timestampedConfigMap(written ...time.Time) *corev1.ConfigMap {
+	configMap := policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`)
+	configMap.CreationTimestamp = metav1.NewTime(policyCreated)
+	for i, at := range written {
+		configMap.ManagedFields = append(configMap.ManagedFields, metav1.ManagedFieldsEntry{
+			Manager:   []string{"kubectl-edit", "ncfs-policy-update-service"}[i%2],
+			Operation: metav1.ManagedFieldsOperationUpdate,
+			Time:      &metav1.Time{Time: at},
+		})
+	}
+
+	return configMap
+}
+
+// policyMeta returns the meta of a GET of the policy.
+func policyMeta(t *testing.T) map[string]interface{} {
+	w := serve(newTestHandler(), asAdmin(httptest.NewRequest("GET", policyPath, nil)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+
+	var resp struct {
+		Meta map[string]interface{} `json:"meta"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	return resp.Meta
+}
+
+func TestPolicyTimestamps(t *testing.T) {
+	// the latest write of any manager counts, whichever order they are listed in
+	useFakeClient(t, timestampedConfigMap(policyModified, policyCreated.Add(time.Hour)))
+
+	meta := policyMeta(t)
+	if meta["creationTimestamp"] != "2024-03-01T09:00:00Z" || meta["lastModified"] != "2024-05-20T14:30:00Z" {
+		t.Errorf("meta = %v, want the creation time and the latest write", meta)
+	}
+}
+
+func TestPolicyTimestampsWithoutHistory(t *testing.T) {
+	useFakeClient(t, timestampedConfigMap())
+
+	meta := policyMeta(t)
+	if meta["creationTimestamp"] != "2024-03-01T09:00:00Z" || meta["lastModified"] != "2024-03-01T09:00:00Z" {
+		t.Errorf("meta = %v, want lastModified to fall back to the creation time", meta)
+	}
+}
+
+// getIfModifiedSince GETs the policy with an If-Modified-Since header of since.
+func getIfModifiedSince(since string) *httptest.ResponseRecorder {
+	r := asAdmin(httptest.NewRequest("GET", policyPath, nil))
+	if since != "" {
+		r.Header.Set("If-Modified-Since", since)
+	}
+	return serve(newTestHandler(), r)
+}
+
+func TestIfModifiedSince(t *testing.T) {
+	useFakeClient(t, timestampedConfigMap(policyModified))
+
+	tests := []struct {
+		name   string
+		since  string
+		status int
+	}{
+		{"at the last write", policyModified.Format(http.TimeFormat), http.StatusNotModified},
+		{"after the last write", policyModified.Add(time.Hour).Format(http.TimeFormat), http.StatusNotModified},
+		{"before the last write", policyModified.Add(-time.Second).Format(http.TimeFormat), http.StatusOK},
+		{"malformed", "yesterday", http.StatusOK},
+		{"absent", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := getIfModifiedSince(tt.since)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if lastModified := w.Header().Get("Last-Modified"); lastModified != "Mon, 20 May 2024 14:30:00 GMT" {
+				t.Errorf("Last-Modified = %q, want the last write", lastModified)
+			}
+
+			hasBody := w.Body.Len() > 0
+			if want := tt.status == http.StatusOK; hasBody != want {
+				t.Errorf("body %q, want a body %v", w.Body, want)
+			}
+		})
+	}
+}
+
+func TestIfModifiedSinceSubSecond(t *testing.T) {
+	// HTTP dates have whole seconds, so a write within the second of the header is not
+	// later than it
+	useFakeClient(t, timestampedConfigMap(policyModified.Add(500*time.Millisecond)))
+
+	if w := getIfModifiedSince(policyModified.Format(http.TimeFormat)); w.Code != http.StatusNotModified {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNotModified)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	policy "github.com/filetrust/policy-update-service/pkg"
+)
+
+var (
+	lastAppliedMu     sync.RWMutex
+	lastAppliedPolicy string
+)
+
+func setLastAppliedPolicy(p string) {
+	lastAppliedMu.Lock()
+	defer lastAppliedMu.Unlock()
+
+	lastAppliedPolicy = p
+}
+
+func getLastAppliedPolicy() string {
+	lastAppliedMu.RLock()
+	defer lastAppliedMu.RUnlock()
+
+	return lastAppliedPolicy
+}
+
+// runReconciler re-applies the last policy written through this service whenever
+// the ConfigMap has drifted from it, until ctx is cancelled. The last policy is that
+// of this replica, so only a single replica may run the reconciler: several would
+// revert the writes made through each other.
+func runReconciler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reconcile(ctx)
+		}
+	}
+}
+
+func reconcile(ctx context.Context) {
+	desired := getLastAppliedPolicy()
+	if desired == "" {
+		return
+	}
+
+	args := policy.PolicyArgs{
+		Policy:          desired,
+		Namespace:       namespace,
+		ConfigMapName:   configmapName,
+		ServerSideApply: useServerSideApply,
+		PolicyKeys:      policyKeys,
+		ReplaceData:     updateStrategy == updateStrategyReplace,
+		Written:         recordConfigMapSize,
+	}
+
+	err := args.GetClient()
+	if err != nil {
+		log.Printf("Reconcile failed, unable to get client: %v", err)
+		svcMetrics.reconciliations.WithLabelValues("error").Inc()
+		return
+	}
+
+	current, err := args.GetPolicy(ctx)
+	if err != nil {
+		log.Printf("Reconcile failed, unable to read policy: %v", err)
+		svcMetrics.reconciliations.WithLabelValues("error").Inc()
+		return
+	}
+
+	if current == desired {
+		svcMetrics.reconciliations.WithLabelValues("in_sync").Inc()
+		return
+	}
+
+	// a correction is a policy change like any other, so it waits out a freeze and
+	// MIN_CHANGE_INTERVAL
+	if until, frozen := policyFrozenUntil(time.Now()); frozen {
+		log.Printf("Policy in config map %s/%s has drifted, not re-applied while policy changes are frozen until %s", namespace, configmapName, until.Format(time.RFC3339))
+		svcMetrics.reconciliations.WithLabelValues("frozen").Inc()
+		return
+	}
+
+	wait, release := reserveChange()
+	if wait > 0 {
+		log.Printf("Policy in config map %s/%s has drifted, not re-applied within %v of the last change", namespace, configmapName, minChangeInterval)
+		svcMetrics.reconciliations.WithLabelValues("throttled").Inc()
+		return
+	}
+
+	changed := false
+	defer func() { release(changed) }()
+
+	log.Printf("Policy in config map %s/%s has drifted, re-applying last applied policy", namespace, configmapName)
+
+	result, err := args.UpdatePolicy(ctx)
+	storedPolicyCache.invalidate()
+	if err != nil {
+		log.Printf("Reconcile failed, unable to update policy: %v", err)
+		svcMetrics.reconciliations.WithLabelValues("error").Inc()
+		return
+	}
+	changed = result.Outcome != policy.Unchanged
+
+	svcMetrics.reconciliations.WithLabelValues("corrected").Inc()
+	recordPolicyEvent(args, "PolicyReconciled", "reconciler", current)
+	publishPolicyChange(desired, "reconciled", "", "reconciler")
+	recordAudit("reconciler", "policy.reconciled", fmt.Sprintf("Drifted policy in config map %s/%s re-applied", namespace, configmapName), "")
+}
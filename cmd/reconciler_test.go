@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const (
+	appliedPolicy = `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":2}`
+	driftedPolicy = `{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`
+)
+
+// useLastAppliedPolicy sets the policy the reconciler re-applies for the rest of the test.
+func useLastAppliedPolicy(t *testing.T, p string) {
+	previous := getLastAppliedPolicy()
+	setLastAppliedPolicy(p)
+	t.Cleanup(func() { setLastAppliedPolicy(previous) })
+}
+
+// reconcileOnce runs one reconciler pass and returns the reconciliation it counted.
+func reconcileOnce(t *testing.T) string {
+	results := []string{"in_sync", "corrected", "frozen", "throttled", "error"}
+	before := map[string]float64{}
+	for _, result := range results {
+		before[result] = testutil.ToFloat64(svcMetrics.reconciliations.WithLabelValues(result))
+	}
+
+	reconcile(context.Background())
+
+	counted := ""
+	for _, result := range results {
+		if testutil.ToFloat64(svcMetrics.reconciliations.WithLabelValues(result)) != before[result] {
+			counted += result
+		}
+	}
+
+	return counted
+}
+
+func TestReconcileCorrectsDrift(t *testing.T) {
+	client := useFakeClient(t, policyConfigMap(driftedPolicy))
+	useLastAppliedPolicy(t, appliedPolicy)
+	useChangeThrottle(t, 0)
+
+	if counted := reconcileOnce(t); counted != "corrected" {
+		t.Errorf("reconciliation = %s, want corrected", counted)
+	}
+	if doc := storedDocument(t, client); doc != appliedPolicy {
+		t.Errorf("stored policy = %s, want %s", doc, appliedPolicy)
+	}
+
+	if counted := reconcileOnce(t); counted != "in_sync" {
+		t.Errorf("second reconciliation = %s, want in_sync", counted)
+	}
+}
+
+func TestReconcileRespectsFreeze(t *testing.T) {
+	client := useFakeClient(t, policyConfigMap(driftedPolicy))
+	useLastAppliedPolicy(t, appliedPolicy)
+	useFreeze(t)
+
+	if counted := reconcileOnce(t); counted != "frozen" {
+		t.Errorf("reconciliation = %s, want frozen", counted)
+	}
+	if doc := storedDocument(t, client); doc != driftedPolicy {
+		t.Errorf("stored policy changed to %s during a freeze", doc)
+	}
+}
+
+func TestReconcileRespectsChangeInterval(t *testing.T) {
+	client := useFakeClient(t, policyConfigMap(driftedPolicy))
+	useLastAppliedPolicy(t, appliedPolicy)
+	useChangeThrottle(t, time.Hour)
+	changeThrottle.lastChange = time.Now()
+
+	if counted := reconcileOnce(t); counted != "throttled" {
+		t.Errorf("reconciliation = %s, want throttled", counted)
+	}
+	if doc := storedDocument(t, client); doc != driftedPolicy {
+		t.Errorf("stored policy changed to %s within MIN_CHANGE_INTERVAL", doc)
+	}
+
+	// a correction counts as a change
+	changeThrottle.lastChange = time.Time{}
+	if counted := reconcileOnce(t); counted != "corrected" {
+		t.Errorf("reconciliation = %s, want corrected", counted)
+	}
+	if wait, _ := reserveChange(); wait == 0 {
+		t.Error("a change is allowed right after a correction")
+	}
+}
+
+func TestReconcileWithoutAppliedPolicy(t *testing.T) {
+	client := useFakeClient(t, policyConfigMap(driftedPolicy))
+	useLastAppliedPolicy(t, "")
+
+	if counted := reconcileOnce(t); counted != "" {
+		t.Errorf("reconciliation = %s, want none before a policy is applied", counted)
+	}
+	if doc := storedDocument(t, client); doc != driftedPolicy {
+		t.Errorf("stored policy changed to %s", doc)
+	}
+}
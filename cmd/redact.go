@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// logRedactPolicy keeps policy documents and values out of logs and Kubernetes Events
+// for deployments that treat the policy as sensitive.
+var logRedactPolicy = os.Getenv("LOG_REDACT_POLICY") == "true"
+
+const redacted = "[redacted]"
+
+// redactPolicy returns the policy document to log in place of doc.
+func redactPolicy(doc string) string {
+	if logRedactPolicy {
+		return redacted
+	}
+
+	return doc
+}
+
+// redactPolicyError returns what to log for an error decoding or validating a policy.
+// Redacted, it keeps only where and why decoding failed, which never includes values.
+func redactPolicyError(err error) string {
+	if !logRedactPolicy {
+		return err.Error()
+	}
+
+	var syntaxError *json.SyntaxError
+	var unmarshalTypeError *json.UnmarshalTypeError
+	var invalid *validationError
+	switch {
+	case errors.As(err, &syntaxError):
+		return fmt.Sprintf("malformed JSON at offset %d", syntaxError.Offset)
+	case errors.As(err, &unmarshalTypeError):
+		return fmt.Sprintf("wrong type for field %q at offset %d", unmarshalTypeError.Field, unmarshalTypeError.Offset)
+	case errors.As(err, &invalid):
+		// validation messages name the rule, not the value
+		return invalid.Error()
+	default:
+		return redacted
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// useRedaction sets LOG_REDACT_POLICY to enabled for the rest of the test.
+func useRedaction(t *testing.T, enabled bool) {
+	previous := logRedactPolicy
+	logRedactPolicy = enabled
+	t.Cleanup(func() { logRedactPolicy = previous })
+}
+
+func TestRedactPolicyError(t *testing.T) {
+	useRedaction(t, true)
+
+	_, syntaxErr := decodePolicy(strings.NewReader(`{"UnprocessableFileTypeAction":secret}`))
+	_, invalidErr := decodePolicy(strings.NewReader(`{"UnprocessableFileTypeAction":9,"GlasswallBlockedFilesAction":1}`))
+	var stored struct{ GlasswallBlockedFilesAction int }
+	typeErr := json.Unmarshal([]byte(`{"GlasswallBlockedFilesAction":"secret"}`), &stored)
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"syntax", syntaxErr, "malformed JSON at offset 32"},
+		{"type", typeErr, `wrong type for field "GlasswallBlockedFilesAction" at offset 39`},
+		{"validation", invalidErr, "UnprocessableFileTypeAction must be between 1-4 inclusive."},
+		{"other", fmt.Errorf("unexpected body %q", "secret"), redacted},
+	}
+	for _, tt := range tests {
+		if got := redactPolicyError(tt.err); got != tt.want || strings.Contains(got, "secret") {
+			t.Errorf("%s: redactPolicyError(%q) = %q, want %q", tt.name, tt.err, got, tt.want)
+		}
+	}
+
+	useRedaction(t, false)
+	if err := errors.New("unexpected body secret"); redactPolicyError(err) != err.Error() {
+		t.Errorf("unredacted error = %q, want it logged as is", redactPolicyError(err))
+	}
+}
+
+func TestRedactedLogs(t *testing.T) {
+	// a stored policy the service can't decode is logged when it is read
+	useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":secret-value}`))
+	useRedaction(t, true)
+	previous := debugLogging
+	debugLogging = true
+	t.Cleanup(func() { debugLogging = previous })
+	logs := captureLogsAt(t, slog.LevelDebug)
+
+	handler := newTestHandler()
+	serve(handler, asAdmin(httptest.NewRequest("GET", policyPath, nil)))
+	putPolicy(handler, `{"UnprocessableFileTypeAction":3,"GlasswallBlockedFilesAction":"secret-value"}`)
+	putPolicy(handler, `{"UnprocessableFileTypeAction":3,"GlasswallBlockedFilesAction":4}`)
+
+	records := logs()
+	for _, record := range records {
+		line, _ := json.Marshal(record)
+		if strings.Contains(string(line), "secret-value") || strings.Contains(string(line), `"value":"3"`) {
+			t.Errorf("log record %s holds a policy value", line)
+		}
+	}
+
+	var decodeLogged, valuesRedacted bool
+	for _, record := range records {
+		if msg, _ := record["msg"].(string); strings.HasPrefix(msg, "Unable to parse stored policy: malformed JSON") {
+			decodeLogged = true
+		}
+		if record["msg"] == "validation" && record["step"] == "field.UnprocessableFileTypeAction" && record["value"] == redacted {
+			valuesRedacted = true
+		}
+	}
+	if !decodeLogged || !valuesRedacted {
+		t.Errorf("logs = %v, want the decoding failure and redacted validation values", records)
+	}
+}
+
+func TestRedactedEvent(t *testing.T) {
+	client := useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`))
+	useK8sEvents(t, true)
+	useRedaction(t, true)
+
+	putPolicy(newTestHandler(), `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":1}`)
+
+	events, err := client.CoreV1().Events(namespace).List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events.Items) != 1 || !strings.HasSuffix(events.Items[0].Message, ": [redacted] -> [redacted]") {
+		t.Errorf("events = %+v, want one with both policies redacted", events.Items)
+	}
+}
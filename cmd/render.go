@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	policy "github.com/filetrust/policy-update-service/pkg"
+	"github.com/golang/gddo/httputil/header"
+)
+
+// renderPolicy encodes a validated policy as the document written to the config map
+// for NCFS to read.
+func renderPolicy(p Policy) string {
+	b := bytes.Buffer{}
+	json.NewEncoder(&b).Encode(p)
+	return b.String()
+}
+
+// previewPolicy validates a proposed policy and returns the config map keys a PUT of it
+// would store, without touching the config map.
+func previewPolicy(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Methods", "*")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "*")
+	w.Header().Set("Access-Control-Expose-Headers", "*")
+
+	if r.Header.Get("Content-Type") != "" {
+		value, _ := header.ParseValueAndParams(r.Header, "Content-Type")
+		if value != "application/json" {
+			traceValidation(r, "content_type", "rejected", value)
+			msg := "Content-Type header is not application/json"
+			writeError(w, http.StatusUnsupportedMediaType, codeUnsupportedMediaType, msg)
+			return
+		}
+	}
+
+	traceValidation(r, "content_type", "ok", r.Header.Get("Content-Type"))
+	limitRequestBody(w, r)
+
+	p, err := decodePolicy(r.Body)
+	traceDecodedPolicy(r, p, err)
+	if err != nil {
+		writePolicyError(w, r, err)
+		return
+	}
+
+	args := policy.PolicyArgs{
+		Policy:        renderPolicy(p),
+		Namespace:     namespace,
+		ConfigMapName: configmapName,
+		PolicyKeys:    policyKeys,
+	}
+	data, err := args.RenderPolicy()
+	if err != nil {
+		loggerFromContext(r.Context()).Printf("Unable to render policy: %v", err)
+		writeError(w, http.StatusInternalServerError, codeInternal, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	writeData(w, http.StatusOK, data, map[string]interface{}{
+		"namespace":     namespace,
+		"configMapName": configmapName,
+	})
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// usePolicyKeys sets the split policy keys for the rest of the test.
+func usePolicyKeys(t *testing.T, keys []string) {
+	previous := policyKeys
+	policyKeys = keys
+	t.Cleanup(func() { policyKeys = previous })
+}
+
+// renderedData posts body to the render endpoint and returns the config map keys it
+// would store.
+func renderedData(t *testing.T, body string) map[string]string {
+	r := httptest.NewRequest("POST", "/api/v1/policy/render", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := serve(newTestHandler(), asAdmin(r))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+
+	var resp struct {
+		Data map[string]string      `json:"data"`
+		Meta map[string]interface{} `json:"meta"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Meta["namespace"] != namespace || resp.Meta["configMapName"] != configmapName {
+		t.Errorf("meta = %v, want the policy config map", resp.Meta)
+	}
+
+	return resp.Data
+}
+
+func TestPreviewPolicy(t *testing.T) {
+	client := useFakeClient(t)
+
+	for value := 1; value <= 4; value++ {
+		t.Run(fmt.Sprint(value), func(t *testing.T) {
+			body := fmt.Sprintf(`{"UnprocessableFileTypeAction":%d,"GlasswallBlockedFilesAction":%d}`, value, value)
+			want := map[string]string{"appsettings.json": body + "\n"}
+			if got := renderedData(t, body); !reflect.DeepEqual(got, want) {
+				t.Errorf("rendered %v, want %v", got, want)
+			}
+		})
+	}
+
+	if actions := client.Actions(); len(actions) != 0 {
+		t.Errorf("render made %d Kubernetes calls, want none", len(actions))
+	}
+}
+
+func TestPreviewSplitPolicy(t *testing.T) {
+	useFakeClient(t)
+	usePolicyKeys(t, []string{"UnprocessableFileTypeAction", "GlasswallBlockedFilesAction"})
+
+	for value := 1; value <= 4; value++ {
+		t.Run(fmt.Sprint(value), func(t *testing.T) {
+			body := fmt.Sprintf(`{"UnprocessableFileTypeAction":%d,"GlasswallBlockedFilesAction":%d}`, value, value)
+			want := map[string]string{"UnprocessableFileTypeAction": fmt.Sprint(value), "GlasswallBlockedFilesAction": fmt.Sprint(value)}
+			if got := renderedData(t, body); !reflect.DeepEqual(got, want) {
+				t.Errorf("rendered %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestPreviewPolicyRejected(t *testing.T) {
+	useFakeClient(t)
+
+	r := httptest.NewRequest("POST", "/api/v1/policy/render", strings.NewReader(`{"UnprocessableFileTypeAction":5,"GlasswallBlockedFilesAction":1}`))
+	r.Header.Set("Content-Type", "application/json")
+	if w := serve(newTestHandler(), asAdmin(r)); w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// The default roles. The policy routes are authorized by request method, so by
+// default readers can only read and writers can read and change the policy; the
+// admin routes require the admin role whatever the method.
+const (
+	roleReader = "policy-reader"
+	roleWriter = "policy-writer"
+	roleAdmin  = "policy-admin"
+)
+
+var (
+	// methodRoles maps each HTTP method to the roles allowed to use it, any one of
+	// which is enough. ROLE_MAP replaces it.
+	methodRoles = map[string][]string{
+		"GET":    {roleReader, roleWriter},
+		"HEAD":   {roleReader, roleWriter},
+		"POST":   {roleWriter},
+		"PUT":    {roleWriter},
+		"PATCH":  {roleWriter},
+		"DELETE": {roleWriter},
+	}
+
+	// adminRole is required by the admin routes, ADMIN_ROLE replaces it.
+	adminRole = roleAdmin
+)
+
+// mappedMethods are the methods ROLE_MAP may map. OPTIONS is answered before
+// authentication, so it needs no role.
+var mappedMethods = map[string]bool{"GET": true, "HEAD": true, "POST": true, "PUT": true, "PATCH": true, "DELETE": true}
+
+// servedMethods are the methods the API serves, each of which ROLE_MAP must map.
+var servedMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE"}
+
+func setupRoles() error {
+	if value := strings.TrimSpace(os.Getenv("ROLE_MAP")); value != "" {
+		roles, err := parseRoleMap(value)
+		if err != nil {
+			return err
+		}
+		methodRoles = roles
+	}
+
+	if role := strings.TrimSpace(os.Getenv("ADMIN_ROLE")); role != "" {
+		adminRole = role
+	}
+
+	log.Printf("Roles required by method: %v, admin role %s", methodRoles, adminRole)
+	return nil
+}
+
+// parseRoleMap reads ROLE_MAP, a JSON object mapping HTTP methods to the roles allowed
+// to use them, e.g. {"GET":["policy-reader","policy-writer"],"PUT":["policy-writer"]}.
+// Every method the API serves must be mapped to at least one role; HEAD falls back to
+// the roles of GET.
+func parseRoleMap(value string) (map[string][]string, error) {
+	var raw map[string][]string
+	if err := json.Unmarshal([]byte(value), &raw); err != nil {
+		return nil, fmt.Errorf("ROLE_MAP must be a JSON object of methods to lists of roles: %v", err)
+	}
+
+	roles := map[string][]string{}
+	for method, names := range raw {
+		upper := strings.ToUpper(method)
+		if !mappedMethods[upper] {
+			return nil, fmt.Errorf("ROLE_MAP maps an unknown method %q", method)
+		}
+		if _, ok := roles[upper]; ok {
+			return nil, fmt.Errorf("ROLE_MAP maps %s more than once", upper)
+		}
+
+		for _, name := range names {
+			if strings.TrimSpace(name) == "" || name != strings.TrimSpace(name) {
+				return nil, fmt.Errorf("ROLE_MAP has an empty or padded role for %s", upper)
+			}
+		}
+
+		roles[upper] = names
+	}
+
+	for _, method := range servedMethods {
+		if len(roles[method]) == 0 {
+			return nil, fmt.Errorf("ROLE_MAP must map %s to at least one role", method)
+		}
+	}
+
+	if _, ok := roles["HEAD"]; !ok {
+		roles["HEAD"] = roles["GET"]
+	}
+
+	return roles, nil
+}
+
+// ownerRoles are the roles of the USERNAME account, and of the tokens issued to it:
+// every role the API requires anywhere, so the account keeps full access whatever
+// ROLE_MAP and ADMIN_ROLE say.
+func ownerRoles() []string {
+	seen := map[string]bool{adminRole: true}
+	for _, names := range methodRoles {
+		for _, name := range names {
+			seen[name] = true
+		}
+	}
+
+	roles := make([]string, 0, len(seen))
+	for name := range seen {
+		roles = append(roles, name)
+	}
+	sort.Strings(roles)
+
+	return roles
+}
+
+// hasRole reports whether the user of r holds any of roles. The roles of a user are
+// its groups.
+func hasRole(r *http.Request, roles ...string) bool {
+	id, _ := r.Context().Value(identityKey{}).(identity)
+	if id.info == nil {
+		return false
+	}
+
+	for _, group := range id.info.Groups() {
+		for _, role := range roles {
+			if group == role {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// roleMiddleware rejects an authenticated request with 403 unless its user holds one
+// of the roles its method is mapped to. whoami is open to any authenticated user, so
+// it can show why other requests are refused.
+func roleMiddleware(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if authExemptPaths[r.URL.Path] || r.URL.Path == whoamiPath {
+		next(w, r)
+		return
+	}
+
+	roles := methodRoles[r.Method]
+	if !hasRole(r, roles...) {
+		loggerFromContext(r.Context()).Printf("%s denied to %s, requires one of the roles %v", r.Method, requestActor(r), roles)
+		writeError(w, http.StatusForbidden, codeForbidden, fmt.Sprintf("%s requests require one of the roles %s.", r.Method, strings.Join(roles, ", ")))
+		return
+	}
+
+	next(w, r)
+}
+
+// requireAdmin restricts an admin route to users holding the admin role, in addition
+// to the role its method requires.
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !hasRole(r, adminRole) {
+			loggerFromContext(r.Context()).Printf("Admin route %s denied to %s", r.URL.Path, requestActor(r))
+			writeError(w, http.StatusForbidden, codeForbidden, fmt.Sprintf("This route requires the %s role.", adminRole))
+			return
+		}
+
+		next(w, r)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseRoleMap(t *testing.T) {
+	all := `"POST":["w"],"PUT":["w"],"PATCH":["w"],"DELETE":["w"]`
+
+	tests := []struct {
+		name    string
+		value   string
+		want    map[string][]string
+		wantErr bool
+	}{
+		{
+			name:  "custom roles",
+			value: `{"GET":["viewer","editor"],` + all + `}`,
+			want: map[string][]string{
+				"GET": {"viewer", "editor"}, "HEAD": {"viewer", "editor"},
+				"POST": {"w"}, "PUT": {"w"}, "PATCH": {"w"}, "DELETE": {"w"},
+			},
+		},
+		{
+			name:  "lower case methods and own HEAD roles",
+			value: `{"get":["r"],"head":["h"],"post":["w"],"put":["w"],"patch":["w"],"delete":["w"]}`,
+			want: map[string][]string{
+				"GET": {"r"}, "HEAD": {"h"},
+				"POST": {"w"}, "PUT": {"w"}, "PATCH": {"w"}, "DELETE": {"w"},
+			},
+		},
+		{name: "not JSON", value: `GET=reader`, wantErr: true},
+		{name: "unknown method", value: `{"GET":["r"],"TRACE":["r"],` + all + `}`, wantErr: true},
+		{name: "method mapped twice", value: `{"GET":["r"],"get":["r"],` + all + `}`, wantErr: true},
+		{name: "served method missing", value: `{"GET":["r"],"POST":["w"],"PATCH":["w"],"DELETE":["w"]}`, wantErr: true},
+		{name: "no roles for a method", value: `{"GET":[],` + all + `}`, wantErr: true},
+		{name: "empty role", value: `{"GET":[""],` + all + `}`, wantErr: true},
+		{name: "padded role", value: `{"GET":[" r"],` + all + `}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRoleMap(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRoleMap() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseRoleMap() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoleMiddleware(t *testing.T) {
+	defer func(roles map[string][]string) { methodRoles = roles }(methodRoles)
+
+	var err error
+	methodRoles, err = parseRoleMap(`{"GET":["auditor","ops"],"POST":["ops"],"PUT":["ops"],"PATCH":["ops"],"DELETE":["ops"]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		groups []string
+		want   int
+	}{
+		{name: "read role may read", method: "GET", path: policyPath, groups: []string{"auditor"}, want: http.StatusNoContent},
+		{name: "read role may not write", method: "PUT", path: policyPath, groups: []string{"auditor"}, want: http.StatusForbidden},
+		{name: "write role may write", method: "PUT", path: policyPath, groups: []string{"ops"}, want: http.StatusNoContent},
+		{name: "write role may read", method: "GET", path: policyPath, groups: []string{"ops"}, want: http.StatusNoContent},
+		{name: "HEAD follows GET", method: "HEAD", path: policyPath, groups: []string{"auditor"}, want: http.StatusNoContent},
+		{name: "default roles no longer count", method: "GET", path: policyPath, groups: []string{roleReader, roleWriter}, want: http.StatusForbidden},
+		{name: "no roles", method: "GET", path: policyPath, want: http.StatusForbidden},
+		{name: "whoami needs no role", method: "GET", path: whoamiPath, want: http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := withIdentity(httptest.NewRequest(tt.method, tt.path, nil), "someone", tt.groups...)
+			w := httptest.NewRecorder()
+			handlerFor(roleMiddleware)(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireAdmin(t *testing.T) {
+	defer func(role string) { adminRole = role }(adminRole)
+	adminRole = "ops-admin"
+
+	handler := requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name   string
+		groups []string
+		want   int
+	}{
+		{name: "admin role", groups: []string{"ops-admin"}, want: http.StatusNoContent},
+		{name: "default admin role no longer counts", groups: []string{roleAdmin}, want: http.StatusForbidden},
+		{name: "writer", groups: []string{roleWriter}, want: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := withIdentity(httptest.NewRequest("POST", "/api/v1/admin/cache/flush", nil), "someone", tt.groups...)
+			w := httptest.NewRecorder()
+			handler(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestOwnerRolesCoverEveryRole(t *testing.T) {
+	defer func(roles map[string][]string, role string) { methodRoles, adminRole = roles, role }(methodRoles, adminRole)
+
+	methodRoles = map[string][]string{"GET": {"b", "a"}, "PUT": {"c"}}
+	adminRole = "a"
+
+	if got, want := ownerRoles(), []string{"a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ownerRoles() = %v, want %v", got, want)
+	}
+}
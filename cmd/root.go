@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// What / answers when the web UI is disabled, chosen with ROOT_PATH_BEHAVIOR. Crawlers
+// and probes hit / first, so none of them require authentication or say more than that
+// this is the policy service.
+const (
+	rootNotFound = "not_found"
+	rootJSON     = "json"
+	rootRedirect = "redirect"
+)
+
+var (
+	rootPathBehavior = os.Getenv("ROOT_PATH_BEHAVIOR")
+	rootRedirectURL  = os.Getenv("ROOT_REDIRECT_URL")
+)
+
+func setupRootPath() error {
+	authExemptPaths["/robots.txt"] = true
+
+	if rootPathBehavior == "" {
+		rootPathBehavior = rootNotFound
+	}
+
+	switch rootPathBehavior {
+	case rootNotFound, rootJSON:
+	case rootRedirect:
+		target, err := url.Parse(rootRedirectURL)
+		if err != nil || rootRedirectURL == "" || (target.Scheme != "https" && target.Scheme != "http") {
+			return fmt.Errorf("ROOT_PATH_BEHAVIOR=%s requires ROOT_REDIRECT_URL to be an absolute http or https URL", rootRedirect)
+		}
+	default:
+		return fmt.Errorf("ROOT_PATH_BEHAVIOR must be one of %s, %s, %s", rootNotFound, rootJSON, rootRedirect)
+	}
+
+	if webUIEnabled {
+		if rootPathBehavior != rootNotFound {
+			log.Printf("ROOT_PATH_BEHAVIOR is ignored while the web UI is served at /")
+		}
+		return nil
+	}
+
+	authExemptPaths["/"] = true
+	return nil
+}
+
+// serveRoot answers / according to ROOT_PATH_BEHAVIOR when the web UI is disabled.
+func serveRoot(w http.ResponseWriter, r *http.Request) {
+	switch rootPathBehavior {
+	case rootJSON:
+		writeData(w, http.StatusOK, map[string]string{"service": "ncfs-policy-update-service"}, nil)
+	case rootRedirect:
+		http.Redirect(w, r, rootRedirectURL, http.StatusFound)
+	default:
+		notFound(w, r)
+	}
+}
+
+// robotsTxt asks crawlers to stay away from every path.
+func robotsTxt(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("User-agent: *\nDisallow: /\n"))
+}
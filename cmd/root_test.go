@@ -0,0 +1,85 @@
+package main
+
+import (
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// useRootPath sets ROOT_PATH_BEHAVIOR and ROOT_REDIRECT_URL for the rest of the test
+// and returns the error setting them up.
+func useRootPath(t *testing.T, behavior, redirectURL string) error {
+	previous, previousURL, exempt := rootPathBehavior, rootRedirectURL, maps.Clone(authExemptPaths)
+	rootPathBehavior, rootRedirectURL = behavior, redirectURL
+	t.Cleanup(func() {
+		rootPathBehavior, rootRedirectURL, authExemptPaths = previous, previousURL, exempt
+	})
+
+	return setupRootPath()
+}
+
+func TestRootPath(t *testing.T) {
+	tests := []struct {
+		name     string
+		behavior string
+		status   int
+		body     string
+		location string
+	}{
+		{name: "default", behavior: "", status: http.StatusNotFound, body: `{"code":"not_found","message":"The requested resource does not exist."}` + "\n"},
+		{name: rootNotFound, behavior: rootNotFound, status: http.StatusNotFound, body: `{"code":"not_found","message":"The requested resource does not exist."}` + "\n"},
+		{name: rootJSON, behavior: rootJSON, status: http.StatusOK, body: `{"data":{"service":"ncfs-policy-update-service"}}` + "\n"},
+		{name: rootRedirect, behavior: rootRedirect, status: http.StatusFound, location: "https://docs.example.com/ncfs"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := useRootPath(t, tt.behavior, "https://docs.example.com/ncfs"); err != nil {
+				t.Fatal(err)
+			}
+
+			// answered without credentials
+			w := serve(newTestHandler(), httptest.NewRequest("GET", "/", nil))
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.body != "" && w.Body.String() != tt.body {
+				t.Errorf("body = %s, want %s", w.Body, tt.body)
+			}
+			if location := w.Header().Get("Location"); location != tt.location {
+				t.Errorf("Location = %q, want %q", location, tt.location)
+			}
+		})
+	}
+}
+
+func TestRootPathSetting(t *testing.T) {
+	tests := []struct{ behavior, redirectURL string }{
+		{"landing", ""},
+		{rootRedirect, ""},
+		{rootRedirect, "/relative"},
+		{rootRedirect, "ftp://example.com/"},
+	}
+	for _, tt := range tests {
+		if err := useRootPath(t, tt.behavior, tt.redirectURL); err == nil {
+			t.Errorf("ROOT_PATH_BEHAVIOR=%q with ROOT_REDIRECT_URL=%q was accepted", tt.behavior, tt.redirectURL)
+		}
+	}
+}
+
+func TestRobotsTxt(t *testing.T) {
+	if err := useRootPath(t, rootJSON, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	w := serve(newTestHandler(), httptest.NewRequest("GET", "/robots.txt", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "text/plain; charset=utf-8" {
+		t.Errorf("Content-Type = %q, want text/plain", contentType)
+	}
+	if w.Body.String() != "User-agent: *\nDisallow: /\n" {
+		t.Errorf("body = %q, want every path disallowed", w.Body)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	policy "github.com/filetrust/policy-update-service/pkg"
+)
+
+// sarAuthz delegates the authorization of policy writes to Kubernetes RBAC: the caller
+// must be allowed to update the target config map.
+var sarAuthz = os.Getenv("K8S_SAR_AUTHZ") == "true"
+
+func setupSubjectAccessReview() error {
+	if !sarAuthz {
+		return nil
+	}
+
+	if err := setupReviewer("K8S_SAR_AUTHZ"); err != nil {
+		return err
+	}
+
+	log.Printf("Policy writes are authorized with SubjectAccessReview")
+	return nil
+}
+
+// authorizeWrite checks with a SubjectAccessReview that the user of r may update the
+// config map the policy is written to, writing the error response if not. With
+// TARGET_LABEL_SELECTOR the user must be allowed to update config maps cluster-wide.
+func authorizeWrite(w http.ResponseWriter, r *http.Request) bool {
+	if !sarAuthz {
+		return true
+	}
+
+	id, _ := r.Context().Value(identityKey{}).(identity)
+	if id.info == nil {
+		writeError(w, http.StatusForbidden, codeForbidden, "The request is not authenticated.")
+		return false
+	}
+
+	subject := policy.Subject{
+		User:   id.info.UserName(),
+		UID:    id.info.ID(),
+		Groups: id.info.Groups(),
+		Extra:  map[string][]string{},
+	}
+	switch authStrategy(r, id) {
+	case strategyBasic, strategyBearer, strategyServiceToken:
+		// their groups are this service's roles, not anything RBAC knows about
+		subject.Groups = nil
+	}
+	for key, values := range id.info.Extensions() {
+		// these are ours, not something the authorizer knows about
+		if key != tokenIDExtension && key != tokenExpiryExtension && key != serviceTokenExtension && key != gatewayExtension {
+			subject.Extra[key] = values
+		}
+	}
+
+	allowed, reason, err := reviewPolicyWrite(r.Context(), subject)
+	if err != nil {
+		loggerFromContext(r.Context()).Printf("Unable to review access of %s: %v", requestActor(r), err)
+		writeConfigMapError(w, err, "Something went wrong checking the user's permissions.")
+		return false
+	}
+
+	if !allowed {
+		loggerFromContext(r.Context()).Printf("SubjectAccessReview denied policy write by %s: %s", requestActor(r), orDash(reason))
+		msg := fmt.Sprintf("User %s is not allowed to update the policy config map.", subject.User)
+		if targetLabelSelector != "" {
+			msg = fmt.Sprintf("User %s is not allowed to update config maps cluster-wide.", subject.User)
+		}
+		writeError(w, http.StatusForbidden, codeForbidden, msg)
+		return false
+	}
+
+	return true
+}
+
+// reviewPolicyWrite asks whether subject may update the config map the policy is
+// written to, or with TARGET_LABEL_SELECTOR, config maps cluster-wide.
+func reviewPolicyWrite(ctx context.Context, subject policy.Subject) (bool, string, error) {
+	targetNamespace, targetName := namespace, configmapName
+	if targetLabelSelector != "" {
+		targetNamespace, targetName = "", ""
+	}
+
+	return reviewer.CanUpdateConfigMap(ctx, subject, targetNamespace, targetName)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const sarStoredPolicy = `{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`
+
+// recordReviews records the specs of the SubjectAccessReviews made through client,
+// leaving the verdict to the reactors prepended before it.
+func recordReviews(client *fake.Clientset) *[]authorizationv1.SubjectAccessReviewSpec {
+	var reviews []authorizationv1.SubjectAccessReviewSpec
+	client.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		reviews = append(reviews, action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview).Spec)
+		return false, nil, nil
+	})
+
+	return &reviews
+}
+
+// allowUser returns an allowed func of useSubjectAccessReview allowing only user.
+func allowUser(user string) func(string) bool {
+	return func(reviewed string) bool { return reviewed == user }
+}
+
+func TestSubjectAccessReviewAllowed(t *testing.T) {
+	client := useFakeClient(t, policyConfigMap(sarStoredPolicy))
+	useSubjectAccessReview(t, allowUser(username))
+	reviews := recordReviews(client)
+
+	w := putPolicy(newTestHandler(), `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":2}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT = %d %s, want %d", w.Code, w.Body, http.StatusOK)
+	}
+	if doc := storedDocument(t, client); doc == sarStoredPolicy {
+		t.Error("allowed write was not stored")
+	}
+
+	if len(*reviews) != 1 {
+		t.Fatalf("%d reviews, want 1", len(*reviews))
+	}
+	spec := (*reviews)[0]
+	want := authorizationv1.ResourceAttributes{Namespace: namespace, Verb: "update", Resource: "configmaps", Name: configmapName}
+	if spec.ResourceAttributes == nil || *spec.ResourceAttributes != want {
+		t.Errorf("reviewed %+v, want %+v", spec.ResourceAttributes, want)
+	}
+	// the roles of a basic auth user mean nothing to RBAC
+	if spec.User != username || len(spec.Groups) != 0 {
+		t.Errorf("reviewed user %s in %v, want %s in no groups", spec.User, spec.Groups, username)
+	}
+}
+
+func TestSubjectAccessReviewDenied(t *testing.T) {
+	client := useFakeClient(t, policyConfigMap(sarStoredPolicy))
+	useSubjectAccessReview(t, allowUser("someone-else"))
+
+	w := putPolicy(newTestHandler(), `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":2}`)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("PUT = %d %s, want %d", w.Code, w.Body, http.StatusForbidden)
+	}
+	if doc := storedDocument(t, client); doc != sarStoredPolicy {
+		t.Errorf("stored policy changed to %s", doc)
+	}
+}
+
+func TestSubjectAccessReviewFails(t *testing.T) {
+	client := useFakeClient(t, policyConfigMap(sarStoredPolicy))
+	useSubjectAccessReview(t, allowUser(username))
+	client.PrependReactor("create", "subjectaccessreviews", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Group: "authorization.k8s.io", Resource: "subjectaccessreviews"}, "", errors.New("denied"))
+	})
+
+	w := putPolicy(newTestHandler(), `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":2}`)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("PUT = %d %s, want %d", w.Code, w.Body, http.StatusInternalServerError)
+	}
+	if doc := storedDocument(t, client); doc != sarStoredPolicy {
+		t.Errorf("stored policy changed to %s", doc)
+	}
+}
+
+func TestSubjectAccessReviewDisabled(t *testing.T) {
+	client := useFakeClient(t, policyConfigMap(sarStoredPolicy))
+	useSubjectAccessReview(t, allowUser(username))
+	reviews := recordReviews(client)
+	sarAuthz = false
+
+	if w := putPolicy(newTestHandler(), `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":2}`); w.Code != http.StatusOK {
+		t.Errorf("PUT = %d %s, want %d", w.Code, w.Body, http.StatusOK)
+	}
+	if len(*reviews) != 0 {
+		t.Errorf("%d reviews made with K8S_SAR_AUTHZ off", len(*reviews))
+	}
+}
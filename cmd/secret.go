@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minSecretLength is the shortest JWT_SECRET accepted: 32 bytes, the size of the
+// HS256 hash.
+const minSecretLength = 32
+
+// tokenLifetime is how long an issued bearer token is valid.
+const tokenLifetime = 5 * time.Minute
+
+// weakSecrets are well-known placeholder values, matched case-insensitively.
+var weakSecrets = map[string]bool{
+	"secret":   true,
+	"changeme": true,
+	"password": true,
+	"jwt":      true,
+}
+
+var (
+	// jwtSecret signs and verifies bearer tokens. It defaults to the old hardcoded
+	// value so existing deployments keep working once they allow it explicitly.
+	jwtSecret           = os.Getenv("JWT_SECRET")
+	allowInsecureSecret = os.Getenv("ALLOW_INSECURE_SECRET") == "true"
+
+	// previousJWTSecret is the secret JWT_SECRET replaced. Tokens it signed are still
+	// accepted until previousSecretExpiry.
+	previousJWTSecret    = os.Getenv("JWT_PREVIOUS_SECRET")
+	previousSecretExpiry time.Time
+)
+
+// setupJWTSecret refuses to start with a weak signing secret, which would let anyone
+// mint tokens, unless ALLOW_INSECURE_SECRET is set. The secret is irrelevant when
+// the token endpoint is disabled.
+func setupJWTSecret() error {
+	if jwtSecret == "" {
+		jwtSecret = "secret"
+	}
+
+	if !tokenEndpointEnabled || tokenSigningMethod != jwt.SigningMethodHS256 {
+		return nil
+	}
+
+	weakness := secretWeakness(jwtSecret)
+	if weakness == "" {
+		return nil
+	}
+
+	if !allowInsecureSecret {
+		return fmt.Errorf("JWT_SECRET %s; set a strong JWT_SECRET, or ALLOW_INSECURE_SECRET=true to start anyway", weakness)
+	}
+
+	log.Printf("WARNING: JWT_SECRET %s, anyone who knows it can mint bearer tokens. Starting anyway because ALLOW_INSECURE_SECRET=true", weakness)
+	return nil
+}
+
+// secretWeakness describes why secret is unfit to sign tokens, or returns "".
+func secretWeakness(secret string) string {
+	switch {
+	case weakSecrets[strings.ToLower(secret)]:
+		return "is a well-known default"
+	case len(secret) < minSecretLength:
+		return fmt.Sprintf("is shorter than %d bytes", minSecretLength)
+	default:
+		return ""
+	}
+}
+
+// setupSecretRotation keeps tokens signed before a JWT_SECRET rotation working for
+// SECRET_ROTATION_GRACE after startup, by default the lifetime of a token, so a
+// rolling restart onto a new secret doesn't turn every outstanding token into a 401.
+func setupSecretRotation() error {
+	if previousJWTSecret == "" {
+		return nil
+	}
+
+	if tokenSigningMethod != jwt.SigningMethodHS256 {
+		return fmt.Errorf("JWT_PREVIOUS_SECRET only applies to JWT_SIGNING_ALG=%s", signingAlgHS256)
+	}
+
+	if previousJWTSecret == jwtSecret {
+		return fmt.Errorf("JWT_PREVIOUS_SECRET must differ from JWT_SECRET")
+	}
+
+	if weakness := secretWeakness(previousJWTSecret); weakness != "" && !allowInsecureSecret {
+		return fmt.Errorf("JWT_PREVIOUS_SECRET %s", weakness)
+	}
+
+	grace, err := durationFromEnv("SECRET_ROTATION_GRACE", tokenLifetime)
+	if err != nil {
+		return err
+	}
+
+	previousSecretExpiry = time.Now().Add(grace)
+	log.Printf("Accepting tokens signed with the previous JWT secret until %s", previousSecretExpiry.UTC().Format(time.RFC3339))
+	return nil
+}
+
+// verificationKeys returns the secrets a bearer token may be signed with: the current
+// one and, during the rotation grace, the previous one.
+func verificationKeys() interface{} {
+	if tokenSigningMethod == jwt.SigningMethodEdDSA {
+		return edPublicKey
+	}
+
+	if previousJWTSecret == "" || time.Now().After(previousSecretExpiry) {
+		return []byte(jwtSecret)
+	}
+
+	return jwt.VerificationKeySet{
+		Keys: []jwt.VerificationKey{[]byte(jwtSecret), []byte(previousJWTSecret)},
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// useJWTSecret sets JWT_SECRET to secret, and ALLOW_INSECURE_SECRET to allowInsecure,
+// for the rest of the test.
+func useJWTSecret(t *testing.T, secret string, allowInsecure bool) {
+	previousSecret, previousAllow := jwtSecret, allowInsecureSecret
+	t.Cleanup(func() { jwtSecret, allowInsecureSecret = previousSecret, previousAllow })
+
+	jwtSecret, allowInsecureSecret = secret, allowInsecure
+}
+
+func TestWeakSecretFailsStartup(t *testing.T) {
+	weak := map[string]string{
+		"secret":   "is a well-known default",
+		"ChangeMe": "is a well-known default",
+		"":         "is a well-known default",
+		"short":    "is shorter than 32 bytes",
+	}
+
+	for secret, want := range weak {
+		useJWTSecret(t, secret, false)
+		err := setupJWTSecret()
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("JWT_SECRET=%q: error = %v, want it to say it %s", secret, err, want)
+		}
+
+		useJWTSecret(t, secret, true)
+		if err := setupJWTSecret(); err != nil {
+			t.Errorf("JWT_SECRET=%q with ALLOW_INSECURE_SECRET=true: error = %v", secret, err)
+		}
+	}
+}
+
+func TestStrongSecretStarts(t *testing.T) {
+	useJWTSecret(t, "a-test-secret-of-at-least-32-bytes", false)
+	if err := setupJWTSecret(); err != nil {
+		t.Errorf("error = %v", err)
+	}
+}
+
+func TestWeakSecretIgnoredWithoutTokenEndpoint(t *testing.T) {
+	previous := tokenEndpointEnabled
+	t.Cleanup(func() { tokenEndpointEnabled = previous })
+	tokenEndpointEnabled = false
+
+	useJWTSecret(t, "secret", false)
+	if err := setupJWTSecret(); err != nil {
+		t.Errorf("error = %v, want the secret ignored when the token endpoint is disabled", err)
+	}
+}
+
+// usePreviousSecret sets JWT_PREVIOUS_SECRET to secret for the rest of the test.
+func usePreviousSecret(t *testing.T, secret string) {
+	previousSecret, previousExpiry := previousJWTSecret, previousSecretExpiry
+	t.Cleanup(func() { previousJWTSecret, previousSecretExpiry = previousSecret, previousExpiry })
+
+	previousJWTSecret = secret
+}
+
+func TestPreviousSecretAcceptedDuringGrace(t *testing.T) {
+	const previous = "the-secret-before-the-rotation-of-32-bytes"
+	usePreviousSecret(t, previous)
+	t.Setenv("SECRET_ROTATION_GRACE", "1m")
+	if err := setupSecretRotation(); err != nil {
+		t.Fatal(err)
+	}
+	if until := time.Until(previousSecretExpiry); until <= 0 || until > time.Minute {
+		t.Fatalf("previous secret accepted for %v, want SECRET_ROTATION_GRACE", until)
+	}
+
+	token := resign(t, issueToken(t, "alice"), jwt.SigningMethodHS256, []byte(previous))
+	if status := whoamiWithToken(token); status != http.StatusOK {
+		t.Errorf("whoami with the previous secret during the grace = %d, want %d", status, http.StatusOK)
+	}
+
+	previousSecretExpiry = time.Now().Add(-time.Second)
+	if status := whoamiWithToken(token); status != http.StatusUnauthorized {
+		t.Errorf("whoami with the previous secret after the grace = %d, want %d", status, http.StatusUnauthorized)
+	}
+
+	// the current secret is unaffected by the end of the grace
+	if status := whoamiWithToken(issueToken(t, "alice")); status != http.StatusOK {
+		t.Errorf("whoami with the current secret = %d, want %d", status, http.StatusOK)
+	}
+}
+
+func TestOtherSecretRejected(t *testing.T) {
+	usePreviousSecret(t, "the-secret-before-the-rotation-of-32-bytes")
+	if err := setupSecretRotation(); err != nil {
+		t.Fatal(err)
+	}
+
+	token := resign(t, issueToken(t, "alice"), jwt.SigningMethodHS256, []byte("some-other-secret-of-at-least-32-bytes"))
+	if status := whoamiWithToken(token); status != http.StatusUnauthorized {
+		t.Errorf("whoami with an unknown secret = %d, want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestPreviousSecretMustDiffer(t *testing.T) {
+	usePreviousSecret(t, jwtSecret)
+	if err := setupSecretRotation(); err == nil {
+		t.Error("JWT_PREVIOUS_SECRET equal to JWT_SECRET accepted")
+	}
+}
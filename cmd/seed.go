@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	policy "github.com/filetrust/policy-update-service/pkg"
+)
+
+var seedPolicyFile = os.Getenv("SEED_POLICY_FILE")
+
+// seedPolicy creates the policy config map from SEED_POLICY_FILE when it doesn't exist
+// yet, so a fresh install starts from a known baseline. An existing config map is
+// never modified.
+func seedPolicy() error {
+	if seedPolicyFile == "" {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(seedPolicyFile)
+	if err != nil {
+		return fmt.Errorf("unable to read SEED_POLICY_FILE: %v", err)
+	}
+
+	p, err := decodePolicy(bytes.NewReader(b))
+	var invalid *validationError
+	if errors.As(err, &invalid) {
+		return fmt.Errorf("seed policy %s is invalid: %s", seedPolicyFile, redactPolicyError(err))
+	}
+	if err != nil {
+		return fmt.Errorf("seed policy %s cannot be decoded: %s", seedPolicyFile, redactPolicyError(err))
+	}
+
+	// Stored exactly as a PUT of the same policy would store it.
+	args := policy.PolicyArgs{
+		Policy:        renderPolicy(p),
+		Namespace:     namespace,
+		ConfigMapName: configmapName,
+		PolicyKeys:    policyKeys,
+		Written:       recordConfigMapSize,
+	}
+
+	err = args.GetClient()
+	if err != nil {
+		return fmt.Errorf("unable to get client to seed policy: %v", err)
+	}
+
+	created, err := args.CreatePolicy(context.Background())
+	if err != nil {
+		return fmt.Errorf("unable to seed policy: %v", err)
+	}
+
+	if created {
+		log.Printf("Seeded config map %s/%s from %s", namespace, configmapName, seedPolicyFile)
+	} else {
+		log.Printf("Config map %s/%s already exists, skipped seeding from %s", namespace, configmapName, seedPolicyFile)
+	}
+
+	return nil
+}
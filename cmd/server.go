@@ -0,0 +1,136 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shaj13/go-guardian/auth"
+	"github.com/slok/go-http-metrics/middleware"
+	negronimiddleware "github.com/slok/go-http-metrics/middleware/negroni"
+	"github.com/urfave/negroni"
+)
+
+// Server is the policy API: its routes and middleware, and the authenticators and
+// request metrics they use. NewServer wires the defaults configured from the
+// environment; any field can be replaced before Handler is called, e.g. to use a stub
+// or custom authenticator.
+type Server struct {
+	// Authenticator authenticates every route that isn't exempt from authentication.
+	Authenticator auth.Authenticator
+	// TokenIssuerAuthenticator, when set, authenticates the token endpoint instead of
+	// Authenticator.
+	TokenIssuerAuthenticator auth.Authenticator
+	// HTTPMetrics records request metrics. Nil leaves requests unrecorded.
+	HTTPMetrics negroni.Handler
+	// AccessLog logs every request. Nil disables the access log.
+	AccessLog negroni.Handler
+}
+
+// NewServer creates a Server with the authenticators, request metrics and access log
+// configured from the environment.
+func NewServer() (*Server, error) {
+	accessLog, err := newAccessLogger(os.Getenv("ACCESS_LOG_FORMAT"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Server{
+		Authenticator:            newAuthenticator(),
+		TokenIssuerAuthenticator: newTokenIssuerAuthenticator(),
+		HTTPMetrics: negronimiddleware.Handler("", middleware.New(middleware.Config{
+			Recorder: newHTTPRecorder(prometheus.DefaultRegisterer),
+			Service:  "ncfs-policy-update-service",
+		})),
+		AccessLog: accessLog,
+	}, nil
+}
+
+// authenticatorFor returns the authenticator responsible for the route of r.
+func (s *Server) authenticatorFor(r *http.Request) auth.Authenticator {
+	if r.URL.Path == tokenPath && s.TokenIssuerAuthenticator != nil {
+		return s.TokenIssuerAuthenticator
+	}
+
+	return s.Authenticator
+}
+
+// Router returns the API routes, without any middleware.
+func (s *Server) Router() *mux.Router {
+	router := mux.NewRouter()
+	router.NotFoundHandler = http.HandlerFunc(notFound)
+	router.MethodNotAllowedHandler = http.HandlerFunc(methodNotAllowed)
+	if tokenEndpointEnabled {
+		router.HandleFunc(tokenPath, createToken).Methods("GET")
+	} else {
+		log.Printf("Token endpoint disabled, only basic auth is accepted")
+	}
+	router.HandleFunc(policyPath, updatePolicy).Methods("PUT")
+	router.HandleFunc(policyPath, patchPolicy).Methods("PATCH")
+	router.HandleFunc(policyPath, getPolicy).Methods("GET")
+	router.HandleFunc(policyEventsPath, streamPolicyEvents).Methods("GET")
+	router.HandleFunc("/api/v1/policy/defaults", getPolicyDefaults).Methods("GET")
+	router.HandleFunc("/api/v1/policy/export", exportPolicy).Methods("GET")
+	if len(compareNamespaces) > 0 {
+		router.HandleFunc(comparePath, comparePolicies).Methods("GET")
+	}
+	router.HandleFunc("/api/v1/policy/render", previewPolicy).Methods("POST")
+	router.HandleFunc("/api/v1/policy/template/{name}", applyPolicyTemplate).Methods("POST")
+	router.HandleFunc("/api/v1/ping", ping).Methods("GET")
+	router.HandleFunc("/api/v1/status", getStatus).Methods("GET")
+	router.HandleFunc("/api/v1/admin/cache/flush", requireAdmin(flushAuthCache)).Methods("POST")
+	router.HandleFunc(auditPath, requireAdmin(getAudit)).Methods("GET")
+	router.HandleFunc(whoamiPath, whoami).Methods("GET")
+	if webUIEnabled {
+		router.HandleFunc("/", serveWebUI).Methods("GET")
+		router.PathPrefix(webUIAssetsPath).Handler(webUIAssets()).Methods("GET")
+	} else {
+		router.HandleFunc("/", serveRoot).Methods("GET")
+	}
+	router.HandleFunc("/robots.txt", robotsTxt).Methods("GET")
+	if serviceTokenStore != nil {
+		router.HandleFunc(serviceTokensPath, requireAdmin(serviceTokens)).Methods("POST", "GET")
+		router.HandleFunc(serviceTokensPath+"/{id}", requireAdmin(revokeServiceToken)).Methods("DELETE")
+	}
+	if pprofEnabled {
+		log.Printf("Profiling endpoints enabled under /debug/pprof")
+		registerPprof(router)
+	}
+
+	return router
+}
+
+// Handler returns the routes wrapped in the middleware chain.
+func (s *Server) Handler() http.Handler {
+	router := s.Router()
+
+	n := negroni.New()
+	n.Use(negroni.NewRecovery())
+	n.Use(negroni.HandlerFunc(logFieldsMiddleware))
+	if s.AccessLog != nil {
+		n.Use(s.AccessLog)
+	}
+	if securityHeadersEnabled {
+		n.Use(negroni.HandlerFunc(securityHeadersMiddleware))
+	}
+	if s.HTTPMetrics != nil {
+		if metricsExemplars {
+			n.Use(negroni.HandlerFunc(exemplarMiddleware))
+		}
+		n.Use(s.HTTPMetrics)
+	}
+	n.Use(negroni.HandlerFunc(headerLimitsMiddleware))
+	n.Use(negroni.HandlerFunc(timeoutMiddleware))
+	n.Use(optionsMiddleware(router))
+	n.Use(negroni.HandlerFunc(s.authMiddleware))
+	n.Use(negroni.HandlerFunc(roleMiddleware))
+	if requireNonce {
+		n.Use(negroni.HandlerFunc(nonceMiddleware))
+	}
+	n.Use(negroni.HandlerFunc(concurrencyMiddleware))
+	n.UseHandler(router)
+
+	return n
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	policy "github.com/filetrust/policy-update-service/pkg"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/shaj13/go-guardian/auth"
+)
+
+const serviceTokensPath = "/api/v1/admin/service-tokens"
+
+// serviceTokenPrefix starts every service token, so they are told apart from issued
+// JWTs without parsing. The token ID and a random secret follow, separated by dots.
+const serviceTokenPrefix = "svc."
+
+// serviceTokenExtension marks users authenticated with a service token.
+const serviceTokenExtension = "service_token"
+
+// serviceTokenUserPrefix starts the user name of every service token, so a token's
+// name can never pass for a user authenticated any other way.
+const serviceTokenUserPrefix = "service-token:"
+
+// serviceTokensConfigMap enables service tokens, long-lived bearer tokens for named
+// automation clients. Only a hash of each token is kept, in this config map.
+var (
+	serviceTokensConfigMap  = os.Getenv("SERVICE_TOKENS_CONFIGMAP")
+	serviceTokenMaxLifetime time.Duration
+	serviceTokenStore       *policy.TokenStore
+)
+
+var serviceTokenNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+func setupServiceTokens() error {
+	if serviceTokensConfigMap == "" {
+		return nil
+	}
+
+	var err error
+	serviceTokenMaxLifetime, err = durationFromEnv("SERVICE_TOKEN_MAX_LIFETIME", 90*24*time.Hour)
+	if err != nil {
+		return err
+	}
+
+	if err := policy.ValidateNames(namespace, serviceTokensConfigMap); err != nil {
+		return fmt.Errorf("SERVICE_TOKENS_CONFIGMAP: %v", err)
+	}
+
+	serviceTokenStore = &policy.TokenStore{Namespace: namespace, ConfigMapName: serviceTokensConfigMap}
+	if err := serviceTokenStore.GetClient(); err != nil {
+		return fmt.Errorf("SERVICE_TOKENS_CONFIGMAP needs a Kubernetes client: %v", err)
+	}
+
+	log.Printf("Service tokens enabled, recorded in config map %s/%s, maximum lifetime %v", namespace, serviceTokensConfigMap, serviceTokenMaxLifetime)
+	return nil
+}
+
+// serviceTokenRecord is what is kept of a service token. The token itself is only
+// returned when it is minted.
+type serviceTokenRecord struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Hash      string    `json:"hash,omitempty"`
+	Roles     []string  `json:"roles"`
+	IssuedBy  string    `json:"issuedBy"`
+	IssuedAt  time.Time `json:"issuedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type serviceTokenRequest struct {
+	Name     string   `json:"name"`
+	Lifetime string   `json:"lifetime"`
+	Roles    []string `json:"roles"`
+}
+
+type serviceTokenResponse struct {
+	serviceTokenRecord
+	Token string `json:"token"`
+}
+
+func hashServiceToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// verifyServiceToken authenticates a service token against its record. The user is
+// the token's name after serviceTokenUserPrefix, with the roles it was minted with and
+// the token ID as the jti so audit entries name the token.
+func verifyServiceToken(ctx context.Context, tokenString string) (auth.Info, error) {
+	parts := strings.Split(strings.TrimPrefix(tokenString, serviceTokenPrefix), ".")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("Invalid token")
+	}
+
+	data, ok, err := serviceTokenStore.Get(ctx, parts[0])
+	if err != nil {
+		loggerFromContext(ctx).Printf("Unable to read service token records: %v", err)
+		return nil, fmt.Errorf("Unable to verify token")
+	}
+	if !ok {
+		return nil, fmt.Errorf("Invalid token")
+	}
+
+	var record serviceTokenRecord
+	if err := json.Unmarshal([]byte(data), &record); err != nil {
+		loggerFromContext(ctx).Printf("Service token record %s is unreadable: %v", parts[0], err)
+		return nil, fmt.Errorf("Invalid token")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashServiceToken(tokenString)), []byte(record.Hash)) != 1 {
+		return nil, fmt.Errorf("Invalid token")
+	}
+
+	if time.Now().After(record.ExpiresAt) {
+		return nil, fmt.Errorf("Token expired")
+	}
+
+	return auth.NewDefaultUser(serviceTokenUserPrefix+record.Name, record.ID, record.Roles, map[string][]string{
+		tokenIDExtension:      {record.ID},
+		tokenExpiryExtension:  {strconv.FormatInt(record.ExpiresAt.Unix(), 10)},
+		serviceTokenExtension: {"true"},
+	}), nil
+}
+
+// isServiceTokenUser reports whether r was authenticated with a service token.
+func isServiceTokenUser(r *http.Request) bool {
+	id, _ := r.Context().Value(identityKey{}).(identity)
+	return id.info != nil && len(id.info.Extensions()[serviceTokenExtension]) > 0
+}
+
+// serviceTokens mints (POST) and lists (GET) service tokens. Service tokens cannot
+// manage service tokens themselves.
+func serviceTokens(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Methods", "*")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "*")
+	w.Header().Set("Access-Control-Expose-Headers", "*")
+
+	if isServiceTokenUser(r) {
+		writeError(w, http.StatusForbidden, codeForbidden, "Service tokens cannot manage service tokens.")
+		return
+	}
+
+	if r.Method == "GET" {
+		listServiceTokens(w, r)
+		return
+	}
+
+	mintServiceToken(w, r)
+}
+
+func mintServiceToken(w http.ResponseWriter, r *http.Request) {
+	limitRequestBody(w, r)
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	var req serviceTokenRequest
+	err := dec.Decode(&req)
+	if err == nil {
+		if _, err = dec.Token(); err == io.EOF {
+			err = nil
+		} else if err == nil {
+			err = errTrailingData
+		}
+	}
+	if err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	if !serviceTokenNamePattern.MatchString(req.Name) {
+		writeError(w, http.StatusBadRequest, codeValidation, "name must be 1-63 lowercase letters, digits or '-', starting and ending with a letter or digit.")
+		return
+	}
+
+	if problem := serviceTokenRolesProblem(req.Roles); problem != "" {
+		writeError(w, http.StatusBadRequest, codeValidation, problem)
+		return
+	}
+
+	lifetime := serviceTokenMaxLifetime
+	if req.Lifetime != "" {
+		lifetime, err = time.ParseDuration(req.Lifetime)
+		if err != nil || lifetime <= 0 || lifetime > serviceTokenMaxLifetime {
+			writeError(w, http.StatusBadRequest, codeValidation, fmt.Sprintf("lifetime must be a positive duration of at most %v.", serviceTokenMaxLifetime))
+			return
+		}
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		loggerFromContext(r.Context()).Printf("Unable to generate service token: %v", err)
+		writeError(w, http.StatusInternalServerError, codeInternal, "Something went wrong generating the token.")
+		return
+	}
+
+	now := time.Now().UTC()
+	record := serviceTokenRecord{
+		ID:        uuid.New().String(),
+		Name:      req.Name,
+		Roles:     req.Roles,
+		IssuedBy:  requestUser(r),
+		IssuedAt:  now,
+		ExpiresAt: now.Add(lifetime),
+	}
+	token := serviceTokenPrefix + record.ID + "." + hex.EncodeToString(secret)
+	record.Hash = hashServiceToken(token)
+
+	data, _ := json.Marshal(record)
+	if err := serviceTokenStore.Put(r.Context(), record.ID, string(data)); err != nil {
+		loggerFromContext(r.Context()).Printf("Unable to record service token: %v", err)
+		writeConfigMapError(w, err, "Something went wrong recording the token.")
+		return
+	}
+
+	countActivity(&activity.tokensIssued)
+	loggerFromContext(r.Context()).Printf("Service token %s for %s issued by %s, expires %s", record.ID, record.Name, requestActor(r), record.ExpiresAt.Format(time.RFC3339))
+	recordAudit(requestUser(r), "service_token.issued", fmt.Sprintf("Service token %s for %s issued, expires %s", record.ID, record.Name, record.ExpiresAt.Format(time.RFC3339)), "")
+
+	record.Hash = ""
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Location", serviceTokensPath+"/"+record.ID)
+	writeData(w, http.StatusCreated, serviceTokenResponse{serviceTokenRecord: record, Token: token}, nil)
+}
+
+// serviceTokenRolesProblem describes what is wrong with the roles requested for a
+// service token, or returns "". A service token needs at least one role, and only
+// roles ROLE_MAP names. The admin role is never granted, so service tokens can't use
+// the admin routes.
+func serviceTokenRolesProblem(roles []string) string {
+	allowed := map[string]bool{}
+	for _, role := range ownerRoles() {
+		allowed[role] = role != adminRole
+	}
+
+	if len(roles) == 0 {
+		return "roles must list at least one role."
+	}
+
+	for _, role := range roles {
+		if !allowed[role] {
+			return fmt.Sprintf("roles may only contain roles in ROLE_MAP other than %s, not %q.", adminRole, role)
+		}
+	}
+
+	return ""
+}
+
+func listServiceTokens(w http.ResponseWriter, r *http.Request) {
+	records, err := serviceTokenStore.List(r.Context())
+	if err != nil {
+		loggerFromContext(r.Context()).Printf("Unable to read service token records: %v", err)
+		writeConfigMapError(w, err, "Something went wrong reading the service tokens.")
+		return
+	}
+
+	tokens := make([]serviceTokenRecord, 0, len(records))
+	for id, data := range records {
+		var record serviceTokenRecord
+		if err := json.Unmarshal([]byte(data), &record); err != nil {
+			loggerFromContext(r.Context()).Printf("Service token record %s is unreadable: %v", id, err)
+			continue
+		}
+
+		record.Hash = ""
+		tokens = append(tokens, record)
+	}
+
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].IssuedAt.Before(tokens[j].IssuedAt) })
+	writeData(w, http.StatusOK, tokens, nil)
+}
+
+// revokeServiceToken deletes a service token's record, so it is rejected once any
+// cached authentication of it is gone. The auth cache of this replica is flushed
+// straight away.
+func revokeServiceToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Methods", "*")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "*")
+	w.Header().Set("Access-Control-Expose-Headers", "*")
+
+	if isServiceTokenUser(r) {
+		writeError(w, http.StatusForbidden, codeForbidden, "Service tokens cannot manage service tokens.")
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	deleted, err := serviceTokenStore.Delete(r.Context(), id)
+	if err != nil {
+		loggerFromContext(r.Context()).Printf("Unable to revoke service token %s: %v", id, err)
+		writeConfigMapError(w, err, "Something went wrong revoking the token.")
+		return
+	}
+
+	if !deleted {
+		writeError(w, http.StatusNotFound, codeNotFound, "The service token does not exist.")
+		return
+	}
+
+	for _, c := range authCaches {
+		c.flush()
+	}
+
+	loggerFromContext(r.Context()).Printf("Service token %s revoked by %s", id, requestActor(r))
+	recordAudit(requestUser(r), "service_token.revoked", fmt.Sprintf("Service token %s revoked", id), "")
+	w.WriteHeader(http.StatusNoContent)
+}
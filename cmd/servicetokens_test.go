@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	policy "github.com/filetrust/policy-update-service/pkg"
+)
+
+// useServiceTokens enables service tokens, recorded in a fake config map, for the rest
+// of the test.
+func useServiceTokens(t *testing.T) *policy.TokenStore {
+	client := useFakeClient(t)
+
+	previousStore, previousLifetime := serviceTokenStore, serviceTokenMaxLifetime
+	serviceTokenStore = &policy.TokenStore{Client: client, Namespace: namespace, ConfigMapName: "service-tokens"}
+	serviceTokenMaxLifetime = 24 * time.Hour
+	t.Cleanup(func() {
+		serviceTokenStore, serviceTokenMaxLifetime = previousStore, previousLifetime
+	})
+
+	return serviceTokenStore
+}
+
+func mintRequest(body string) *http.Request {
+	r := httptest.NewRequest("POST", serviceTokensPath, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	return r
+}
+
+func TestServiceTokenLifecycle(t *testing.T) {
+	store := useServiceTokens(t)
+	h := newTestHandler()
+
+	w := serve(h, asAdmin(mintRequest(`{"name":"ci-deploy","lifetime":"1h","roles":["policy-reader"]}`)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("mint status = %d, want %d: %s", w.Code, http.StatusCreated, w.Body)
+	}
+
+	var minted struct {
+		Data serviceTokenResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &minted); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(minted.Data.Token, serviceTokenPrefix) || minted.Data.Hash != "" {
+		t.Fatalf("minted token %q with hash %q, want a service token without its hash", minted.Data.Token, minted.Data.Hash)
+	}
+
+	records, err := store.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record := records[minted.Data.ID]; record == "" || strings.Contains(record, minted.Data.Token) {
+		t.Fatalf("stored record %q, want one holding only the token's hash", record)
+	}
+
+	whoamiRequest := func() *http.Request {
+		r := httptest.NewRequest("GET", whoamiPath, nil)
+		r.Header.Set("Authorization", "Bearer "+minted.Data.Token)
+		return r
+	}
+
+	w = serve(h, whoamiRequest())
+	if w.Code != http.StatusOK {
+		t.Fatalf("whoami status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	var who struct {
+		Data whoamiResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &who); err != nil {
+		t.Fatal(err)
+	}
+	if who.Data.User != "service-token:ci-deploy" || who.Data.Strategy != strategyServiceToken {
+		t.Errorf("service token authenticated as %q by %q, want service-token:ci-deploy by %s", who.Data.User, who.Data.Strategy, strategyServiceToken)
+	}
+	if len(who.Data.Groups) != 1 || who.Data.Groups[0] != roleReader {
+		t.Errorf("service token has roles %v, want [%s]", who.Data.Groups, roleReader)
+	}
+
+	// a reader token can read but not write
+	r := httptest.NewRequest("PUT", policyPath, strings.NewReader(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Authorization", "Bearer "+minted.Data.Token)
+	if w := serve(h, r); w.Code != http.StatusForbidden {
+		t.Errorf("PUT with a reader service token status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	w = serve(h, asAdmin(httptest.NewRequest("DELETE", serviceTokensPath+"/"+minted.Data.ID, nil)))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("revoke status = %d, want %d: %s", w.Code, http.StatusNoContent, w.Body)
+	}
+
+	if w := serve(h, whoamiRequest()); w.Code != http.StatusUnauthorized {
+		t.Errorf("whoami with a revoked token status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	w = serve(h, asAdmin(httptest.NewRequest("DELETE", serviceTokensPath+"/"+minted.Data.ID, nil)))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("second revoke status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestMintServiceTokenRejected(t *testing.T) {
+	useServiceTokens(t)
+	h := newTestHandler()
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "no roles", body: `{"name":"ci"}`},
+		{name: "admin role", body: `{"name":"ci","roles":["policy-admin"]}`},
+		{name: "unknown role", body: `{"name":"ci","roles":["root"]}`},
+		{name: "invalid name", body: `{"name":"CI Deploy","roles":["policy-writer"]}`},
+		{name: "lifetime over the maximum", body: `{"name":"ci","lifetime":"25h","roles":["policy-writer"]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serve(h, asAdmin(mintRequest(tt.body))); w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body)
+			}
+		})
+	}
+}
+
+func TestServiceTokensRequireAdmin(t *testing.T) {
+	useServiceTokens(t)
+
+	handler := requireAdmin(serviceTokens)
+	r := withIdentity(mintRequest(`{"name":"ci","roles":["policy-writer"]}`), "writer", roleWriter)
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("mint by a writer status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestServiceTokenCannotPassAsAnotherUser(t *testing.T) {
+	store := useServiceTokens(t)
+	defer func(admins map[string]bool) { freezeAdmins = admins }(freezeAdmins)
+	freezeAdmins = map[string]bool{"ci": true, "service-token:ci": true}
+
+	token := serviceTokenPrefix + "id.secret"
+	record, _ := json.Marshal(serviceTokenRecord{
+		ID:        "id",
+		Name:      "ci",
+		Hash:      hashServiceToken(token),
+		Roles:     []string{roleWriter},
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if err := store.Put(context.Background(), "id", string(record)); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := verifyServiceToken(context.Background(), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.UserName() != "service-token:ci" {
+		t.Errorf("user = %q, want service-token:ci", info.UserName())
+	}
+
+	r := httptest.NewRequest("PUT", policyPath, nil)
+	r = r.WithContext(context.WithValue(r.Context(), identityKey{}, identity{user: info.UserName(), tokenID: "id", info: info}))
+	if isFreezeAdmin(r) {
+		t.Error("a service token was accepted as a freeze admin")
+	}
+}
+
+func TestExpiredServiceTokenRejected(t *testing.T) {
+	store := useServiceTokens(t)
+
+	token := serviceTokenPrefix + "old.secret"
+	record, _ := json.Marshal(serviceTokenRecord{
+		ID:        "old",
+		Name:      "ci",
+		Hash:      hashServiceToken(token),
+		Roles:     []string{roleWriter},
+		ExpiresAt: time.Now().Add(-time.Minute),
+	})
+	if err := store.Put(context.Background(), "old", string(record)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := verifyServiceToken(context.Background(), token); err == nil {
+		t.Error("an expired service token was accepted")
+	}
+}
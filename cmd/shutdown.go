@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// shutdownTimeout bounds how long shutdown waits for in-flight requests and then for
+// background tasks to finish, each.
+var shutdownTimeout time.Duration
+
+func setupShutdownTimeout() error {
+	var err error
+	shutdownTimeout, err = durationFromEnv("SHUTDOWN_TIMEOUT", 30*time.Second)
+	return err
+}
+
+// backgroundTasks tracks the goroutines that run for the life of the service. Each
+// observes the context it is started with; shutdown cancels it and waits for them.
+type backgroundTasks struct {
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	running map[string]bool
+}
+
+func newBackgroundTasks() *backgroundTasks {
+	return &backgroundTasks{running: map[string]bool{}}
+}
+
+// start runs task in its own goroutine under name until it returns.
+func (t *backgroundTasks) start(ctx context.Context, name string, task func(context.Context)) {
+	t.mu.Lock()
+	t.running[name] = true
+	t.mu.Unlock()
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		task(ctx)
+
+		t.mu.Lock()
+		delete(t.running, name)
+		t.mu.Unlock()
+		log.Printf("Background task %s stopped", name)
+	}()
+}
+
+// wait blocks until every task has returned or timeout has passed, and reports whether
+// they all returned. Tasks still running at the timeout are logged.
+func (t *backgroundTasks) wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var names []string
+	for name := range t.running {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	log.Printf("Background tasks still running after %v: %v", timeout, names)
+	return false
+}
+
+// shutdown stops server and then the background tasks started with the context cancel
+// belongs to, and logs the shutdown summary. Requests in flight finish before the tasks
+// are stopped, so a request's write is never cut off by the reconciler's exit.
+func shutdown(server *http.Server, cancel context.CancelFunc, tasks *backgroundTasks) {
+	ctx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelShutdown()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Server did not shut down cleanly: %v", err)
+	}
+
+	cancel()
+	if tasks.wait(shutdownTimeout) {
+		log.Printf("All background tasks stopped")
+	}
+
+	writeShutdownSummary()
+}
+
+// logShutdownSummary logs the activity counters once the service has stopped, so a
+// short run leaves a record even if its last metrics were never scraped.
+var logShutdownSummary = os.Getenv("LOG_SHUTDOWN_SUMMARY") == "true"
+
+var processStart = time.Now()
+
+// activity counts what the service did since startup for the shutdown summary. The
+// fields are updated atomically.
+var activity struct {
+	policyWrites        int64
+	policyWriteFailures int64
+	authSuccesses       int64
+	authFailures        int64
+	tokensIssued        int64
+}
+
+func countActivity(counter *int64) {
+	atomic.AddInt64(counter, 1)
+}
+
+func writeShutdownSummary() {
+	if !logShutdownSummary {
+		return
+	}
+
+	log.Printf("level=info event=shutdown_summary uptime=%s policy_writes=%d policy_write_failures=%d auth_successes=%d auth_failures=%d tokens_issued=%d",
+		time.Since(processStart).Round(time.Second),
+		atomic.LoadInt64(&activity.policyWrites),
+		atomic.LoadInt64(&activity.policyWriteFailures),
+		atomic.LoadInt64(&activity.authSuccesses),
+		atomic.LoadInt64(&activity.authFailures),
+		atomic.LoadInt64(&activity.tokensIssued))
+}
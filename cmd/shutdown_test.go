@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useShutdownSummary sets LOG_SHUTDOWN_SUMMARY to enabled with the activity counters
+// starting from zero for the rest of the test.
+func useShutdownSummary(t *testing.T, enabled bool) {
+	previous, previousActivity := logShutdownSummary, activity
+	logShutdownSummary = enabled
+	activity.policyWrites, activity.policyWriteFailures = 0, 0
+	activity.authSuccesses, activity.authFailures, activity.tokensIssued = 0, 0, 0
+	t.Cleanup(func() { logShutdownSummary, activity = previous, previousActivity })
+}
+
+// shutdownLogs runs the shutdown path with a background task and returns what it
+// logged.
+func shutdownLogs(t *testing.T) []string {
+	logs := captureLogs(t)
+	previous := shutdownTimeout
+	shutdownTimeout = time.Second
+	t.Cleanup(func() { shutdownTimeout = previous })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	tasks := newBackgroundTasks()
+	tasks.start(ctx, "test task", func(ctx context.Context) { <-ctx.Done() })
+	shutdown(&http.Server{}, cancel, tasks)
+
+	var messages []string
+	for _, record := range logs() {
+		messages = append(messages, record["msg"].(string))
+	}
+
+	return messages
+}
+
+func TestShutdownSummary(t *testing.T) {
+	useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`))
+	useShutdownSummary(t, true)
+	handler := newTestHandler()
+
+	putPolicy(handler, `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":1}`)
+	unauthenticated := httptest.NewRequest("GET", policyPath, nil)
+	unauthenticated.SetBasicAuth(username, "wrong-password")
+	serve(handler, unauthenticated)
+	createToken(httptest.NewRecorder(), withIdentity(httptest.NewRequest("GET", tokenPath, nil), "alice", roleReader))
+
+	messages := shutdownLogs(t)
+	last := messages[len(messages)-1]
+	want := "policy_writes=1 policy_write_failures=0 auth_successes=1 auth_failures=1 tokens_issued=1"
+	if !strings.HasPrefix(last, "level=info event=shutdown_summary uptime=") || !strings.HasSuffix(last, want) {
+		t.Errorf("last log = %q, want the shutdown summary ending %q", last, want)
+	}
+	if !strings.Contains(strings.Join(messages, "\n"), "All background tasks stopped") {
+		t.Errorf("logs = %q, want the background tasks stopped before the summary", messages)
+	}
+}
+
+func TestShutdownWithoutSummary(t *testing.T) {
+	useShutdownSummary(t, false)
+
+	for _, message := range shutdownLogs(t) {
+		if strings.Contains(message, "shutdown_summary") {
+			t.Errorf("summary %q logged without LOG_SHUTDOWN_SUMMARY", message)
+		}
+	}
+}
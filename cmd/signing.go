@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	signingAlgHS256 = "HS256"
+	signingAlgEdDSA = "EdDSA"
+)
+
+var (
+	jwtSigningAlg     = os.Getenv("JWT_SIGNING_ALG")
+	jwtPrivateKeyFile = os.Getenv("JWT_PRIVATE_KEY_FILE")
+	jwtPublicKeyFile  = os.Getenv("JWT_PUBLIC_KEY_FILE")
+
+	// tokenSigningMethod is the only algorithm tokens are issued or accepted with.
+	tokenSigningMethod jwt.SigningMethod = jwt.SigningMethodHS256
+
+	// Ed25519 keys used instead of JWT_SECRET when JWT_SIGNING_ALG is EdDSA. Without
+	// a private key tokens are verified but not issued.
+	edPrivateKey ed25519.PrivateKey
+	edPublicKey  ed25519.PublicKey
+)
+
+// setupSigning selects how bearer tokens are signed. HS256, the default, uses
+// JWT_SECRET; EdDSA uses the Ed25519 keys in the PEM files JWT_PRIVATE_KEY_FILE and
+// JWT_PUBLIC_KEY_FILE, typically mounted from a Kubernetes Secret. The public key is
+// derived from the private key when only that is given.
+func setupSigning() error {
+	switch jwtSigningAlg {
+	case "", signingAlgHS256:
+		return nil
+	case signingAlgEdDSA:
+	default:
+		return fmt.Errorf("JWT_SIGNING_ALG must be one of %s, %s", signingAlgHS256, signingAlgEdDSA)
+	}
+
+	tokenSigningMethod = jwt.SigningMethodEdDSA
+
+	if jwtPrivateKeyFile != "" {
+		b, err := ioutil.ReadFile(jwtPrivateKeyFile)
+		if err != nil {
+			return fmt.Errorf("unable to read JWT_PRIVATE_KEY_FILE: %v", err)
+		}
+
+		key, err := jwt.ParseEdPrivateKeyFromPEM(b)
+		if err != nil {
+			return fmt.Errorf("JWT_PRIVATE_KEY_FILE is not an Ed25519 private key: %v", err)
+		}
+
+		edPrivateKey = key.(ed25519.PrivateKey)
+		edPublicKey = edPrivateKey.Public().(ed25519.PublicKey)
+	}
+
+	if jwtPublicKeyFile != "" {
+		b, err := ioutil.ReadFile(jwtPublicKeyFile)
+		if err != nil {
+			return fmt.Errorf("unable to read JWT_PUBLIC_KEY_FILE: %v", err)
+		}
+
+		key, err := jwt.ParseEdPublicKeyFromPEM(b)
+		if err != nil {
+			return fmt.Errorf("JWT_PUBLIC_KEY_FILE is not an Ed25519 public key: %v", err)
+		}
+
+		public := key.(ed25519.PublicKey)
+		if edPublicKey != nil && !edPublicKey.Equal(public) {
+			return errors.New("JWT_PUBLIC_KEY_FILE does not match JWT_PRIVATE_KEY_FILE")
+		}
+		edPublicKey = public
+	}
+
+	if edPublicKey == nil {
+		return errors.New("JWT_SIGNING_ALG=EdDSA requires JWT_PRIVATE_KEY_FILE or JWT_PUBLIC_KEY_FILE")
+	}
+
+	if edPrivateKey == nil {
+		log.Printf("No JWT_PRIVATE_KEY_FILE, bearer tokens are verified with the Ed25519 public key but not issued")
+	}
+
+	return nil
+}
+
+// tokenSigningKey returns the key tokens are signed with, or nil if this instance
+// can't issue tokens.
+func tokenSigningKey() interface{} {
+	if tokenSigningMethod == jwt.SigningMethodEdDSA {
+		if edPrivateKey == nil {
+			return nil
+		}
+		return edPrivateKey
+	}
+
+	return []byte(jwtSecret)
+}
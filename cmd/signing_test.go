@@ -0,0 +1,230 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// writePEM writes der as a PEM block of type blockType to a file in dir and returns its
+// path.
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	file := filepath.Join(dir, name)
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return file
+}
+
+// useEdDSA sets JWT_SIGNING_ALG=EdDSA with a new Ed25519 key for the rest of the test,
+// given as the public key only unless issuing is set.
+func useEdDSA(t *testing.T, issuing bool) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previousAlg, previousPrivateFile, previousPublicFile := jwtSigningAlg, jwtPrivateKeyFile, jwtPublicKeyFile
+	previousMethod, previousPrivate, previousPublic := tokenSigningMethod, edPrivateKey, edPublicKey
+	t.Cleanup(func() {
+		jwtSigningAlg, jwtPrivateKeyFile, jwtPublicKeyFile = previousAlg, previousPrivateFile, previousPublicFile
+		tokenSigningMethod, edPrivateKey, edPublicKey = previousMethod, previousPrivate, previousPublic
+	})
+
+	dir := t.TempDir()
+	jwtSigningAlg, jwtPrivateKeyFile = signingAlgEdDSA, ""
+	jwtPublicKeyFile = writePEM(t, dir, "jwt.pub", "PUBLIC KEY", publicDER)
+	if issuing {
+		jwtPrivateKeyFile = writePEM(t, dir, "jwt.key", "PRIVATE KEY", privateDER)
+	}
+	edPrivateKey, edPublicKey = nil, nil
+
+	if err := setupSigning(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// issueToken returns the token createToken issues to user as a reader.
+func issueToken(t *testing.T, user string) string {
+	return issueTokenWithRoles(t, user, roleReader)
+}
+
+// issueTokenWithRoles returns a token issued to user holding roles.
+func issueTokenWithRoles(t *testing.T, user string, roles ...string) string {
+	w := httptest.NewRecorder()
+	createToken(w, withIdentity(httptest.NewRequest("GET", tokenPath, nil), user, roles...))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+
+	return w.Body.String()
+}
+
+// resign returns the claims of token signed again with method and key.
+func resign(t *testing.T, token string, method jwt.SigningMethod, key interface{}) string {
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed
+}
+
+// whoamiWithToken returns the status of a whoami request with the bearer token.
+func whoamiWithToken(token string) int {
+	r := httptest.NewRequest("GET", whoamiPath, nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	return serve(newTestHandler(), r).Code
+}
+
+func TestEdDSAToken(t *testing.T) {
+	useEdDSA(t, true)
+
+	token := issueToken(t, "alice")
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alg := parsed.Header["alg"]; alg != signingAlgEdDSA {
+		t.Errorf("alg = %v, want %s", alg, signingAlgEdDSA)
+	}
+
+	if status := whoamiWithToken(token); status != http.StatusOK {
+		t.Errorf("whoami with the issued token = %d, want %d", status, http.StatusOK)
+	}
+}
+
+func TestEdDSARejectsOtherAlgorithms(t *testing.T) {
+	useEdDSA(t, true)
+	token := issueToken(t, "alice")
+
+	// the same claims signed with JWT_SECRET, as a token from before the switch would be
+	if status := whoamiWithToken(resign(t, token, jwt.SigningMethodHS256, []byte(jwtSecret))); status != http.StatusUnauthorized {
+		t.Errorf("whoami with an HS256 token = %d, want %d", status, http.StatusUnauthorized)
+	}
+
+	// and with another Ed25519 key
+	_, other, _ := ed25519.GenerateKey(rand.Reader)
+	if status := whoamiWithToken(resign(t, token, jwt.SigningMethodEdDSA, other)); status != http.StatusUnauthorized {
+		t.Errorf("whoami with a token signed by another key = %d, want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestHS256RejectsEdDSA(t *testing.T) {
+	token := issueToken(t, "alice")
+	if status := whoamiWithToken(token); status != http.StatusOK {
+		t.Fatalf("whoami with an HS256 token = %d, want %d", status, http.StatusOK)
+	}
+
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	if status := whoamiWithToken(resign(t, token, jwt.SigningMethodEdDSA, key)); status != http.StatusUnauthorized {
+		t.Errorf("whoami with an EdDSA token = %d, want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestEdDSAVerifyOnly(t *testing.T) {
+	useEdDSA(t, false)
+
+	w := httptest.NewRecorder()
+	createToken(w, withIdentity(httptest.NewRequest("GET", tokenPath, nil), "alice", roleReader))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("token request without a private key = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+// signHS256 returns claims signed with JWT_SECRET.
+func signHS256(t *testing.T, claims jwt.MapClaims) string {
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(jwtSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed
+}
+
+func TestLegacyTokenVerifies(t *testing.T) {
+	// the claims tokens were issued with before the move to golang-jwt/jwt/v5
+	token := signHS256(t, jwt.MapClaims{
+		"iss": "auth-app",
+		"sub": username,
+		"aud": "any",
+		"exp": time.Now().Add(5 * time.Minute).Unix(),
+	})
+
+	if status := whoamiWithToken(token); status != http.StatusOK {
+		t.Errorf("whoami with a token in the legacy shape = %d, want %d", status, http.StatusOK)
+	}
+}
+
+func TestAlgorithmConfusionRejected(t *testing.T) {
+	token := issueToken(t, "alice")
+
+	unsigned := resign(t, token, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType)
+	if status := whoamiWithToken(unsigned); status != http.StatusUnauthorized {
+		t.Errorf("whoami with an unsigned token = %d, want %d", status, http.StatusUnauthorized)
+	}
+
+	// other HMAC algorithms with the right secret are still not HS256
+	for _, method := range []jwt.SigningMethod{jwt.SigningMethodHS384, jwt.SigningMethodHS512} {
+		if status := whoamiWithToken(resign(t, token, method, []byte(jwtSecret))); status != http.StatusUnauthorized {
+			t.Errorf("whoami with an %s token = %d, want %d", method.Alg(), status, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestRegisteredClaimsRequired(t *testing.T) {
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss": tokenIssuer,
+			"sub": "alice",
+			"aud": tokenAudience,
+			"exp": time.Now().Add(time.Minute).Unix(),
+		}
+	}
+
+	tests := []struct {
+		name   string
+		change func(jwt.MapClaims)
+	}{
+		{name: "no expiry", change: func(c jwt.MapClaims) { delete(c, "exp") }},
+		{name: "expired", change: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }},
+		{name: "other issuer", change: func(c jwt.MapClaims) { c["iss"] = "someone-else" }},
+		{name: "other audience", change: func(c jwt.MapClaims) { c["aud"] = "another-service" }},
+		{name: "no subject", change: func(c jwt.MapClaims) { delete(c, "sub") }},
+	}
+
+	if status := whoamiWithToken(signHS256(t, valid())); status != http.StatusOK {
+		t.Fatalf("whoami with valid claims = %d, want %d", status, http.StatusOK)
+	}
+
+	for _, tt := range tests {
+		claims := valid()
+		tt.change(claims)
+		if status := whoamiWithToken(signHS256(t, claims)); status != http.StatusUnauthorized {
+			t.Errorf("%s: whoami = %d, want %d", tt.name, status, http.StatusUnauthorized)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+var splitKeys = []string{"UnprocessableFileTypeAction", "GlasswallBlockedFilesAction"}
+
+// configMapWithData returns the policy config map holding data.
+func configMapWithData(data map[string]string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: configmapName, Namespace: namespace, ResourceVersion: "1"},
+		Data:       data,
+	}
+}
+
+// storedData returns the data of the policy config map.
+func storedData(t *testing.T, client kubernetes.Interface) map[string]string {
+	configMap, err := client.CoreV1().ConfigMaps(namespace).Get(context.Background(), configmapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return configMap.Data
+}
+
+// getPolicyJSON returns the status and body of a GET of the policy.
+func getPolicyJSON(handler http.Handler) (int, string) {
+	w := serve(handler, asAdmin(httptest.NewRequest("GET", policyPath, nil)))
+	return w.Code, w.Body.String()
+}
+
+// containsAll reports whether s contains every one of parts.
+func containsAll(s string, parts ...string) bool {
+	for _, part := range parts {
+		if !strings.Contains(s, part) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestCombinedPolicyKey(t *testing.T) {
+	client := useFakeClient(t, configMapWithData(map[string]string{"other": "kept"}))
+	usePolicyKeys(t, nil)
+	handler := newTestHandler()
+
+	if w := putPolicy(handler, `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":3}`); w.Code != http.StatusOK {
+		t.Fatalf("PUT status = %d: %s", w.Code, w.Body)
+	}
+
+	want := map[string]string{"other": "kept", "appsettings.json": `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":3}` + "\n"}
+	if got := storedData(t, client); !reflect.DeepEqual(got, want) {
+		t.Errorf("stored %v, want %v", got, want)
+	}
+
+	code, body := getPolicyJSON(handler)
+	if code != http.StatusOK || !containsAll(body, `"UnprocessableFileTypeAction":2`, `"GlasswallBlockedFilesAction":3`) {
+		t.Errorf("GET = %d %s, want the stored policy", code, body)
+	}
+}
+
+func TestSplitPolicyKeys(t *testing.T) {
+	// a combined document already stored is left for whoever else reads it
+	combined := `{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`
+	client := useFakeClient(t, configMapWithData(map[string]string{"appsettings.json": combined}))
+	usePolicyKeys(t, splitKeys)
+	handler := newTestHandler()
+
+	if w := putPolicy(handler, `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":3}`); w.Code != http.StatusOK {
+		t.Fatalf("PUT status = %d: %s", w.Code, w.Body)
+	}
+
+	want := map[string]string{"appsettings.json": combined, "UnprocessableFileTypeAction": "2", "GlasswallBlockedFilesAction": "3"}
+	if got := storedData(t, client); !reflect.DeepEqual(got, want) {
+		t.Errorf("stored %v, want %v", got, want)
+	}
+
+	code, body := getPolicyJSON(handler)
+	if code != http.StatusOK || !containsAll(body, `"UnprocessableFileTypeAction":2`, `"GlasswallBlockedFilesAction":3`) {
+		t.Errorf("GET = %d %s, want the policy reassembled from its keys", code, body)
+	}
+}
+
+func TestSplitPolicyKeysPartlyPresent(t *testing.T) {
+	client := useFakeClient(t, configMapWithData(map[string]string{"UnprocessableFileTypeAction": "2"}))
+	usePolicyKeys(t, splitKeys)
+	handler := newTestHandler()
+
+	code, body := getPolicyJSON(handler)
+	if code != http.StatusOK || !containsAll(body, `"UnprocessableFileTypeAction":2`, `"GlasswallBlockedFilesAction":null`) {
+		t.Errorf("GET = %d %s, want the missing key read as null", code, body)
+	}
+
+	// a PUT writes every key, completing the policy
+	if w := putPolicy(handler, `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":4}`); w.Code != http.StatusOK {
+		t.Fatalf("PUT status = %d: %s", w.Code, w.Body)
+	}
+	want := map[string]string{"UnprocessableFileTypeAction": "2", "GlasswallBlockedFilesAction": "4"}
+	if got := storedData(t, client); !reflect.DeepEqual(got, want) {
+		t.Errorf("stored %v, want %v", got, want)
+	}
+}
+
+func TestSplitPolicyKeysAbsent(t *testing.T) {
+	useFakeClient(t, configMapWithData(map[string]string{"appsettings.json": `{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`}))
+	usePolicyKeys(t, splitKeys)
+
+	if code, body := getPolicyJSON(newTestHandler()); code != http.StatusNotFound {
+		t.Errorf("GET = %d %s, want 404 with none of the split keys stored", code, body)
+	}
+}
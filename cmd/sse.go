@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const policyEventsPath = "/api/v1/policy/events"
+
+// eventHeartbeat is how often an idle event stream gets a comment line, so proxies and
+// load balancers don't close it.
+const eventHeartbeat = 15 * time.Second
+
+// eventBuffer is how many changes a stream may fall behind by. A client that can't keep
+// up is disconnected rather than slowing down writes; it can reconnect and GET the
+// policy to catch up.
+const eventBuffer = 16
+
+// maxEventSubscribers bounds the number of open event streams. Streams don't hold a
+// concurrency slot or fall under REQUEST_TIMEOUT, so they are limited separately.
+var maxEventSubscribers int
+
+func setupEventStreams() error {
+	var err error
+	maxEventSubscribers, err = intFromEnv("MAX_EVENT_SUBSCRIBERS", 100)
+	return err
+}
+
+// policyChange is the data of a policy event.
+type policyChange struct {
+	Policy          interface{} `json:"policy"`
+	Outcome         string      `json:"outcome"`
+	ResourceVersion string      `json:"resourceVersion,omitempty"`
+	By              string      `json:"by"`
+	Time            string      `json:"time"`
+}
+
+// policyEvents fans policy changes made by this replica out to the open event streams.
+var policyEvents = &eventBroker{subscribers: map[chan []byte]struct{}{}}
+
+type eventBroker struct {
+	mu          sync.Mutex
+	subscribers map[chan []byte]struct{}
+	sequence    int
+	closed      bool
+}
+
+// subscribe registers a stream, or returns nil when maxEventSubscribers are open or
+// the broker is closed.
+func (b *eventBroker) subscribe() chan []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed || len(b.subscribers) >= maxEventSubscribers {
+		return nil
+	}
+
+	ch := make(chan []byte, eventBuffer)
+	b.subscribers[ch] = struct{}{}
+	return ch
+}
+
+// count returns the number of open streams.
+func (b *eventBroker) count() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.subscribers)
+}
+
+// unsubscribe removes a stream when its client disconnects. A stream already closed for
+// falling behind has been removed by publish.
+func (b *eventBroker) unsubscribe(ch chan []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[ch]; ok {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// close ends every open stream and refuses new ones. It runs when the server shuts
+// down, which otherwise waits for the streams until its timeout.
+func (b *eventBroker) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// publish sends a change to every stream. A stream whose buffer is full is closed.
+func (b *eventBroker) publish(change policyChange) {
+	data, err := json.Marshal(change)
+	if err != nil {
+		log.Printf("Unable to encode policy event: %v", err)
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.sequence++
+	event := []byte(fmt.Sprintf("id: %d\nevent: policy\ndata: %s\n\n", b.sequence, data))
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			log.Printf("Closing a policy event stream that fell %d events behind", eventBuffer)
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// publishPolicyChange announces a stored policy document that changed the config map.
+func publishPolicyChange(document, outcome, resourceVersion, by string) {
+	var p Policy
+	if err := json.Unmarshal([]byte(document), &p); err != nil {
+		log.Printf("Unable to decode changed policy for event: %s", redactPolicyError(err))
+		return
+	}
+
+	policyEvents.publish(policyChange{
+		Policy:          policyView(p),
+		Outcome:         outcome,
+		ResourceVersion: resourceVersion,
+		By:              by,
+		Time:            time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+// streamPolicyEvents streams a server-sent event for each policy change made through
+// this replica until the client disconnects.
+func streamPolicyEvents(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Methods", "*")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "*")
+	w.Header().Set("Access-Control-Expose-Headers", "*")
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, codeInternal, "Streaming is not supported.")
+		return
+	}
+
+	events := policyEvents.subscribe()
+	if events == nil {
+		w.Header().Set("Retry-After", "5")
+		writeError(w, http.StatusServiceUnavailable, codeOverloaded, "Too many event subscribers, retry later.")
+		return
+	}
+	defer policyEvents.unsubscribe(events)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if _, err := w.Write(event); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := w.Write([]byte(": heartbeat\n\n")); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// useEventBroker replaces the event broker with an empty one for the rest of the test.
+func useEventBroker(t *testing.T) *eventBroker {
+	previous := policyEvents
+	policyEvents = &eventBroker{subscribers: map[chan []byte]struct{}{}}
+	t.Cleanup(func() { policyEvents = previous })
+
+	return policyEvents
+}
+
+// openEventStream connects to the event stream of server as the admin and waits until
+// it is subscribed.
+func openEventStream(t *testing.T, server *httptest.Server) (*http.Response, *bufio.Reader) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	r, _ := http.NewRequestWithContext(ctx, "GET", server.URL+policyEventsPath, nil)
+	r.SetBasicAuth(username, password)
+	res, err := server.Client().Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { res.Body.Close() })
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", res.StatusCode, http.StatusOK)
+	}
+
+	for policyEvents.count() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	return res, bufio.NewReader(res.Body)
+}
+
+// readEvent reads one event from a stream, skipping heartbeats.
+func readEvent(t *testing.T, events *bufio.Reader) string {
+	var lines []string
+	for {
+		line, err := events.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading event: %v", err)
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" && len(lines) > 0 {
+			return strings.Join(lines, "\n")
+		}
+		if line != "" && !strings.HasPrefix(line, ":") {
+			lines = append(lines, line)
+		}
+	}
+}
+
+func TestPolicyUpdateReachesEventStream(t *testing.T) {
+	useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`))
+	useEventBroker(t)
+	server := httptest.NewServer(newTestHandler())
+	defer server.Close()
+
+	_, events := openEventStream(t, server)
+
+	r := asAdmin(httptest.NewRequest("PUT", policyPath, strings.NewReader(`{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":3}`)))
+	r.Header.Set("Content-Type", "application/json")
+	if w := serve(newTestHandler(), r); w.Code != http.StatusOK {
+		t.Fatalf("PUT status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+
+	event := readEvent(t, events)
+	for _, want := range []string{"event: policy", `"UnprocessableFileTypeAction":2`, `"GlasswallBlockedFilesAction":3`, `"outcome":"updated"`, `"by":"admin`} {
+		if !strings.Contains(event, want) {
+			t.Errorf("event %q does not contain %s", event, want)
+		}
+	}
+}
+
+func TestEventStreamRequiresReadRole(t *testing.T) {
+	useEventBroker(t)
+	router := (&Server{}).Router()
+	handler := handlerFor(roleMiddleware)
+
+	w := httptest.NewRecorder()
+	handler(w, withIdentity(httptest.NewRequest("GET", policyEventsPath, nil), "nobody"))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("stream without roles status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	// a reader is let through, and the stream ends with the broker
+	policyEvents.close()
+	r := withIdentity(httptest.NewRequest("GET", policyEventsPath, nil), "reader", roleReader)
+	if w := serve(router, r); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("stream of a closed broker status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestShutdownEndsEventStreams(t *testing.T) {
+	useEventBroker(t)
+	server := httptest.NewUnstartedServer(newTestHandler())
+	server.Config.RegisterOnShutdown(policyEvents.close)
+	server.Start()
+	defer server.Close()
+
+	_, events := openEventStream(t, server)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := server.Config.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown with an open stream: %v", err)
+	}
+
+	if _, err := events.ReadString('\n'); err == nil {
+		t.Error("stream still open after shutdown")
+	}
+}
+
+func TestEventSubscriberCap(t *testing.T) {
+	useEventBroker(t)
+	previous := maxEventSubscribers
+	maxEventSubscribers = 1
+	t.Cleanup(func() { maxEventSubscribers = previous })
+	server := httptest.NewServer(newTestHandler())
+	defer server.Close()
+
+	first, _ := openEventStream(t, server)
+	if subscribers := testutil.ToFloat64(svcMetrics.eventSubscribers); subscribers != 1 {
+		t.Errorf("subscribers gauge = %v, want 1", subscribers)
+	}
+
+	r, _ := http.NewRequest("GET", server.URL+policyEventsPath, nil)
+	r.SetBasicAuth(username, password)
+	res, err := server.Client().Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body errorResponse
+	json.NewDecoder(res.Body).Decode(&body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusServiceUnavailable || body.Code != codeOverloaded {
+		t.Errorf("stream over the cap = %d %q, want %d %q", res.StatusCode, body.Code, http.StatusServiceUnavailable, codeOverloaded)
+	}
+	if retry := res.Header.Get("Retry-After"); retry == "" {
+		t.Error("stream over the cap has no Retry-After")
+	}
+
+	// the first subscriber disconnects, which frees its slot
+	first.Body.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for policyEvents.count() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("disconnected subscriber still counted")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	second, _ := openEventStream(t, server)
+	second.Body.Close()
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	policy "github.com/filetrust/policy-update-service/pkg"
+)
+
+const (
+	statusOK       = "ok"
+	statusDegraded = "degraded"
+	statusDown     = "down"
+)
+
+var (
+	statusSeverity = map[string]int{statusOK: 0, statusDegraded: 1, statusDown: 2}
+	statusCodes    = map[string]int{statusOK: http.StatusOK, statusDegraded: http.StatusOK, statusDown: http.StatusServiceUnavailable}
+)
+
+var (
+	lastWriteMu   sync.Mutex
+	lastWriteAt   time.Time
+	lastWriteErr  error
+	lastWriteOKAt time.Time
+
+	// lastWriteFailAt starts out as the start of the process, so the time since the
+	// last failure counts from startup until a write first fails.
+	lastWriteFailAt          = time.Now()
+	consecutiveWriteFailures int
+)
+
+// recordWrite keeps the outcome of the latest policy write for the status endpoint and
+// the write failure metrics.
+func recordWrite(err error) {
+	lastWriteMu.Lock()
+	defer lastWriteMu.Unlock()
+
+	lastWriteAt = time.Now()
+	lastWriteErr = err
+	if err == nil {
+		lastWriteOKAt = lastWriteAt
+		consecutiveWriteFailures = 0
+		countActivity(&activity.policyWrites)
+	} else {
+		lastWriteFailAt = lastWriteAt
+		consecutiveWriteFailures++
+		countActivity(&activity.policyWriteFailures)
+	}
+
+	svcMetrics.consecutiveWriteFailures.Set(float64(consecutiveWriteFailures))
+}
+
+// secondsSinceWriteFailure backs gw_ncfspolicyupdate_seconds_since_last_write_failure.
+func secondsSinceWriteFailure() float64 {
+	lastWriteMu.Lock()
+	defer lastWriteMu.Unlock()
+
+	return time.Since(lastWriteFailAt).Seconds()
+}
+
+type componentStatus struct {
+	Status string      `json:"status"`
+	Detail interface{} `json:"detail,omitempty"`
+}
+
+type statusResponse struct {
+	Status     string                     `json:"status"`
+	Components map[string]componentStatus `json:"components"`
+}
+
+// getStatus reports the health of each part of the service. Degraded components still
+// leave the service usable, so only a component that is down makes it answer 503.
+func getStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Methods", "*")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "*")
+	w.Header().Set("Access-Control-Expose-Headers", "*")
+
+	components := map[string]componentStatus{}
+	components["apiServer"], components["storedPolicy"] = apiServerStatus(r.Context())
+	components["lastUpdate"] = lastUpdateStatus()
+	components["policyCache"] = policyCacheStatus()
+	components["authCache"] = authCacheStatus()
+	if gitPolicyURL != "" {
+		components["gitSync"] = gitSyncStatus()
+	}
+
+	overall := statusOK
+	for _, c := range components {
+		if statusSeverity[c.Status] > statusSeverity[overall] {
+			overall = c.Status
+		}
+	}
+
+	writeData(w, statusCodes[overall], statusResponse{Status: overall, Components: components}, nil)
+}
+
+// apiServerStatus reads the policy to check the API server is reachable, and checks the
+// policy it returns against the current validation rules.
+func apiServerStatus(ctx context.Context) (componentStatus, componentStatus) {
+	args := policy.PolicyArgs{
+		Namespace:     namespace,
+		ConfigMapName: configmapName,
+		PolicyKeys:    policyKeys,
+	}
+
+	err := args.GetClient()
+	if err != nil {
+		down := componentStatus{Status: statusDown, Detail: err.Error()}
+		return down, down
+	}
+
+	start := time.Now()
+	current, err := args.GetPolicy(ctx)
+	latency := fmt.Sprintf("%dms", time.Since(start).Milliseconds())
+	if err != nil {
+		down := componentStatus{Status: statusDown, Detail: err.Error()}
+		return down, down
+	}
+
+	reachable := componentStatus{Status: statusOK, Detail: latency}
+
+	if current == "" {
+		return reachable, componentStatus{Status: statusDegraded, Detail: "no policy has been stored"}
+	}
+
+	if err := validateStoredDocument(current); err != nil {
+		return reachable, componentStatus{Status: statusDegraded, Detail: err.Error()}
+	}
+
+	return reachable, componentStatus{Status: statusOK}
+}
+
+func lastUpdateStatus() componentStatus {
+	lastWriteMu.Lock()
+	defer lastWriteMu.Unlock()
+
+	if lastWriteAt.IsZero() {
+		return componentStatus{Status: statusOK, Detail: "no update since startup"}
+	}
+
+	if lastWriteErr != nil {
+		detail := fmt.Sprintf("last update failed (%d in a row): %v", consecutiveWriteFailures, lastWriteErr)
+		if !lastWriteOKAt.IsZero() {
+			detail += fmt.Sprintf(", last successful update %s ago", time.Since(lastWriteOKAt).Round(time.Second))
+		}
+		return componentStatus{Status: statusDegraded, Detail: detail}
+	}
+
+	return componentStatus{Status: statusOK, Detail: fmt.Sprintf("last successful update %s ago", time.Since(lastWriteOKAt).Round(time.Second))}
+}
+
+func policyCacheStatus() componentStatus {
+	if policyCacheTTL == 0 {
+		return componentStatus{Status: statusOK, Detail: "disabled"}
+	}
+
+	return componentStatus{Status: statusOK, Detail: fmt.Sprintf("ttl %s", policyCacheTTL)}
+}
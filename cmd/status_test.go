@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestStatusOfStoredPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		stored string
+		want   string
+	}{
+		{name: "valid", stored: `{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`, want: statusOK},
+		{name: "unknown field", stored: `{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1,"Future":true}`, want: statusOK},
+		{name: "out of range", stored: `{"UnprocessableFileTypeAction":9,"GlasswallBlockedFilesAction":1}`, want: statusDegraded},
+		{name: "missing field", stored: `{"UnprocessableFileTypeAction":1}`, want: statusDegraded},
+		{name: "malformed", stored: `{"UnprocessableFileTypeAction":`, want: statusDegraded},
+	}
+
+	for _, mode := range []string{unknownFieldsReject, unknownFieldsIgnore} {
+		useUnknownFields(t, mode)
+		for _, tt := range tests {
+			t.Run(mode+"/"+tt.name, func(t *testing.T) {
+				useFakeClient(t, policyConfigMap(tt.stored))
+				before := validationFailureTotal()
+
+				reachable, stored := apiServerStatus(context.Background())
+				if reachable.Status != statusOK || stored.Status != tt.want {
+					t.Errorf("status = %s, %+v, want %s, %s", reachable.Status, stored, statusOK, tt.want)
+				}
+
+				// polling the status of a bad policy is not a validation failure of a request
+				if validationFailureTotal() != before {
+					t.Error("status check counted a validation failure")
+				}
+			})
+		}
+	}
+}
+
+// validationFailureTotal sums gw_ncfspolicyupdate_validation_failure_total over its labels.
+func validationFailureTotal() float64 {
+	var total float64
+	for _, field := range []string{"UnprocessableFileTypeAction", "GlasswallBlockedFilesAction", "other"} {
+		for _, reason := range []string{reasonMissing, reasonOutOfRange, reasonWrongType, reasonConflict} {
+			total += testutil.ToFloat64(svcMetrics.validationFailures.WithLabelValues(field, reason))
+		}
+	}
+
+	return total
+}
+
+func TestWriteFailureMetrics(t *testing.T) {
+	client := useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`))
+
+	lastWriteMu.Lock()
+	previousFailures, previousFailAt := consecutiveWriteFailures, lastWriteFailAt
+	consecutiveWriteFailures, lastWriteFailAt = 0, time.Now().Add(-time.Hour)
+	lastWriteMu.Unlock()
+	t.Cleanup(func() {
+		lastWriteMu.Lock()
+		consecutiveWriteFailures, lastWriteFailAt = previousFailures, previousFailAt
+		lastWriteMu.Unlock()
+	})
+
+	// the API server refuses every write until failing is cleared; forbidden is not
+	// retried, so each request is one failure
+	failing := true
+	for _, verb := range []string{"update", "patch"} {
+		client.PrependReactor(verb, "configmaps", func(k8stesting.Action) (bool, runtime.Object, error) {
+			if !failing {
+				return false, nil, nil
+			}
+			return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "configmaps"}, configmapName, fmt.Errorf("denied"))
+		})
+	}
+
+	handler := newTestHandler()
+	for i := 1; i <= 2; i++ {
+		w := putPolicy(handler, fmt.Sprintf(`{"UnprocessableFileTypeAction":%d,"GlasswallBlockedFilesAction":1}`, i+1))
+		if w.Code < http.StatusBadRequest {
+			t.Fatalf("PUT with a failing API server = %d, want an error", w.Code)
+		}
+
+		if failures := testutil.ToFloat64(svcMetrics.consecutiveWriteFailures); failures != float64(i) {
+			t.Errorf("consecutive write failures after %d failures = %v", i, failures)
+		}
+		if since := testutil.ToFloat64(svcMetrics.secondsSinceWriteFailure); since >= 60 {
+			t.Errorf("seconds since the last write failure = %v, want it reset by the failure", since)
+		}
+	}
+
+	failing = false
+	if w := putPolicy(handler, `{"UnprocessableFileTypeAction":4,"GlasswallBlockedFilesAction":1}`); w.Code != http.StatusOK {
+		t.Fatalf("PUT = %d %s, want %d", w.Code, w.Body, http.StatusOK)
+	}
+	if failures := testutil.ToFloat64(svcMetrics.consecutiveWriteFailures); failures != 0 {
+		t.Errorf("consecutive write failures after a success = %v, want 0", failures)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	policy "github.com/filetrust/policy-update-service/pkg"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+var (
+	targetLabelSelector = os.Getenv("TARGET_LABEL_SELECTOR")
+	clusterWideUpdates  = os.Getenv("CLUSTER_WIDE_UPDATES")
+)
+
+type targetResult struct {
+	Namespace     string `json:"namespace"`
+	ConfigMapName string `json:"configMapName"`
+	Outcome       string `json:"outcome,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+func setupTargets() error {
+	if targetLabelSelector == "" {
+		return nil
+	}
+
+	if clusterWideUpdates != "true" {
+		return errors.New("TARGET_LABEL_SELECTOR requires CLUSTER_WIDE_UPDATES=true")
+	}
+
+	if _, err := labels.Parse(targetLabelSelector); err != nil {
+		return fmt.Errorf("TARGET_LABEL_SELECTOR is not a valid label selector: %v", err)
+	}
+
+	log.Printf("Policy updates will be applied to all config maps matching %q", targetLabelSelector)
+	return nil
+}
+
+// storePolicyBySelector applies the policy to every config map matching the target label
+// selector and reports the outcome per config map. It returns whether any config map
+// changed.
+func storePolicyBySelector(w http.ResponseWriter, r *http.Request, args policy.PolicyArgs, reason string) bool {
+	args.LabelSelector = targetLabelSelector
+
+	results, err := args.UpdatePolicies(r.Context())
+	storedPolicyCache.invalidate()
+	if err != nil {
+		recordWrite(err)
+		loggerFromContext(r.Context()).Printf("Unable to list config maps: %v", err)
+		writeConfigMapError(w, err, "Something went wrong when listing the config maps.")
+		return false
+	}
+
+	if len(results) == 0 {
+		writeError(w, http.StatusNotFound, codeNotFound, "No config maps match the target label selector.")
+		return false
+	}
+
+	changed := false
+	var succeeded, failed int
+	targets := make([]targetResult, 0, len(results))
+	for _, result := range results {
+		target := targetResult{
+			Namespace:     result.Namespace,
+			ConfigMapName: result.ConfigMapName,
+		}
+
+		if result.Err != nil {
+			loggerFromContext(r.Context()).Printf("Unable to update policy in %s/%s: %v", result.Namespace, result.ConfigMapName, result.Err)
+			target.Error = result.Err.Error()
+			failed++
+		} else {
+			target.Outcome = result.Outcome.String()
+			changed = changed || result.Outcome != policy.Unchanged
+			succeeded++
+		}
+
+		targets = append(targets, target)
+	}
+
+	loggerFromContext(r.Context()).Printf("Policy updated in %d of %d config maps matching %q by %s", succeeded, len(results), targetLabelSelector, withReason(requestActor(r), reason))
+
+	if failed > 0 {
+		recordWrite(fmt.Errorf("%d of %d config maps failed to update", failed, len(results)))
+	} else {
+		recordWrite(nil)
+	}
+
+	status := http.StatusOK
+	switch {
+	case succeeded == 0:
+		status = http.StatusInternalServerError
+	case failed > 0:
+		status = http.StatusMultiStatus
+	}
+
+	writeData(w, status, targets, map[string]interface{}{
+		"succeeded": succeeded,
+		"failed":    failed,
+	})
+
+	return changed
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/golang/gddo/httputil/header"
+	"github.com/gorilla/mux"
+)
+
+var policyTemplatesFile = os.Getenv("POLICY_TEMPLATES_FILE")
+
+// templatePlaceholder matches a JSON string that is exactly "${name}". The whole
+// string, quotes included, is replaced by the JSON value of the variable, so a
+// placeholder can stand for a number.
+var templatePlaceholder = regexp.MustCompile(`"\$\{([A-Za-z_][A-Za-z0-9_]*)\}"`)
+
+// policyTemplate is a policy document with placeholders, and the variables they name.
+type policyTemplate struct {
+	document  string
+	variables []string
+}
+
+var policyTemplates = map[string]policyTemplate{}
+
+// setupPolicyTemplates loads the named templates from POLICY_TEMPLATES_FILE, a JSON
+// object mapping each template name to a policy document with placeholders.
+func setupPolicyTemplates() error {
+	if policyTemplatesFile == "" {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(policyTemplatesFile)
+	if err != nil {
+		return fmt.Errorf("unable to read POLICY_TEMPLATES_FILE: %v", err)
+	}
+
+	var documents map[string]json.RawMessage
+	err = json.Unmarshal(b, &documents)
+	if err != nil {
+		return fmt.Errorf("POLICY_TEMPLATES_FILE must be a JSON object of templates: %v", err)
+	}
+
+	for name, document := range documents {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(document, &fields); err != nil {
+			return fmt.Errorf("policy template %q must be a JSON object", name)
+		}
+
+		seen := map[string]bool{}
+		var variables []string
+		for _, match := range templatePlaceholder.FindAllStringSubmatch(string(document), -1) {
+			if !seen[match[1]] {
+				seen[match[1]] = true
+				variables = append(variables, match[1])
+			}
+		}
+		sort.Strings(variables)
+
+		policyTemplates[name] = policyTemplate{document: string(document), variables: variables}
+		log.Printf("Loaded policy template %q with variables %v", name, variables)
+	}
+
+	return nil
+}
+
+// render fills in the placeholders of t. Every variable must be supplied, and no others.
+func (t policyTemplate) render(values map[string]json.RawMessage) (string, error) {
+	var missing, unknown []string
+	for _, name := range t.variables {
+		if _, ok := values[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+
+	for name := range values {
+		if !t.uses(name) {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+
+	if len(missing) > 0 {
+		return "", fmt.Errorf("Template is missing variables: %s.", strings.Join(missing, ", "))
+	}
+
+	if len(unknown) > 0 {
+		return "", fmt.Errorf("Template does not use variables: %s.", strings.Join(unknown, ", "))
+	}
+
+	return templatePlaceholder.ReplaceAllStringFunc(t.document, func(placeholder string) string {
+		return string(values[templatePlaceholder.FindStringSubmatch(placeholder)[1]])
+	}), nil
+}
+
+func (t policyTemplate) uses(name string) bool {
+	for _, variable := range t.variables {
+		if variable == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// applyPolicyTemplate renders the named template with the variables in the request
+// body and stores the result like a PUT of it would.
+func applyPolicyTemplate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Methods", "*")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "*")
+	w.Header().Set("Access-Control-Expose-Headers", "*")
+
+	t, ok := policyTemplates[mux.Vars(r)["name"]]
+	if !ok {
+		writeError(w, http.StatusNotFound, codeNotFound, "The policy template does not exist.")
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "" {
+		value, _ := header.ParseValueAndParams(r.Header, "Content-Type")
+		if value != "application/json" {
+			traceValidation(r, "content_type", "rejected", value)
+			msg := "Content-Type header is not application/json"
+			writeError(w, http.StatusUnsupportedMediaType, codeUnsupportedMediaType, msg)
+			return
+		}
+	}
+
+	traceValidation(r, "content_type", "ok", r.Header.Get("Content-Type"))
+	limitRequestBody(w, r)
+
+	dec := json.NewDecoder(r.Body)
+	var values map[string]json.RawMessage
+	err := dec.Decode(&values)
+	if err == nil {
+		if _, err = dec.Token(); err == io.EOF {
+			err = nil
+		} else if err == nil {
+			err = errTrailingData
+		}
+	}
+	if err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	document, err := t.render(values)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, codeValidation, err.Error())
+		return
+	}
+
+	p, err := decodePolicy(strings.NewReader(document))
+	traceDecodedPolicy(r, p, err)
+	if err != nil {
+		writePolicyError(w, r, err)
+		return
+	}
+
+	reason, ok := changeReason(w, r, "")
+	if !ok {
+		return
+	}
+
+	storePolicy(w, r, p, nil, nil, reason)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// usePolicyTemplates loads the templates in document, a POLICY_TEMPLATES_FILE, for the
+// rest of the test.
+func usePolicyTemplates(t *testing.T, document string) {
+	file := filepath.Join(t.TempDir(), "templates.json")
+	if err := os.WriteFile(file, []byte(document), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	previousFile, previous := policyTemplatesFile, policyTemplates
+	policyTemplatesFile, policyTemplates = file, map[string]policyTemplate{}
+	t.Cleanup(func() { policyTemplatesFile, policyTemplates = previousFile, previous })
+
+	if err := setupPolicyTemplates(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func postTemplate(handler http.Handler, name, body string) *httptest.ResponseRecorder {
+	r := asAdmin(httptest.NewRequest("POST", "/api/v1/policy/template/"+name, strings.NewReader(body)))
+	r.Header.Set("Content-Type", "application/json")
+	return serve(handler, r)
+}
+
+const testTemplates = `{"strict": {"UnprocessableFileTypeAction": "${unprocessable}", "GlasswallBlockedFilesAction": "${blocked}"}}`
+
+func TestPolicyTemplateRendered(t *testing.T) {
+	client := useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`))
+	usePolicyTemplates(t, testTemplates)
+
+	w := postTemplate(newTestHandler(), "strict", `{"unprocessable":3,"blocked":4}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	if doc := storedDocument(t, client); doc != `{"UnprocessableFileTypeAction":3,"GlasswallBlockedFilesAction":4}`+"\n" {
+		t.Errorf("stored policy = %s, want the rendered template", doc)
+	}
+}
+
+func TestPolicyTemplateRejected(t *testing.T) {
+	doc := `{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`
+	client := useFakeClient(t, policyConfigMap(doc))
+	usePolicyTemplates(t, testTemplates)
+	handler := newTestHandler()
+
+	tests := []struct {
+		name, template, body string
+		status               int
+		message              string
+	}{
+		{"missing variable", "strict", `{"unprocessable":3}`, http.StatusBadRequest, "Template is missing variables: blocked."},
+		{"missing variables", "strict", `{}`, http.StatusBadRequest, "Template is missing variables: blocked, unprocessable."},
+		{"unknown variable", "strict", `{"unprocessable":3,"blocked":4,"extra":1}`, http.StatusBadRequest, "Template does not use variables: extra."},
+		{"invalid policy", "strict", `{"unprocessable":3,"blocked":9}`, http.StatusBadRequest, "GlasswallBlockedFilesAction must be between 1-4 inclusive."},
+		{"unknown template", "lenient", `{}`, http.StatusNotFound, "The policy template does not exist."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postTemplate(handler, tt.template, tt.body)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+
+			var resp errorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Message != tt.message {
+				t.Errorf("body = %s, want message %q", w.Body, tt.message)
+			}
+			if got := storedDocument(t, client); got != doc {
+				t.Errorf("stored policy = %s, want it unchanged", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// minChangeInterval is the least time between two policy changes, so a flapping client
+// can't make NCFS reload the policy over and over. Zero, the default, disables it.
+var minChangeInterval time.Duration
+
+var changeThrottle struct {
+	mu         sync.Mutex
+	lastChange time.Time
+	// pending is when the write holding the reservation started, or zero if none does.
+	pending time.Time
+}
+
+func setupChangeThrottle() error {
+	var err error
+	minChangeInterval, err = optionalDurationFromEnv("MIN_CHANGE_INTERVAL")
+	return err
+}
+
+// reserveChange returns how long to wait before the policy may change again, or, when
+// it may change now, a release func to call once the write is done, reporting whether
+// it changed the policy. Only one write holds the reservation at a time, so two racing
+// writes can't both change the policy within the interval; the lock itself is only
+// held to check and mark the reservation, never across the write.
+func reserveChange() (time.Duration, func(changed bool)) {
+	if minChangeInterval == 0 {
+		return 0, func(bool) {}
+	}
+
+	changeThrottle.mu.Lock()
+	defer changeThrottle.mu.Unlock()
+
+	now := time.Now()
+	if wait := changeThrottle.lastChange.Add(minChangeInterval).Sub(now); wait > 0 {
+		return wait, nil
+	}
+	if !changeThrottle.pending.IsZero() {
+		// assume the pending write changes the policy; if it doesn't, a retry succeeds
+		// as soon as it is done
+		return max(changeThrottle.pending.Add(minChangeInterval).Sub(now), time.Second), nil
+	}
+
+	changeThrottle.pending = now
+	return 0, func(changed bool) {
+		changeThrottle.mu.Lock()
+		defer changeThrottle.mu.Unlock()
+
+		changeThrottle.pending = time.Time{}
+		if changed {
+			changeThrottle.lastChange = time.Now()
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useChangeThrottle sets MIN_CHANGE_INTERVAL to interval with no change made yet for
+// the rest of the test.
+func useChangeThrottle(t *testing.T, interval time.Duration) {
+	previous := minChangeInterval
+	minChangeInterval = interval
+	changeThrottle.lastChange, changeThrottle.pending = time.Time{}, time.Time{}
+	t.Cleanup(func() {
+		minChangeInterval = previous
+		changeThrottle.lastChange, changeThrottle.pending = time.Time{}, time.Time{}
+	})
+}
+
+func TestReserveChange(t *testing.T) {
+	useChangeThrottle(t, time.Minute)
+
+	wait, release := reserveChange()
+	if wait != 0 {
+		t.Fatalf("first change waits %v", wait)
+	}
+
+	// a racing write is refused while the first holds the reservation
+	if wait, _ := reserveChange(); wait <= 0 {
+		t.Fatal("second reservation granted while the first is pending")
+	}
+
+	// a write that changed nothing doesn't start the interval
+	release(false)
+	wait, release = reserveChange()
+	if wait != 0 {
+		t.Fatalf("change after an unchanged write waits %v", wait)
+	}
+
+	release(true)
+	wait, _ = reserveChange()
+	if wait <= 59*time.Second || wait > time.Minute {
+		t.Errorf("change too soon waits %v, want about a minute", wait)
+	}
+
+	// once the interval has passed the policy may change again
+	changeThrottle.lastChange = time.Now().Add(-time.Minute)
+	if wait, release := reserveChange(); wait != 0 {
+		t.Errorf("change after the interval waits %v", wait)
+	} else {
+		release(true)
+	}
+}
+
+func TestReserveChangeLongPendingWrite(t *testing.T) {
+	useChangeThrottle(t, time.Second)
+	changeThrottle.pending = time.Now().Add(-time.Minute)
+
+	if wait, _ := reserveChange(); wait <= 0 {
+		t.Errorf("reservation granted while a slow write is pending, wait %v", wait)
+	}
+}
+
+func TestUpdatePolicyThrottled(t *testing.T) {
+	useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`))
+	useChangeThrottle(t, time.Minute)
+	handler := newTestHandler()
+
+	put := func(body string) *httptest.ResponseRecorder {
+		r := asAdmin(httptest.NewRequest("PUT", policyPath, strings.NewReader(body)))
+		r.Header.Set("Content-Type", "application/json")
+		return serve(handler, r)
+	}
+
+	if w := put(`{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":1}`); w.Code != http.StatusOK {
+		t.Fatalf("first change status = %d: %s", w.Code, w.Body)
+	}
+
+	w := put(`{"UnprocessableFileTypeAction":3,"GlasswallBlockedFilesAction":1}`)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("change too soon status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if retry, _ := strconv.Atoi(w.Header().Get("Retry-After")); retry < 59 || retry > 60 {
+		t.Errorf("Retry-After = %q, want about 60", w.Header().Get("Retry-After"))
+	}
+
+	changeThrottle.lastChange = time.Now().Add(-time.Minute)
+	if w := put(`{"UnprocessableFileTypeAction":3,"GlasswallBlockedFilesAction":1}`); w.Code != http.StatusOK {
+		t.Errorf("change after the interval status = %d: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+var requestTimeout time.Duration
+
+func setupRequestTimeout() error {
+	var err error
+	requestTimeout, err = durationFromEnv("REQUEST_TIMEOUT", 10*time.Second)
+	return err
+}
+
+// timeoutMiddleware bounds the time a request may spend, including queueing for a
+// concurrency slot and retrying Kubernetes calls, by putting a deadline on its context.
+// Event streams stay open until the client leaves and are not bounded.
+func timeoutMiddleware(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if r.URL.Path == policyEventsPath {
+		next(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	next(w, r.WithContext(ctx))
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestSlowAPIServerTimesOut(t *testing.T) {
+	const timeout = 100 * time.Millisecond
+	client := useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`))
+	useRequestTimeout(t, timeout)
+
+	// an API server slower than the deadline; client-go reports the expired context
+	client.PrependReactor("get", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		time.Sleep(timeout + 50*time.Millisecond)
+		return true, nil, fmt.Errorf("Get %q: %w", action.GetResource().Resource, context.DeadlineExceeded)
+	})
+
+	start := time.Now()
+	w := putPolicy(newTestHandler(), `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":2}`)
+	if w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusGatewayTimeout, w.Body)
+	}
+
+	// the retry backoff is not waited for once the deadline has passed
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("the request took %v, want it to end at the deadline", elapsed)
+	}
+
+	var resp errorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Code != codeTimeout {
+		t.Errorf("body = %s, want code %s", w.Body, codeTimeout)
+	}
+}
+
+func TestRequestDeadline(t *testing.T) {
+	useRequestTimeout(t, time.Minute)
+
+	var deadline time.Time
+	var ok bool
+	timeoutMiddleware(httptest.NewRecorder(), httptest.NewRequest("GET", policyPath, nil), func(w http.ResponseWriter, r *http.Request) {
+		deadline, ok = r.Context().Deadline()
+	})
+	if remaining := time.Until(deadline); !ok || remaining <= 0 || remaining > time.Minute {
+		t.Errorf("deadline in %v, %v, want REQUEST_TIMEOUT", remaining, ok)
+	}
+
+	// event streams are not bounded
+	timeoutMiddleware(httptest.NewRecorder(), httptest.NewRequest("GET", policyEventsPath, nil), func(w http.ResponseWriter, r *http.Request) {
+		_, ok = r.Context().Deadline()
+	})
+	if ok {
+		t.Error("event stream has a deadline")
+	}
+}
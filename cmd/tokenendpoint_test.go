@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// useTokenEndpoint sets TOKEN_ENDPOINT_ENABLED to enabled for the rest of the test.
+func useTokenEndpoint(t *testing.T, enabled bool) {
+	previous := tokenEndpointEnabled
+	tokenEndpointEnabled = enabled
+	t.Cleanup(func() { tokenEndpointEnabled = previous })
+}
+
+func TestTokenEndpointEnabled(t *testing.T) {
+	useTokenEndpoint(t, true)
+
+	w := serve(newTestHandler(), asAdmin(httptest.NewRequest("GET", tokenPath, nil)))
+	if w.Code != http.StatusOK || w.Body.Len() == 0 {
+		t.Errorf("token request = %d %s, want a token", w.Code, w.Body)
+	}
+}
+
+func TestTokenEndpointDisabled(t *testing.T) {
+	token := issueToken(t, "alice")
+	useTokenEndpoint(t, false)
+	handler := newTestHandler()
+
+	if w := serve(handler, asAdmin(httptest.NewRequest("GET", tokenPath, nil))); w.Code != http.StatusNotFound {
+		t.Errorf("token request = %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	// with nothing issuing tokens the bearer strategy is not enabled
+	r := httptest.NewRequest("GET", whoamiPath, nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	if w := serve(handler, r); w.Code != http.StatusUnauthorized {
+		t.Errorf("whoami with a bearer token = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	// basic auth remains
+	if w := serve(handler, asAdmin(httptest.NewRequest("GET", whoamiPath, nil))); w.Code != http.StatusOK {
+		t.Errorf("whoami with basic auth = %d, want %d", w.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/shaj13/go-guardian/auth"
+	"github.com/shaj13/go-guardian/auth/strategies/basic"
+	"github.com/shaj13/go-guardian/store"
+)
+
+const tokenPath = "/api/v1/auth/token"
+
+var (
+	tokenIssuerUsername = os.Getenv("TOKEN_ISSUER_USERNAME")
+	tokenIssuerPassword = os.Getenv("TOKEN_ISSUER_PASSWORD")
+)
+
+func validateTokenIssuer(ctx context.Context, r *http.Request, usr, pass string) (auth.Info, error) {
+	userMatch := subtle.ConstantTimeCompare([]byte(usr), []byte(tokenIssuerUsername))
+	passMatch := subtle.ConstantTimeCompare([]byte(pass), []byte(tokenIssuerPassword))
+
+	if userMatch&passMatch == 1 {
+		// tokens minted by the issuer are for managing the policy, so they carry the
+		// roles of the policy account
+		return auth.NewDefaultUser(usr, "2", ownerRoles(), nil), nil
+	}
+
+	return nil, fmt.Errorf("Invalid credentials")
+}
+
+// setupTokenIssuer separates minting tokens from managing the policy: with
+// TOKEN_ISSUER_USERNAME and TOKEN_ISSUER_PASSWORD set, only they are accepted by the
+// token endpoint, and they are accepted nowhere else.
+func setupTokenIssuer() error {
+	if tokenIssuerUsername == "" && tokenIssuerPassword == "" {
+		return nil
+	}
+
+	if tokenIssuerUsername == "" || tokenIssuerPassword == "" {
+		return errors.New("TOKEN_ISSUER_USERNAME and TOKEN_ISSUER_PASSWORD must be set together")
+	}
+
+	return nil
+}
+
+// newTokenIssuerAuthenticator creates the authenticator gating the token endpoint when
+// separate token issuer credentials are configured, and nil otherwise. It has its own
+// cache so a cached issuer login is never consulted for other routes.
+func newTokenIssuerAuthenticator() auth.Authenticator {
+	if tokenIssuerUsername == "" {
+		return nil
+	}
+
+	authenticator := auth.New()
+	issuerCache := newFlushableCache(store.NewFIFO(context.Background(), time.Minute*10))
+	authCaches = append(authCaches, issuerCache)
+	authenticator.EnableStrategy(basic.StrategyKey, basic.New(validateTokenIssuer, issuerCache))
+
+	return authenticator
+}
+
+// tokenAudience is the aud claim of issued tokens, and the audience a bearer token must
+// carry to be accepted.
+var tokenAudience = "any"
+
+// setupTokenAudience lets each deployment set its own audience with JWT_AUDIENCE, so
+// tokens issued by one deployment are not accepted by another.
+func setupTokenAudience() {
+	if aud := strings.TrimSpace(os.Getenv("JWT_AUDIENCE")); aud != "" {
+		tokenAudience = aud
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// issuedClaims returns the claims of the token createToken issues to r.
+func issuedClaims(t *testing.T, r *http.Request) jwt.MapClaims {
+	w := httptest.NewRecorder()
+	createToken(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(w.Body.String(), claims); err != nil {
+		t.Fatal(err)
+	}
+
+	return claims
+}
+
+func TestCreateTokenClaims(t *testing.T) {
+	previous := tokenAudience
+	tokenAudience = "ncfs-production"
+	t.Cleanup(func() { tokenAudience = previous })
+
+	claims := issuedClaims(t, withIdentity(httptest.NewRequest("GET", tokenPath, nil), "alice", roleReader))
+	if claims["sub"] != "alice" {
+		t.Errorf("sub = %v, want the user that logged in", claims["sub"])
+	}
+	if claims["aud"] != "ncfs-production" {
+		t.Errorf("aud = %v, want JWT_AUDIENCE", claims["aud"])
+	}
+}
+
+func TestCreateTokenForIssuer(t *testing.T) {
+	previous := tokenIssuerUsername
+	tokenIssuerUsername = "token-issuer"
+	t.Cleanup(func() { tokenIssuerUsername = previous })
+
+	claims := issuedClaims(t, withIdentity(httptest.NewRequest("GET", tokenPath, nil), "token-issuer", ownerRoles()...))
+	if claims["sub"] != username {
+		t.Errorf("sub = %v, want the policy account %s", claims["sub"], username)
+	}
+}
+
+// useTokenIssuer sets TOKEN_ISSUER_USERNAME and TOKEN_ISSUER_PASSWORD for the rest of
+// the test.
+func useTokenIssuer(t *testing.T, user, pass string) {
+	previousUser, previousPass := tokenIssuerUsername, tokenIssuerPassword
+	tokenIssuerUsername, tokenIssuerPassword = user, pass
+	t.Cleanup(func() { tokenIssuerUsername, tokenIssuerPassword = previousUser, previousPass })
+}
+
+func TestSeparateTokenIssuerCredentials(t *testing.T) {
+	useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`))
+	useTokenIssuer(t, "token-issuer", "token-issuer-password")
+	if err := setupTokenIssuer(); err != nil {
+		t.Fatal(err)
+	}
+	handler := (&Server{Authenticator: newAuthenticator(), TokenIssuerAuthenticator: newTokenIssuerAuthenticator()}).Handler()
+
+	send := func(path, user, pass string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", path, nil)
+		r.SetBasicAuth(user, pass)
+		return serve(handler, r)
+	}
+
+	token := send(tokenPath, "token-issuer", "token-issuer-password")
+	if token.Code != http.StatusOK {
+		t.Fatalf("token with the issuer credentials = %d, want %d", token.Code, http.StatusOK)
+	}
+	if w := send(tokenPath, username, password); w.Code != http.StatusUnauthorized {
+		t.Errorf("token with the policy credentials = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	if w := send(policyPath, "token-issuer", "token-issuer-password"); w.Code != http.StatusUnauthorized {
+		t.Errorf("policy with the issuer credentials = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w := send(policyPath, username, password); w.Code != http.StatusOK {
+		t.Errorf("policy with the policy credentials = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	// the minted token manages the policy
+	r := httptest.NewRequest("GET", policyPath, nil)
+	r.Header.Set("Authorization", "Bearer "+token.Body.String())
+	if w := serve(handler, r); w.Code != http.StatusOK {
+		t.Errorf("policy with the minted token = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestTokenIssuerCredentialsSetTogether(t *testing.T) {
+	useTokenIssuer(t, "token-issuer", "")
+	if err := setupTokenIssuer(); err == nil {
+		t.Error("TOKEN_ISSUER_USERNAME without TOKEN_ISSUER_PASSWORD accepted")
+	}
+
+	useTokenIssuer(t, "", "token-issuer-password")
+	if err := setupTokenIssuer(); err == nil {
+		t.Error("TOKEN_ISSUER_PASSWORD without TOKEN_ISSUER_USERNAME accepted")
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	policy "github.com/filetrust/policy-update-service/pkg"
+	"github.com/shaj13/go-guardian/auth"
+)
+
+// tokenReviewAuth accepts Kubernetes ServiceAccount tokens as bearer tokens, checked
+// with the TokenReview API, alongside the tokens this service issues.
+var tokenReviewAuth = os.Getenv("K8S_TOKENREVIEW_AUTH") == "true"
+
+var (
+	// tokenReviewAudience is the audience Kubernetes tokens must be issued for, so a
+	// token meant for the API server or another service is not accepted here.
+	tokenReviewAudience = strings.TrimSpace(os.Getenv("K8S_TOKENREVIEW_AUDIENCE"))
+
+	// tokenReviewAllowed lists the users, and groups prefixed with "group:", whose
+	// Kubernetes tokens are accepted. Empty accepts any user, which is only allowed
+	// when writes are authorized with K8S_SAR_AUTHZ.
+	tokenReviewAllowed = map[string]bool{}
+
+	// tokenReviewFailureTTL is how long a rejected token is remembered, so sending it
+	// again is answered without another TokenReview.
+	tokenReviewFailureTTL time.Duration
+)
+
+// reviewer is shared by TokenReview authentication and SubjectAccessReview
+// authorization, and only created when either is enabled.
+var reviewer *policy.Reviewer
+
+func setupReviewer(setting string) error {
+	if reviewer != nil {
+		return nil
+	}
+
+	var err error
+	reviewer, err = policy.NewReviewer()
+	if err != nil {
+		return fmt.Errorf("%s needs a Kubernetes client: %v", setting, err)
+	}
+
+	return nil
+}
+
+func setupTokenReview() error {
+	if !tokenReviewAuth {
+		return nil
+	}
+
+	if tokenReviewAudience == "" {
+		return errors.New("K8S_TOKENREVIEW_AUTH requires K8S_TOKENREVIEW_AUDIENCE")
+	}
+
+	for _, entry := range strings.Split(os.Getenv("K8S_TOKENREVIEW_ALLOWED"), ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			tokenReviewAllowed[entry] = true
+		}
+	}
+
+	if len(tokenReviewAllowed) == 0 && !sarAuthz {
+		return errors.New("K8S_TOKENREVIEW_AUTH requires K8S_TOKENREVIEW_ALLOWED, or K8S_SAR_AUTHZ=true to accept any ServiceAccount")
+	}
+
+	var err error
+	tokenReviewFailureTTL, err = durationFromEnv("K8S_TOKENREVIEW_FAILURE_TTL", time.Minute)
+	if err != nil {
+		return err
+	}
+
+	if err := setupReviewer("K8S_TOKENREVIEW_AUTH"); err != nil {
+		return err
+	}
+
+	log.Printf("Accepting Kubernetes ServiceAccount tokens for audience %q verified with TokenReview", tokenReviewAudience)
+	return nil
+}
+
+// verifyBearer checks a bearer token: a service token by its prefix, otherwise one
+// issued by this service first, then, with K8S_TOKENREVIEW_AUTH, a Kubernetes token.
+func verifyBearer(ctx context.Context, r *http.Request, tokenString string) (auth.Info, error) {
+	if serviceTokenStore != nil && strings.HasPrefix(tokenString, serviceTokenPrefix) {
+		return verifyServiceToken(ctx, tokenString)
+	}
+
+	if tokenEndpointEnabled {
+		info, err := verifyToken(ctx, r, tokenString)
+		if err == nil || !tokenReviewAuth {
+			return info, err
+		}
+	}
+
+	if tokenReviewAuth {
+		return reviewToken(ctx, tokenString)
+	}
+
+	return nil, fmt.Errorf("Invalid token")
+}
+
+// reviewToken authenticates a Kubernetes token with the TokenReview API and takes the
+// user, groups and extra fields from the review. Tokens the review rejects, or whose
+// user is not allowed, are remembered for K8S_TOKENREVIEW_FAILURE_TTL.
+func reviewToken(ctx context.Context, tokenString string) (auth.Info, error) {
+	sum := sha256.Sum256([]byte(tokenString))
+	key := hex.EncodeToString(sum[:])
+	if rejectedTokens.contains(key) {
+		return nil, fmt.Errorf("Invalid token")
+	}
+
+	user, err := reviewer.ReviewToken(ctx, tokenString, []string{tokenReviewAudience})
+	if err != nil {
+		// only the API server's verdict is remembered, not a failure to reach it
+		if errors.Is(err, policy.ErrTokenRejected) {
+			rejectedTokens.add(key, tokenReviewFailureTTL)
+		}
+		loggerFromContext(ctx).Printf("TokenReview did not authenticate the token: %v", err)
+		return nil, fmt.Errorf("Invalid token")
+	}
+
+	if !tokenReviewUserAllowed(user.Username, user.Groups) {
+		rejectedTokens.add(key, tokenReviewFailureTTL)
+		loggerFromContext(ctx).Printf("Kubernetes user %s is not in K8S_TOKENREVIEW_ALLOWED", user.Username)
+		return nil, fmt.Errorf("Invalid token")
+	}
+
+	extensions := map[string][]string{}
+	for key, values := range user.Extra {
+		extensions[key] = values
+	}
+
+	return auth.NewDefaultUser(user.Username, user.UID, user.Groups, extensions), nil
+}
+
+// tokenReviewUserAllowed reports whether the Kubernetes user, or one of its groups, is
+// in K8S_TOKENREVIEW_ALLOWED, or that list is empty.
+func tokenReviewUserAllowed(user string, groups []string) bool {
+	if len(tokenReviewAllowed) == 0 || tokenReviewAllowed[user] {
+		return true
+	}
+
+	for _, group := range groups {
+		if tokenReviewAllowed["group:"+group] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// maxRejectedTokens bounds the memory a stream of bad tokens can take up.
+const maxRejectedTokens = 4096
+
+// rejectedTokens remembers the hashes of rejected Kubernetes tokens until they expire.
+var rejectedTokens = &tokenRejections{until: map[string]time.Time{}}
+
+type tokenRejections struct {
+	mu    sync.Mutex
+	until map[string]time.Time
+}
+
+func (c *tokenRejections) contains(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	until, ok := c.until[key]
+	return ok && time.Now().Before(until)
+}
+
+// add remembers key for ttl. When full, expired entries are dropped first, then the
+// entry closest to expiry.
+func (c *tokenRejections) add(key string, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if len(c.until) >= maxRejectedTokens {
+		oldest, oldestUntil := "", time.Time{}
+		for k, until := range c.until {
+			if now.After(until) {
+				delete(c.until, k)
+			} else if oldest == "" || until.Before(oldestUntil) {
+				oldest, oldestUntil = k, until
+			}
+		}
+		if len(c.until) >= maxRejectedTokens {
+			delete(c.until, oldest)
+		}
+	}
+
+	c.until[key] = now.Add(ttl)
+}
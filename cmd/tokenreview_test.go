@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	policy "github.com/filetrust/policy-update-service/pkg"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// useTokenReview makes reviewToken check tokens against a fake TokenReview API, which
+// authenticates "good-token" for the configured audience as a ServiceAccount, and
+// returns the number of reviews made so far.
+func useTokenReview(t *testing.T, allowed ...string) *int {
+	client := useFakeClient(t)
+
+	reviews := 0
+	client.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		reviews++
+		review := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		if review.Spec.Token != "good-token" {
+			review.Status = authenticationv1.TokenReviewStatus{Error: "invalid bearer token"}
+			return true, review, nil
+		}
+
+		// like the API server, report the requested audiences the token is valid for
+		var audiences []string
+		for _, audience := range review.Spec.Audiences {
+			if audience == "policy-update-service" {
+				audiences = append(audiences, audience)
+			}
+		}
+		review.Status = authenticationv1.TokenReviewStatus{
+			Authenticated: len(audiences) > 0,
+			Audiences:     audiences,
+			User: authenticationv1.UserInfo{
+				Username: "system:serviceaccount:ncfs:deployer",
+				UID:      "uid",
+				Groups:   []string{"system:serviceaccounts", "system:serviceaccounts:ncfs"},
+			},
+		}
+		return true, review, nil
+	})
+
+	previousReviewer, previousAudience, previousAllowed := reviewer, tokenReviewAudience, tokenReviewAllowed
+	reviewer = &policy.Reviewer{Client: client}
+	tokenReviewAudience = "policy-update-service"
+	tokenReviewFailureTTL = time.Minute
+	tokenReviewAllowed = map[string]bool{}
+	for _, entry := range allowed {
+		tokenReviewAllowed[entry] = true
+	}
+	rejectedTokens = &tokenRejections{until: map[string]time.Time{}}
+	t.Cleanup(func() {
+		reviewer, tokenReviewAudience, tokenReviewAllowed = previousReviewer, previousAudience, previousAllowed
+	})
+
+	return &reviews
+}
+
+func TestReviewTokenAccepted(t *testing.T) {
+	useTokenReview(t, "group:system:serviceaccounts:ncfs")
+
+	info, err := reviewToken(context.Background(), "good-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.UserName() != "system:serviceaccount:ncfs:deployer" {
+		t.Errorf("user = %q, want system:serviceaccount:ncfs:deployer", info.UserName())
+	}
+	if groups := info.Groups(); len(groups) != 2 || groups[1] != "system:serviceaccounts:ncfs" {
+		t.Errorf("groups = %v, want the reviewed groups", groups)
+	}
+}
+
+func TestReviewTokenRejected(t *testing.T) {
+	tests := []struct {
+		name     string
+		token    string
+		audience string
+		allowed  []string
+	}{
+		{name: "invalid token", token: "bad-token", audience: "policy-update-service", allowed: []string{"system:serviceaccount:ncfs:deployer"}},
+		{name: "other audience", token: "good-token", audience: "other-service", allowed: []string{"system:serviceaccount:ncfs:deployer"}},
+		{name: "user not allowed", token: "good-token", audience: "policy-update-service", allowed: []string{"system:serviceaccount:ncfs:other", "group:system:serviceaccounts:other"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTokenReview(t, tt.allowed...)
+			tokenReviewAudience = tt.audience
+
+			if _, err := reviewToken(context.Background(), tt.token); err == nil {
+				t.Error("token accepted")
+			}
+		})
+	}
+}
+
+func TestReviewTokenRemembersRejections(t *testing.T) {
+	reviews := useTokenReview(t, "system:serviceaccount:ncfs:deployer")
+
+	for i := 0; i < 3; i++ {
+		if _, err := reviewToken(context.Background(), "bad-token"); err == nil {
+			t.Fatal("bad token accepted")
+		}
+	}
+	if *reviews != 1 {
+		t.Errorf("a rejected token was reviewed %d times, want 1", *reviews)
+	}
+
+	// accepted tokens are cached by the bearer strategy instead
+	for i := 0; i < 2; i++ {
+		if _, err := reviewToken(context.Background(), "good-token"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if *reviews != 3 {
+		t.Errorf("reviews = %d, want 3", *reviews)
+	}
+}
+
+func TestTokenRejectionsBounded(t *testing.T) {
+	c := &tokenRejections{until: map[string]time.Time{}}
+	c.add("expired", -time.Second)
+	for i := 0; i < maxRejectedTokens+10; i++ {
+		c.add(strconv.Itoa(i), time.Minute)
+	}
+
+	if len(c.until) > maxRejectedTokens {
+		t.Errorf("holds %d rejections, want at most %d", len(c.until), maxRejectedTokens)
+	}
+	if c.contains("expired") {
+		t.Error("an expired rejection is still remembered")
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// putPolicyWithToken sends body as a PUT of the policy authenticated with token.
+func putPolicyWithToken(token, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("PUT", policyPath, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Authorization", "Bearer "+token)
+	return serve(newTestHandler(), r)
+}
+
+// withoutRolesClaim returns token signed again without its roles claim, as issued
+// before tokens carried roles.
+func withoutRolesClaim(t *testing.T, token string) string {
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err != nil {
+		t.Fatal(err)
+	}
+	delete(claims, "roles")
+
+	signed, err := jwt.NewWithClaims(tokenSigningMethod, claims).SignedString(tokenSigningKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed
+}
+
+func TestTokenCarriesRoles(t *testing.T) {
+	token := issueTokenWithRoles(t, "alice", roleReader, roleWriter)
+
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err != nil {
+		t.Fatal(err)
+	}
+	if roles, _ := claims["roles"].([]interface{}); len(roles) != 2 || roles[0] != roleReader || roles[1] != roleWriter {
+		t.Errorf("roles claim = %v, want [%s %s]", claims["roles"], roleReader, roleWriter)
+	}
+}
+
+func TestTokenWithWriterRoleCanPut(t *testing.T) {
+	client := useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`))
+
+	w := putPolicyWithToken(issueTokenWithRoles(t, "alice", roleWriter), `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":1}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	if doc := storedDocument(t, client); !strings.Contains(doc, `"UnprocessableFileTypeAction":2`) {
+		t.Errorf("stored policy = %s, want the update applied", doc)
+	}
+}
+
+func TestTokenWithoutWriterRoleCannotPut(t *testing.T) {
+	stored := `{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`
+	client := useFakeClient(t, policyConfigMap(stored))
+
+	for name, token := range map[string]string{
+		"reader":   issueTokenWithRoles(t, "alice", roleReader),
+		"no roles": issueTokenWithRoles(t, "alice"),
+		// a token from before roles were carried has no roles claim at all
+		"no claim": withoutRolesClaim(t, issueTokenWithRoles(t, "alice", roleWriter)),
+	} {
+		if w := putPolicyWithToken(token, `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":1}`); w.Code != http.StatusForbidden {
+			t.Errorf("PUT with a %s token = %d, want %d: %s", name, w.Code, http.StatusForbidden, w.Body)
+		}
+	}
+	if doc := storedDocument(t, client); doc != stored {
+		t.Errorf("stored policy changed to %s", doc)
+	}
+}
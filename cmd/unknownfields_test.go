@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// useUnknownFields sets UNKNOWN_FIELDS to mode for the rest of the test.
+func useUnknownFields(t *testing.T, mode string) {
+	previous := unknownFields
+	unknownFields = mode
+	t.Cleanup(func() { unknownFields = previous })
+
+	if err := setupUnknownFields(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnknownFields(t *testing.T) {
+	const stored = `{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`
+	const body = `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":2,"Future":true}`
+
+	tests := []struct {
+		mode   string
+		status int
+		stored string
+		logged bool
+	}{
+		{mode: unknownFieldsReject, status: http.StatusBadRequest, stored: stored},
+		{mode: unknownFieldsIgnore, status: http.StatusOK, stored: `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":2}` + "\n"},
+		{mode: unknownFieldsWarn, status: http.StatusOK, stored: `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":2}` + "\n", logged: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			client := useFakeClient(t, policyConfigMap(stored))
+			useUnknownFields(t, tt.mode)
+			logs := captureLogs(t)
+
+			w := putPolicy(newTestHandler(), body)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if got := storedDocument(t, client); got != tt.stored {
+				t.Errorf("stored policy = %s, want %s", got, tt.stored)
+			}
+
+			logged := false
+			for _, record := range logs() {
+				logged = logged || record["msg"] == `Ignoring unknown policy field "Future"`
+			}
+			if logged != tt.logged {
+				t.Errorf("unknown field logged = %v, want %v", logged, tt.logged)
+			}
+		})
+	}
+}
+
+func TestUnknownFieldRejected(t *testing.T) {
+	useFakeClient(t, policyConfigMap(`{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":1}`))
+	useUnknownFields(t, unknownFieldsReject)
+
+	w := putPolicy(newTestHandler(), `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":2,"Future":true}`)
+
+	var resp errorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Code != codeJSONError || !strings.Contains(resp.Message, `"Future"`) {
+		t.Errorf("body = %s, want a json_error naming the field", w.Body)
+	}
+}
+
+func TestUnknownFieldsSetting(t *testing.T) {
+	previous := unknownFields
+	unknownFields = "drop"
+	t.Cleanup(func() { unknownFields = previous })
+
+	if err := setupUnknownFields(); err == nil {
+		t.Error("UNKNOWN_FIELDS=drop was accepted")
+	}
+}
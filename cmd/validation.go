@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Reasons a policy field fails validation, used as the reason label of
+// gw_ncfspolicyupdate_validation_failure_total.
+const (
+	reasonMissing    = "missing"
+	reasonOutOfRange = "out_of_range"
+	reasonWrongType  = "wrong_type"
+	reasonConflict   = "conflict"
+)
+
+// policyFields bounds the field label of the validation failure metric; anything
+// else is counted as other.
+var policyFields = map[string]bool{
+	"UnprocessableFileTypeAction": true,
+	"GlasswallBlockedFilesAction": true,
+}
+
+func recordValidationFailure(field, reason string) {
+	if !policyFields[field] {
+		field = "other"
+	}
+
+	svcMetrics.validationFailures.WithLabelValues(field, reason).Inc()
+}
+
+// Bounds of every policy action value.
+const (
+	minPolicyAction = 1
+	maxPolicyAction = 4
+)
+
+// validatePolicy checks that every policy field is present and within range, then that
+// the fields are consistent with each other. Each failure is counted in
+// gw_ncfspolicyupdate_validation_failure_total.
+func validatePolicy(p Policy) error {
+	failures, err := policyFailures(p)
+	for _, failure := range failures {
+		recordValidationFailure(failure.field, failure.reason)
+	}
+
+	return err
+}
+
+// validationFailure is a field that failed validation and the reason it is counted under.
+type validationFailure struct {
+	field  string
+	reason string
+}
+
+// policyFailures is validatePolicy without counting the failures, for checks of the
+// stored policy that run on every poll.
+func policyFailures(p Policy) ([]validationFailure, error) {
+	fields := actionFields(p)
+
+	var missing []string
+	var failures []validationFailure
+	for _, field := range fields {
+		if field.value == nil {
+			failures = append(failures, validationFailure{field.name, reasonMissing})
+			missing = append(missing, field.name)
+		}
+	}
+	if len(missing) > 0 {
+		return failures, &missingFieldsError{fields: missing}
+	}
+
+	for _, field := range fields {
+		if err := validateAction(field.name, field.value); err != nil {
+			return []validationFailure{{field.name, reasonOutOfRange}}, err
+		}
+	}
+
+	for _, rule := range policyRules {
+		if err := rule(p); err != nil {
+			// every rule forbids a combination of the two fields
+			return []validationFailure{
+				{"UnprocessableFileTypeAction", reasonConflict},
+				{"GlasswallBlockedFilesAction", reasonConflict},
+			}, err
+		}
+	}
+
+	return nil, nil
+}
+
+type actionField struct {
+	name  string
+	value *ActionValue
+}
+
+// actionFields lists the action fields of p in the order they are validated.
+func actionFields(p Policy) []actionField {
+	return []actionField{
+		{"UnprocessableFileTypeAction", p.UnprocessableFileTypeAction},
+		{"GlasswallBlockedFilesAction", p.GlasswallBlockedFilesAction},
+	}
+}
+
+// missingFieldsError names every required field absent from a policy, so an empty body,
+// an empty object and a partial one are all answered the same way.
+type missingFieldsError struct {
+	fields []string
+}
+
+func (e *missingFieldsError) Error() string {
+	return e.localized().Error()
+}
+
+func (e *missingFieldsError) localized() localizedError {
+	if len(e.fields) == 1 {
+		return localizedError{key: msgFieldRequired, args: []interface{}{e.fields[0]}}
+	}
+
+	return localizedError{key: msgFieldsRequired, args: []interface{}{strings.Join(e.fields, ", ")}}
+}
+
+// policyRules are the cross-field checks run on a policy whose fields are each valid.
+// None are configured by default.
+var policyRules []func(Policy) error
+
+// setupPolicyRules adds a rule for each FORBIDDEN_ACTION_COMBINATIONS entry, a
+// comma-separated list of UnprocessableFileTypeAction:GlasswallBlockedFilesAction pairs
+// that may not be stored together, e.g. "1:4,3:3".
+func setupPolicyRules() error {
+	value := os.Getenv("FORBIDDEN_ACTION_COMBINATIONS")
+	if value == "" {
+		return nil
+	}
+
+	for _, pair := range strings.Split(value, ",") {
+		unprocessable, blocked, ok := parseActionPair(strings.TrimSpace(pair))
+		if !ok {
+			return fmt.Errorf("FORBIDDEN_ACTION_COMBINATIONS entry %q must be two actions between %d-%d inclusive, as <unprocessable>:<blocked>", pair, minPolicyAction, maxPolicyAction)
+		}
+
+		policyRules = append(policyRules, forbidCombination(unprocessable, blocked))
+	}
+
+	return nil
+}
+
+// parseActionPair parses two valid action values separated by a colon.
+func parseActionPair(pair string) (ActionValue, ActionValue, bool) {
+	parts := strings.Split(pair, ":")
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+
+	first, ok := parseActionValue(parts[0])
+	if !ok {
+		return 0, 0, false
+	}
+
+	second, ok := parseActionValue(parts[1])
+	if !ok {
+		return 0, 0, false
+	}
+
+	return first, second, true
+}
+
+// forbidCombination rejects a policy with exactly these two action values. The error
+// names both fields and values.
+func forbidCombination(unprocessable, blocked ActionValue) func(Policy) error {
+	return func(p Policy) error {
+		if *p.UnprocessableFileTypeAction != unprocessable || *p.GlasswallBlockedFilesAction != blocked {
+			return nil
+		}
+
+		return localizedError{key: msgFieldsConflict, args: []interface{}{
+			"UnprocessableFileTypeAction", unprocessable, "GlasswallBlockedFilesAction", blocked,
+		}}
+	}
+}
+
+// validateAction checks the range of a present action field, reporting failures with
+// the message shared by all fields.
+func validateAction(field string, value *ActionValue) error {
+	if actionProblem(value) == reasonOutOfRange {
+		return localizedError{key: msgFieldOutOfRange, args: []interface{}{field, minPolicyAction, maxPolicyAction}}
+	}
+
+	return nil
+}
+
+// actionProblem returns the reason an action value fails validation, or "" if it passes.
+func actionProblem(value *ActionValue) string {
+	switch {
+	case value == nil:
+		return reasonMissing
+	case *value < minPolicyAction || *value > maxPolicyAction:
+		return reasonOutOfRange
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// useForbiddenCombinations sets FORBIDDEN_ACTION_COMBINATIONS to value for the rest of
+// the test and returns the error setting up the rules.
+func useForbiddenCombinations(t *testing.T, value string) error {
+	t.Setenv("FORBIDDEN_ACTION_COMBINATIONS", value)
+	previous := policyRules
+	policyRules = nil
+	t.Cleanup(func() { policyRules = previous })
+
+	return setupPolicyRules()
+}
+
+func TestForbiddenCombination(t *testing.T) {
+	if err := useForbiddenCombinations(t, "1:4, 3:3"); err != nil {
+		t.Fatal(err)
+	}
+	conflicts := svcMetrics.validationFailures.WithLabelValues("GlasswallBlockedFilesAction", reasonConflict)
+
+	tests := []struct {
+		pair    string
+		body    string
+		status  int
+		message string
+	}{
+		{"1:4", `{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":4}`, http.StatusBadRequest, "UnprocessableFileTypeAction 1 cannot be combined with GlasswallBlockedFilesAction 4."},
+		{"3:3", `{"UnprocessableFileTypeAction":3,"GlasswallBlockedFilesAction":3}`, http.StatusBadRequest, "UnprocessableFileTypeAction 3 cannot be combined with GlasswallBlockedFilesAction 3."},
+		{"4:1", `{"UnprocessableFileTypeAction":4,"GlasswallBlockedFilesAction":1}`, http.StatusOK, ""},
+		{"1:3", `{"UnprocessableFileTypeAction":1,"GlasswallBlockedFilesAction":3}`, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pair, func(t *testing.T) {
+			doc := `{"UnprocessableFileTypeAction":2,"GlasswallBlockedFilesAction":2}`
+			client := useFakeClient(t, policyConfigMap(doc))
+			before := testutil.ToFloat64(conflicts)
+
+			w := putPolicy(newTestHandler(), tt.body)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.status == http.StatusOK {
+				return
+			}
+
+			var resp errorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Code != codeValidation || resp.Message != tt.message {
+				t.Errorf("body = %s, want %s %q", w.Body, codeValidation, tt.message)
+			}
+			if got := storedDocument(t, client); got != doc {
+				t.Errorf("stored policy = %s, want it unchanged", got)
+			}
+			if counted := testutil.ToFloat64(conflicts) - before; counted != 1 {
+				t.Errorf("conflict counted %v times, want 1", counted)
+			}
+		})
+	}
+}
+
+func TestForbiddenCombinationsSetting(t *testing.T) {
+	for _, value := range []string{"1", "1:5", "0:1", "a:b", "1:2:3", "1:2,"} {
+		if err := useForbiddenCombinations(t, value); err == nil {
+			t.Errorf("FORBIDDEN_ACTION_COMBINATIONS=%q was accepted", value)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// webUIEnabled serves a small policy management page at /. The page itself holds
+// nothing sensitive and is served without authentication; every API call it makes
+// authenticates like any other client.
+var webUIEnabled = os.Getenv("WEB_UI_ENABLED") == "true"
+
+// webUIFiles holds the page, served at /, and the stylesheet and script it loads from
+// webUIAssetsPath.
+//
+//go:embed webui
+var webUIFiles embed.FS
+
+const webUIAssetsPath = "/ui/"
+
+func setupWebUI() {
+	if !webUIEnabled {
+		return
+	}
+
+	authExemptPaths["/"] = true
+	fs.WalkDir(webUIFiles, "webui", func(name string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && name != "webui/index.html" {
+			authExemptPaths[webUIAssetsPath+strings.TrimPrefix(name, "webui/")] = true
+		}
+		return err
+	})
+	log.Printf("Web UI enabled at /")
+}
+
+// webUIContentSecurityPolicy allows exactly the stylesheet and script of the page, so
+// the page works under any CONTENT_SECURITY_POLICY set for the API.
+var webUIContentSecurityPolicy = strings.Join([]string{
+	"default-src 'none'",
+	"style-src 'self'",
+	"script-src 'self'",
+	"connect-src 'self'",
+	"form-action 'none'",
+	"frame-ancestors 'none'",
+}, "; ")
+
+func serveWebUI(w http.ResponseWriter, r *http.Request) {
+	page, err := webUIFiles.ReadFile("webui/index.html")
+	if err != nil {
+		notFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", webUIContentSecurityPolicy)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(page)
+}
+
+// webUIAssets serves the files the page loads under webUIAssetsPath.
+func webUIAssets() http.Handler {
+	assets, _ := fs.Sub(webUIFiles, "webui")
+	files := http.StripPrefix(webUIAssetsPath, http.FileServer(http.FS(assets)))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !authExemptPaths[r.URL.Path] {
+			notFound(w, r)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-cache")
+		files.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,72 @@
+// Logs in with basic auth to get a bearer token from the token endpoint, falling back
+// to basic auth for every call when the endpoint is disabled. Policies are read and
+// written in either field case, following JSON_FIELD_CASE.
+(function () {
+  var fields = ["UnprocessableFileTypeAction", "GlasswallBlockedFilesAction"];
+  var authorization = null;
+
+  function status(message, error) {
+    var el = document.getElementById("status");
+    el.textContent = message;
+    el.className = error ? "error" : "";
+  }
+
+  function failure(res) {
+    return res.json().then(function (body) {
+      throw new Error(body.message || body.detail || res.statusText);
+    }, function () {
+      throw new Error(res.status + " " + res.statusText);
+    });
+  }
+
+  function call(method, path, body) {
+    var headers = { "Accept": "application/json", "Authorization": authorization, "X-Nonce": String(Date.now()) + Math.random() };
+    if (body) {
+      headers["Content-Type"] = "application/json";
+    }
+    return fetch(path, { method: method, headers: headers, body: body ? JSON.stringify(body) : undefined })
+      .then(function (res) { return res.ok ? res.json() : failure(res); });
+  }
+
+  function field(data, name) {
+    var camel = name.charAt(0).toLowerCase() + name.slice(1);
+    return data[name] !== undefined ? data[name] : data[camel];
+  }
+
+  function load() {
+    return call("GET", "/api/v1/policy").then(function (res) {
+      fields.forEach(function (name) {
+        var value = field(res.data, name);
+        document.getElementById(name).value = value === null || value === undefined ? "" : String(value);
+      });
+      status("Policy loaded.");
+    }, function (err) { status(err.message, true); });
+  }
+
+  document.getElementById("login").addEventListener("submit", function (e) {
+    e.preventDefault();
+    var basic = "Basic " + btoa(document.getElementById("username").value + ":" + document.getElementById("password").value);
+    fetch("/api/v1/auth/token", { headers: { "Accept": "application/json", "Authorization": basic } }).then(function (res) {
+      if (res.status === 404) {
+        authorization = basic;
+        return;
+      }
+      if (!res.ok) {
+        return failure(res);
+      }
+      return res.json().then(function (body) { authorization = "Bearer " + body.data.token; });
+    }).then(load).catch(function (err) { status(err.message, true); });
+  });
+
+  document.getElementById("policy").addEventListener("submit", function (e) {
+    e.preventDefault();
+    var policy = {};
+    fields.forEach(function (name) {
+      var value = document.getElementById(name).value;
+      policy[name] = value === "" ? null : Number(value);
+    });
+    call("PUT", "/api/v1/policy", policy).then(function (res) {
+      status("Policy saved (" + ((res.meta && res.meta.outcome) || "ok") + ").");
+    }, function (err) { status(err.message, true); });
+  });
+})();
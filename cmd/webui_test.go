@@ -0,0 +1,65 @@
+package main
+
+import (
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// useWebUI serves the web UI for the rest of the test.
+func useWebUI(t *testing.T) {
+	previous, exempt := webUIEnabled, maps.Clone(authExemptPaths)
+	webUIEnabled = true
+	setupWebUI()
+	t.Cleanup(func() {
+		webUIEnabled, authExemptPaths = previous, exempt
+	})
+}
+
+func TestWebUIServed(t *testing.T) {
+	useWebUI(t)
+	handler := newTestHandler()
+
+	tests := []struct {
+		path        string
+		contentType string
+		contains    string
+	}{
+		{path: "/", contentType: "text/html", contains: `<script src="/ui/script.js"></script>`},
+		{path: "/ui/script.js", contentType: "javascript", contains: `"/api/v1/policy"`},
+		{path: "/ui/style.css", contentType: "text/css", contains: "#status"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			// served without credentials
+			w := serve(handler, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+			}
+			if got := w.Header().Get("Content-Type"); !strings.Contains(got, tt.contentType) {
+				t.Errorf("Content-Type = %q, want %s", got, tt.contentType)
+			}
+			if !strings.Contains(w.Body.String(), tt.contains) {
+				t.Errorf("body does not contain %s", tt.contains)
+			}
+		})
+	}
+
+	w := serve(handler, httptest.NewRequest("GET", "/", nil))
+	if csp := w.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "script-src 'self'") {
+		t.Errorf("Content-Security-Policy = %q", csp)
+	}
+}
+
+func TestWebUIUnknownAsset(t *testing.T) {
+	useWebUI(t)
+
+	for _, path := range []string{"/ui/missing.js", "/ui/index.html"} {
+		if w := serve(newTestHandler(), asAdmin(httptest.NewRequest("GET", path, nil))); w.Code != http.StatusNotFound {
+			t.Errorf("GET %s status = %d, want %d", path, w.Code, http.StatusNotFound)
+		}
+	}
+}
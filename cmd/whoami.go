@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+)
+
+const whoamiPath = "/api/v1/whoami"
+
+// How a request was authenticated, as reported by whoami.
+const (
+	strategyBasic        = "basic"
+	strategyBearer       = "bearer"
+	strategyServiceToken = "service_token"
+	strategyTokenReview  = "tokenreview"
+	strategyGateway      = "gateway"
+)
+
+// tokenClaims are the claims of the bearer token a request was authenticated with.
+type tokenClaims struct {
+	JTI string `json:"jti,omitempty"`
+	Exp int64  `json:"exp,omitempty"`
+}
+
+type whoamiResponse struct {
+	User     string       `json:"user"`
+	Groups   []string     `json:"groups"`
+	Strategy string       `json:"strategy"`
+	Claims   *tokenClaims `json:"claims,omitempty"`
+}
+
+// authStrategy works out which strategy authenticated r from the extensions each of
+// them sets. Basic auth and Kubernetes tokens set none, so they are told apart by the
+// Authorization header.
+func authStrategy(r *http.Request, id identity) string {
+	extensions := id.info.Extensions()
+	switch {
+	case len(extensions[gatewayExtension]) > 0:
+		return strategyGateway
+	case len(extensions[serviceTokenExtension]) > 0:
+		return strategyServiceToken
+	case id.tokenID != "":
+		return strategyBearer
+	}
+
+	if _, _, ok := r.BasicAuth(); ok {
+		return strategyBasic
+	}
+
+	return strategyTokenReview
+}
+
+// whoami returns the identity the request was authenticated as, to help clients debug
+// authentication.
+func whoami(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Methods", "*")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "*")
+	w.Header().Set("Access-Control-Expose-Headers", "*")
+
+	id, _ := r.Context().Value(identityKey{}).(identity)
+	if id.info == nil {
+		writeError(w, http.StatusUnauthorized, codeUnauthorized, "Request is not authenticated.")
+		return
+	}
+
+	response := whoamiResponse{
+		User:     id.user,
+		Groups:   id.info.Groups(),
+		Strategy: authStrategy(r, id),
+	}
+	if response.Groups == nil {
+		response.Groups = []string{}
+	}
+
+	if id.tokenID != "" {
+		response.Claims = &tokenClaims{JTI: id.tokenID}
+		if exp := id.info.Extensions()[tokenExpiryExtension]; len(exp) > 0 {
+			response.Claims.Exp, _ = strconv.ParseInt(exp[0], 10, 64)
+		}
+	}
+
+	writeData(w, http.StatusOK, response, nil)
+}
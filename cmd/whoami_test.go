@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestWhoamiBasicAuth(t *testing.T) {
+	status, got := whoamiOf(t, asAdmin(httptest.NewRequest("GET", whoamiPath, nil)))
+	want := whoamiResponse{User: username, Groups: []string{roleAdmin, roleReader, roleWriter}, Strategy: strategyBasic}
+	if status != http.StatusOK || !reflect.DeepEqual(got, want) {
+		t.Errorf("whoami = %d %+v, want %d %+v", status, got, http.StatusOK, want)
+	}
+}
+
+func TestWhoamiBearerToken(t *testing.T) {
+	token := issueToken(t, "alice")
+	claims := jwt.RegisteredClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, &claims); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("GET", whoamiPath, nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	status, got := whoamiOf(t, r)
+	want := whoamiResponse{
+		User:     "alice",
+		Groups:   []string{roleReader},
+		Strategy: strategyBearer,
+		Claims:   &tokenClaims{JTI: claims.ID, Exp: claims.ExpiresAt.Unix()},
+	}
+	if status != http.StatusOK || !reflect.DeepEqual(got, want) {
+		t.Errorf("whoami = %d %+v %+v, want %d %+v %+v", status, got, got.Claims, http.StatusOK, want, want.Claims)
+	}
+}
+
+func TestWhoamiUnauthenticated(t *testing.T) {
+	if status, _ := whoamiOf(t, httptest.NewRequest("GET", whoamiPath, nil)); status != http.StatusUnauthorized {
+		t.Errorf("whoami without credentials = %d, want %d", status, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,179 @@
+//go:build envtest
+
+package policy
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+// envClient talks to the API server started by TestMain.
+var envClient kubernetes.Interface
+
+// TestMain runs the package tests against a real API server and etcd, started by
+// envtest from the binaries in KUBEBUILDER_ASSETS:
+//
+//	KUBEBUILDER_ASSETS="$(setup-envtest use -p path 1.34.x)" go test -tags envtest ./pkg
+func TestMain(m *testing.M) {
+	os.Exit(runWithEnvironment(m))
+}
+
+// runWithEnvironment starts the API server, runs the tests and stops it again, so it
+// is stopped even when a test fails.
+func runWithEnvironment(m *testing.M) int {
+	env := &envtest.Environment{}
+	config, err := env.Start()
+	if err != nil {
+		log.Printf("envtest failed to start, is KUBEBUILDER_ASSETS set? %v", err)
+		return 1
+	}
+	defer func() {
+		if err := env.Stop(); err != nil {
+			log.Printf("envtest failed to stop: %v", err)
+		}
+	}()
+
+	if envClient, err = kubernetes.NewForConfig(config); err != nil {
+		log.Printf("envtest client: %v", err)
+		return 1
+	}
+
+	return m.Run()
+}
+
+// envPolicyArgs returns PolicyArgs for the ncfs-policy ConfigMap in a namespace of
+// its own that is deleted after the test.
+func envPolicyArgs(t *testing.T) PolicyArgs {
+	ctx := context.Background()
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "ncfs-"}}
+	namespace, err := envClient.CoreV1().Namespaces().Create(ctx, namespace, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		envClient.CoreV1().Namespaces().Delete(ctx, namespace.Name, metav1.DeleteOptions{})
+	})
+
+	return PolicyArgs{Client: envClient, Namespace: namespace.Name, ConfigMapName: "ncfs-policy", Policy: `{"UnprocessableFileTypeAction":1}`}
+}
+
+func TestEnvCreatePolicy(t *testing.T) {
+	pa := envPolicyArgs(t)
+
+	created, err := pa.CreatePolicy(context.Background())
+	if err != nil || !created {
+		t.Fatalf("CreatePolicy() = %v, %v, want created", created, err)
+	}
+
+	pa.Policy = `{"UnprocessableFileTypeAction":2}`
+	created, err = pa.CreatePolicy(context.Background())
+	if err != nil || created {
+		t.Errorf("CreatePolicy() of an existing config map = %v, %v, want false", created, err)
+	}
+
+	if got, err := pa.GetPolicy(context.Background()); err != nil || got != `{"UnprocessableFileTypeAction":1}` {
+		t.Errorf("GetPolicy() = %s, %v, want the created policy kept", got, err)
+	}
+}
+
+func TestEnvApplyCreatesPolicy(t *testing.T) {
+	pa := envPolicyArgs(t)
+	pa.ServerSideApply = true
+
+	result, err := pa.UpdatePolicy(context.Background())
+	if err != nil || result.Outcome != Created {
+		t.Fatalf("UpdatePolicy() = %v, %v, want created", result.Outcome, err)
+	}
+}
+
+func TestEnvUpdatePolicy(t *testing.T) {
+	for _, serverSideApply := range []bool{false, true} {
+		t.Run(map[bool]string{false: "update", true: "apply"}[serverSideApply], func(t *testing.T) {
+			ctx := context.Background()
+			pa := envPolicyArgs(t)
+			if _, err := pa.CreatePolicy(ctx); err != nil {
+				t.Fatal(err)
+			}
+			pa.ServerSideApply = serverSideApply
+
+			pa.Policy = `{"UnprocessableFileTypeAction":2}`
+			updated, err := pa.UpdatePolicy(ctx)
+			if err != nil || updated.Outcome != Updated {
+				t.Fatalf("UpdatePolicy() = %v, %v, want updated", updated.Outcome, err)
+			}
+
+			unchanged, err := pa.UpdatePolicy(ctx)
+			if err != nil || unchanged.Outcome != Unchanged || unchanged.ResourceVersion != updated.ResourceVersion {
+				t.Errorf("repeated UpdatePolicy() = %+v, %v, want unchanged at %s", unchanged, err, updated.ResourceVersion)
+			}
+
+			if got, err := pa.GetPolicy(ctx); err != nil || got != pa.Policy {
+				t.Errorf("GetPolicy() = %s, %v, want %s", got, err, pa.Policy)
+			}
+		})
+	}
+}
+
+func TestEnvApplyConflict(t *testing.T) {
+	ctx := context.Background()
+	pa := envPolicyArgs(t)
+	pa.ServerSideApply = true
+
+	// a GitOps tool applies the policy first
+	patch := `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"ncfs-policy"},"data":{"appsettings.json":"{\"UnprocessableFileTypeAction\":1}"}}`
+	if _, err := envClient.CoreV1().ConfigMaps(pa.Namespace).Patch(ctx, pa.ConfigMapName, types.ApplyPatchType, []byte(patch), metav1.PatchOptions{FieldManager: "gitops"}); err != nil {
+		t.Fatal(err)
+	}
+
+	pa.Policy = `{"UnprocessableFileTypeAction":2}`
+	if _, err := pa.UpdatePolicy(ctx); !errors.Is(err, ErrConflict) {
+		t.Errorf("UpdatePolicy() error = %v, want ErrConflict", err)
+	}
+}
+
+func TestEnvPreconditionConflict(t *testing.T) {
+	ctx := context.Background()
+	pa := envPolicyArgs(t)
+	if _, err := pa.CreatePolicy(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// another client writes the ConfigMap between the check and the apply
+	pa.ServerSideApply = true
+	pa.Policy = `{"UnprocessableFileTypeAction":2}`
+	pa.Precondition = func(string) error {
+		configMaps := envClient.CoreV1().ConfigMaps(pa.Namespace)
+		configMap, err := configMaps.Get(ctx, pa.ConfigMapName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		configMap.Data[policyKey] = `{"UnprocessableFileTypeAction":3}`
+		_, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{})
+		return err
+	}
+
+	if _, err := pa.UpdatePolicy(ctx); !errors.Is(err, ErrConflict) {
+		t.Errorf("UpdatePolicy() error = %v, want ErrConflict", err)
+	}
+}
+
+func TestEnvNotFound(t *testing.T) {
+	ctx := context.Background()
+	pa := envPolicyArgs(t)
+
+	if _, err := pa.UpdatePolicy(ctx); !errors.Is(err, ErrNotFound) {
+		t.Errorf("UpdatePolicy() error = %v, want ErrNotFound", err)
+	}
+	if _, err := pa.GetPolicy(ctx); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetPolicy() error = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,52 @@
+package policy
+
+import (
+	"errors"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// Categories of ConfigMap operation failures, matched with errors.Is.
+var (
+	ErrClientInit = errors.New("unable to create kubernetes client")
+	ErrNotFound   = errors.New("config map not found")
+	ErrForbidden  = errors.New("access to config map forbidden")
+	ErrConflict   = errors.New("config map was modified concurrently")
+	// ErrPreconditionFailed is returned when PolicyArgs.Precondition rejects the stored policy.
+	ErrPreconditionFailed = errors.New("stored policy does not meet the precondition")
+)
+
+// Error wraps an underlying client-go error with its category. errors.Is matches
+// the category and errors.As still reaches the underlying error.
+type Error struct {
+	Kind error
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Kind.Error() + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+// classify wraps an API server error with its category, leaving other errors untouched.
+func classify(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case apierrors.IsNotFound(err):
+		return &Error{Kind: ErrNotFound, Err: err}
+	case apierrors.IsForbidden(err):
+		return &Error{Kind: ErrForbidden, Err: err}
+	case apierrors.IsConflict(err):
+		return &Error{Kind: ErrConflict, Err: err}
+	default:
+		return err
+	}
+}
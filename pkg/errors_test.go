@@ -0,0 +1,89 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestClassify(t *testing.T) {
+	configMaps := schema.GroupResource{Resource: "configmaps"}
+	tests := []struct {
+		name string
+		err  error
+		kind error
+	}{
+		{name: "not found", err: apierrors.NewNotFound(configMaps, "ncfs-policy"), kind: ErrNotFound},
+		{name: "forbidden", err: apierrors.NewForbidden(configMaps, "ncfs-policy", errors.New("denied")), kind: ErrForbidden},
+		{name: "conflict", err: apierrors.NewConflict(configMaps, "ncfs-policy", errors.New("modified")), kind: ErrConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := classify(tt.err)
+			if !errors.Is(err, tt.kind) {
+				t.Errorf("classify(%v) = %v, want %v", tt.err, err, tt.kind)
+			}
+
+			var status *apierrors.StatusError
+			if !errors.As(err, &status) || status != tt.err {
+				t.Errorf("classify(%v) does not unwrap to the API server error", tt.err)
+			}
+
+			for _, other := range []error{ErrClientInit, ErrNotFound, ErrForbidden, ErrConflict, ErrPreconditionFailed} {
+				if other != tt.kind && errors.Is(err, other) {
+					t.Errorf("classify(%v) also matches %v", tt.err, other)
+				}
+			}
+		})
+	}
+}
+
+func TestClassifyLeavesOtherErrors(t *testing.T) {
+	if err := classify(nil); err != nil {
+		t.Errorf("classify(nil) = %v", err)
+	}
+
+	for _, err := range []error{errors.New("connection refused"), apierrors.NewBadRequest("invalid"), context.DeadlineExceeded} {
+		if got := classify(err); got != err {
+			t.Errorf("classify(%v) = %v, want it unchanged", err, got)
+		}
+	}
+}
+
+func TestErrorMessage(t *testing.T) {
+	err := &Error{Kind: ErrNotFound, Err: errors.New(`configmaps "ncfs-policy" not found`)}
+	if got, want := err.Error(), `config map not found: configmaps "ncfs-policy" not found`; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestGetClientError(t *testing.T) {
+	previous := NewClient
+	NewClient = func() (kubernetes.Interface, error) { return nil, errors.New("no in-cluster config") }
+	t.Cleanup(func() { NewClient = previous })
+
+	var pa PolicyArgs
+	if err := pa.GetClient(); !errors.Is(err, ErrClientInit) {
+		t.Errorf("GetClient() = %v, want ErrClientInit", err)
+	}
+}
+
+func TestUpdatePolicyForbidden(t *testing.T) {
+	client := fake.NewClientset(policyConfigMap("ncfs"))
+	client.PrependReactor("update", "configmaps", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "configmaps"}, "ncfs-policy", errors.New("denied"))
+	})
+
+	pa := PolicyArgs{Client: client, Namespace: "ncfs", ConfigMapName: "ncfs-policy", Policy: `{"UnprocessableFileTypeAction":2}`}
+	if _, err := pa.UpdatePolicy(context.Background()); !errors.Is(err, ErrForbidden) {
+		t.Errorf("error = %v, want ErrForbidden", err)
+	}
+}
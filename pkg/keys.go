@@ -0,0 +1,74 @@
+package policy
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// policyData returns the ConfigMap data keys holding the policy. Without PolicyKeys
+// that is the whole document under appsettings.json; with them, each listed top level
+// field of the document is stored as JSON under its own key, and a field that is
+// absent or null has no key.
+func (pa PolicyArgs) policyData() (map[string]string, error) {
+	if len(pa.PolicyKeys) == 0 {
+		return map[string]string{policyKey: pa.Policy}, nil
+	}
+
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal([]byte(pa.Policy), &fields)
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string]string{}
+	for _, key := range pa.PolicyKeys {
+		if raw, ok := fields[key]; ok && string(raw) != "null" {
+			data[key] = string(raw)
+		}
+	}
+
+	return data, nil
+}
+
+// RenderPolicy returns the ConfigMap data keys a write of the policy would store,
+// without writing anything.
+func (pa PolicyArgs) RenderPolicy() (map[string]string, error) {
+	return pa.policyData()
+}
+
+// writePolicyData replaces the policy keys in data with policy, leaving other keys alone.
+func (pa PolicyArgs) writePolicyData(data, policy map[string]string) {
+	for _, key := range pa.PolicyKeys {
+		delete(data, key)
+	}
+
+	for key, value := range policy {
+		data[key] = value
+	}
+}
+
+// policyFromData reassembles the policy document from ConfigMap data, the inverse of
+// policyData. Fields are written in PolicyKeys order, so a document encoded from the
+// same struct round-trips unchanged. It returns "" when no policy key is present.
+func (pa PolicyArgs) policyFromData(data map[string]string) string {
+	if len(pa.PolicyKeys) == 0 {
+		return data[policyKey]
+	}
+
+	var fields []string
+	for _, key := range pa.PolicyKeys {
+		value, ok := data[key]
+		if !ok {
+			continue
+		}
+
+		name, _ := json.Marshal(key)
+		fields = append(fields, string(name)+":"+value)
+	}
+
+	if len(fields) == 0 {
+		return ""
+	}
+
+	return "{" + strings.Join(fields, ",") + "}\n"
+}
@@ -0,0 +1,64 @@
+package policy
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"slices"
+)
+
+type logAttrsKey struct{}
+
+// WithLogFields returns a copy of ctx carrying the given key and value pairs as log
+// attributes, which are added to every record logged with the context. Fields already
+// on ctx are kept.
+func WithLogFields(ctx context.Context, keysAndValues ...string) context.Context {
+	attrs := slices.Clip(LogAttrs(ctx))
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		attrs = append(attrs, slog.String(keysAndValues[i], keysAndValues[i+1]))
+	}
+
+	return context.WithValue(ctx, logAttrsKey{}, attrs)
+}
+
+// LogAttrs returns the log attributes carried by ctx.
+func LogAttrs(ctx context.Context) []slog.Attr {
+	attrs, _ := ctx.Value(logAttrsKey{}).([]slog.Attr)
+	return attrs
+}
+
+// ContextHandler is a slog.Handler that adds the attributes carried by the context of
+// each record, so code logging with slog.InfoContext and the like gets the request's
+// attributes without being handed a logger.
+type ContextHandler struct {
+	slog.Handler
+}
+
+// NewContextHandler returns a ContextHandler writing to h.
+func NewContextHandler(h slog.Handler) *ContextHandler {
+	return &ContextHandler{Handler: h}
+}
+
+func (h *ContextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if attrs := LogAttrs(ctx); len(attrs) > 0 {
+		r = r.Clone()
+		r.AddAttrs(attrs...)
+	}
+
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *ContextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &ContextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *ContextHandler) WithGroup(name string) slog.Handler {
+	return &ContextHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// Logger returns a logger for code that logs with Printf. Each line is logged as an
+// info record of the default slog handler with the attributes of ctx, so lines logged
+// while serving a request can be told apart and grouped.
+func Logger(ctx context.Context) *log.Logger {
+	return slog.NewLogLogger(slog.Default().Handler().WithAttrs(LogAttrs(ctx)), slog.LevelInfo)
+}
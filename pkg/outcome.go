@@ -0,0 +1,37 @@
+package policy
+
+// Outcome is what a write did to the ConfigMap.
+type Outcome int
+
+const (
+	// OutcomeUnknown is the zero Outcome, of a result returned with an error: nothing
+	// is known to have been written.
+	OutcomeUnknown Outcome = iota
+	// Updated means the ConfigMap existed and its policy or annotations changed.
+	Updated
+	// Created means the ConfigMap did not exist and was created holding the policy.
+	Created
+	// Unchanged means the ConfigMap already held the policy and annotations, so
+	// nothing was written.
+	Unchanged
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case Updated:
+		return "updated"
+	case Created:
+		return "created"
+	case Unchanged:
+		return "unchanged"
+	default:
+		return "unknown"
+	}
+}
+
+// UpdateResult is the outcome of a successful write and the resourceVersion of the
+// ConfigMap after it.
+type UpdateResult struct {
+	Outcome         Outcome
+	ResourceVersion string
+}
@@ -2,31 +2,128 @@ package policy
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
 
 	"github.com/matryer/try"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 )
 
+const policyKey = "appsettings.json"
+
+// Field managers owning the policy field and the annotations written with it when
+// they are written with server-side apply. Annotations have their own manager so a
+// write that doesn't list them, such as a PATCH, leaves them in place.
+const (
+	policyFieldManager     = "ncfs-policy-update-service"
+	annotationFieldManager = "ncfs-policy-update-service-annotations"
+)
+
+// targetLocks holds a mutex per namespace/name so concurrent writes to the same
+// ConfigMap from this process serialize, while writes to other ConfigMaps don't wait.
+var targetLocks sync.Map
+
+func lockTarget(namespace, configMapName string) func() {
+	l, _ := targetLocks.LoadOrStore(namespace+"/"+configMapName, &sync.Mutex{})
+	mu := l.(*sync.Mutex)
+	mu.Lock()
+
+	return mu.Unlock
+}
+
 type PolicyArgs struct {
-	Client        *kubernetes.Clientset
+	Client        kubernetes.Interface
 	Policy        string
 	Namespace     string
 	ConfigMapName string
+	LabelSelector string
+	// Annotations are written to the ConfigMap alongside the policy. An empty value
+	// removes the annotation; annotations not listed are left untouched.
+	Annotations map[string]string
+	// ServerSideApply writes the policy with a server-side apply patch instead of a
+	// read-modify-write, so the API server resolves field ownership.
+	ServerSideApply bool
+	// PolicyKeys, when set, stores each of these top level policy fields under its
+	// own ConfigMap key instead of the whole document under appsettings.json.
+	PolicyKeys []string
+	// ReplaceData makes the policy keys the only data in the ConfigMap, removing any
+	// other keys, instead of leaving them alongside the policy. It is not supported
+	// with ServerSideApply, which only ever writes the fields it owns.
+	ReplaceData bool
+	// Precondition, when set, is called with the stored policy before it is replaced
+	// and aborts the write by returning an error. The write only succeeds if the
+	// ConfigMap is unchanged since the check.
+	Precondition func(current string) error
+	// Written, when set, is called with the serialized size in bytes of the ConfigMap
+	// after each successful write.
+	Written func(namespace, configMapName string, size int)
 }
 
-func (policyArgs *PolicyArgs) GetClient() error {
+// StoredPolicy is the policy document held in a ConfigMap together with the
+// ConfigMap's annotations, its serialized size in bytes and when it was created and
+// last modified.
+type StoredPolicy struct {
+	Policy            string
+	Annotations       map[string]string
+	Size              int
+	CreationTimestamp time.Time
+	LastModified      time.Time
+}
+
+func (pa PolicyArgs) written(configMap *corev1.ConfigMap) {
+	if pa.Written != nil {
+		pa.Written(configMap.Namespace, configMap.Name, configMap.Size())
+	}
+}
+
+// TargetResult is the outcome of applying the policy to a single ConfigMap.
+type TargetResult struct {
+	Namespace     string
+	ConfigMapName string
+	Outcome       Outcome
+	Err           error
+}
+
+// ValidateNames checks the namespace and ConfigMap name against the Kubernetes naming rules.
+func ValidateNames(namespace, configMapName string) error {
+	if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+		return fmt.Errorf("invalid namespace %q: %s", namespace, strings.Join(errs, "; "))
+	}
+
+	if errs := validation.IsDNS1123Subdomain(configMapName); len(errs) > 0 {
+		return fmt.Errorf("invalid ConfigMap name %q: %s", configMapName, strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// NewClient creates the Kubernetes client used by GetClient and NewReviewer. It uses
+// the in-cluster configuration and is replaced in tests.
+var NewClient = func() (kubernetes.Interface, error) {
 	config, err := rest.InClusterConfig()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	client, err := kubernetes.NewForConfig(config)
+	return kubernetes.NewForConfig(config)
+}
+
+func (policyArgs *PolicyArgs) GetClient() error {
+	client, err := NewClient()
 	if err != nil {
-		return err
+		return &Error{Kind: ErrClientInit, Err: err}
 	}
 
 	policyArgs.Client = client
@@ -34,27 +131,396 @@ func (policyArgs *PolicyArgs) GetClient() error {
 	return nil
 }
 
-func (pa PolicyArgs) UpdatePolicy() error {
-	err := try.Do(func(attempt int) (bool, error) {
+// UpdatePolicy writes the policy to the ConfigMap, retrying failed attempts while ctx
+// leaves time for them, and reports whether the ConfigMap was created, updated or
+// already up to date. Only server-side apply creates a missing ConfigMap; otherwise it
+// is ErrNotFound.
+func (pa PolicyArgs) UpdatePolicy(parent context.Context) (UpdateResult, error) {
+	policyData, err := pa.policyData()
+	if err != nil {
+		return UpdateResult{}, err
+	}
+
+	if pa.ServerSideApply {
+		return pa.applyPolicy(parent, policyData)
+	}
+
+	var result UpdateResult
+	err = try.Do(func(attempt int) (bool, error) {
 		configMaps := pa.Client.CoreV1().ConfigMaps(pa.Namespace)
 
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		ctx, cancel := context.WithTimeout(parent, 5*time.Second)
 		defer cancel()
 
+		unlock := lockTarget(pa.Namespace, pa.ConfigMapName)
 		currentPolicy, err := configMaps.Get(ctx, pa.ConfigMapName, metav1.GetOptions{})
 
-		if currentPolicy != nil {
-			currentPolicy.Data["appsettings.json"] = pa.Policy
+		if err == nil && pa.Precondition != nil {
+			if perr := pa.Precondition(pa.policyFromData(currentPolicy.Data)); perr != nil {
+				unlock()
+				return false, &Error{Kind: ErrPreconditionFailed, Err: perr}
+			}
+		}
+
+		if err == nil {
+			if currentPolicy.Data == nil {
+				currentPolicy.Data = map[string]string{}
+			}
 
-			_, err = configMaps.Update(ctx, currentPolicy, metav1.UpdateOptions{})
+			unmodified := currentPolicy.DeepCopy()
+			if pa.ReplaceData {
+				currentPolicy.Data = map[string]string{}
+			}
+			pa.writePolicyData(currentPolicy.Data, policyData)
+			applyAnnotations(&currentPolicy.ObjectMeta, pa.Annotations)
+
+			if reflect.DeepEqual(unmodified.Data, currentPolicy.Data) && reflect.DeepEqual(unmodified.Annotations, currentPolicy.Annotations) {
+				unlock()
+				Logger(parent).Printf("Config map %s/%s already holds the policy at resourceVersion %s", pa.Namespace, pa.ConfigMapName, currentPolicy.ResourceVersion)
+				result = UpdateResult{Outcome: Unchanged, ResourceVersion: currentPolicy.ResourceVersion}
+				return false, nil
+			}
+
+			before := currentPolicy.ResourceVersion
+
+			var updated *corev1.ConfigMap
+			updated, err = configMaps.Update(ctx, currentPolicy, metav1.UpdateOptions{})
+			if err != nil {
+				Logger(parent).Printf("Failed to update config map %s/%s at resourceVersion %s (attempt %d): %v", pa.Namespace, pa.ConfigMapName, before, attempt, err)
+			} else {
+				Logger(parent).Printf("Updated config map %s/%s, resourceVersion %s -> %s", pa.Namespace, pa.ConfigMapName, before, updated.ResourceVersion)
+				pa.written(updated)
+				result = UpdateResult{Outcome: Updated, ResourceVersion: updated.ResourceVersion}
+			}
 		}
+		unlock()
 
 		if err != nil && attempt < 5 {
-			time.Sleep((time.Duration(attempt) * 5) * time.Second) // exponential 5 second wait
+			if !retryable(err) {
+				return false, err
+			}
+
+			wait := (time.Duration(attempt) * 5) * time.Second // exponential 5 second wait
+			if deadline, ok := parent.Deadline(); ok && time.Until(deadline) < wait {
+				// the retry couldn't finish in time, so report this failure rather than
+				// waiting to report the deadline
+				return false, err
+			}
+
+			select {
+			case <-time.After(wait):
+			case <-parent.Done():
+				return false, parent.Err()
+			}
 		}
 
 		return attempt < 5, err // try 5 times
 	})
 
-	return err
+	return result, classify(err)
+}
+
+// retryable reports whether a failed write may succeed when tried again. A conflict
+// is retried, as each attempt reads the ConfigMap again; a missing ConfigMap, denied
+// access or an invalid write fail the same way every time.
+func retryable(err error) bool {
+	return !apierrors.IsNotFound(err) && !apierrors.IsForbidden(err) && !apierrors.IsUnauthorized(err) &&
+		!apierrors.IsInvalid(err) && !apierrors.IsBadRequest(err) && !errors.Is(err, ErrPreconditionFailed)
+}
+
+// applyPolicy sets the policy field with a server-side apply patch, followed by the
+// annotations when there are any to write. Fields another field manager applied are
+// reported as a conflict rather than overridden.
+func (pa PolicyArgs) applyPolicy(parent context.Context, policyData map[string]string) (UpdateResult, error) {
+	unlock := lockTarget(pa.Namespace, pa.ConfigMapName)
+	defer unlock()
+
+	configMap := pa.applyConfiguration()
+	configMap.Data = policyData
+
+	// read first to tell a created ConfigMap from an updated one, and an apply that
+	// changed nothing, which leaves the resourceVersion alone, from one that did
+	ctx, cancel := context.WithTimeout(parent, 5*time.Second)
+	current, err := pa.Client.CoreV1().ConfigMaps(pa.Namespace).Get(ctx, pa.ConfigMapName, metav1.GetOptions{})
+	cancel()
+	exists := err == nil
+	if err != nil && (pa.Precondition != nil || !apierrors.IsNotFound(err)) {
+		return UpdateResult{}, classify(err)
+	}
+
+	if pa.Precondition != nil {
+		if err := pa.Precondition(pa.policyFromData(current.Data)); err != nil {
+			return UpdateResult{}, &Error{Kind: ErrPreconditionFailed, Err: err}
+		}
+
+		// the apply fails with a conflict if the ConfigMap changed since the check
+		configMap.ResourceVersion = current.ResourceVersion
+	}
+
+	var owner *corev1.ConfigMap
+	if exists {
+		owner = current
+	}
+
+	applied, err := pa.apply(parent, configMap, policyFieldManager, owner)
+	if err == nil && pa.Annotations != nil {
+		// annotations this manager applied before and no longer lists are removed
+		configMap = pa.applyConfiguration()
+		applyAnnotations(&configMap.ObjectMeta, pa.Annotations)
+
+		applied, err = pa.apply(parent, configMap, annotationFieldManager, applied)
+	}
+	if err != nil {
+		return UpdateResult{}, err
+	}
+
+	result := UpdateResult{Outcome: Updated, ResourceVersion: applied.ResourceVersion}
+	switch {
+	case !exists:
+		result.Outcome = Created
+	case applied.ResourceVersion == current.ResourceVersion:
+		result.Outcome = Unchanged
+	}
+
+	return result, nil
+}
+
+func (pa PolicyArgs) applyConfiguration() *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "ConfigMap",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pa.ConfigMapName,
+			Namespace: pa.Namespace,
+		},
+	}
+}
+
+// apply applies configMap as manager. The fields it sets are taken over from managers
+// that wrote them with plain updates, such as kubectl edit or this service without
+// server-side apply, which would otherwise conflict with the first apply of each. A
+// field another manager applied, as a GitOps tool does, is left to that manager and
+// the apply fails with ErrConflict. current is the ConfigMap before the apply, or nil
+// if it doesn't exist.
+func (pa PolicyArgs) apply(parent context.Context, configMap *corev1.ConfigMap, manager string, current *corev1.ConfigMap) (*corev1.ConfigMap, error) {
+	ctx, cancel := context.WithTimeout(parent, 5*time.Second)
+	defer cancel()
+
+	patch, err := json.Marshal(configMap)
+	if err != nil {
+		return nil, err
+	}
+
+	force := current != nil &&
+		!appliedByOthers(current, manager, mapKeys(configMap.Data), "f:data") &&
+		!appliedByOthers(current, manager, mapKeys(configMap.Annotations), "f:metadata", "f:annotations")
+
+	applied, err := pa.Client.CoreV1().ConfigMaps(pa.Namespace).Patch(ctx, pa.ConfigMapName, types.ApplyPatchType, patch, metav1.PatchOptions{FieldManager: manager, Force: &force})
+	if err != nil {
+		Logger(parent).Printf("Failed to apply config map %s/%s as %s: %v", pa.Namespace, pa.ConfigMapName, manager, err)
+		return nil, classify(err)
+	}
+
+	Logger(parent).Printf("Applied config map %s/%s as %s, resourceVersion %s", pa.Namespace, pa.ConfigMapName, manager, applied.ResourceVersion)
+	pa.written(applied)
+	return applied, nil
+}
+
+// appliedByOthers reports whether a field manager other than manager owns one of keys
+// of the map at path in the managed fields of configMap through server-side apply.
+func appliedByOthers(configMap *corev1.ConfigMap, manager string, keys []string, path ...string) bool {
+	for _, entry := range configMap.ManagedFields {
+		if entry.Manager == manager || entry.Operation != metav1.ManagedFieldsOperationApply || entry.FieldsV1 == nil {
+			continue
+		}
+
+		fields := map[string]json.RawMessage{}
+		raw := json.RawMessage(entry.FieldsV1.Raw)
+		for _, name := range path {
+			if json.Unmarshal(raw, &fields) != nil {
+				fields = nil
+				break
+			}
+			raw = fields[name]
+		}
+		if fields == nil || json.Unmarshal(raw, &fields) != nil {
+			continue
+		}
+
+		for _, key := range keys {
+			if _, ok := fields["f:"+key]; ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func mapKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+func applyAnnotations(meta *metav1.ObjectMeta, annotations map[string]string) {
+	for key, value := range annotations {
+		if value == "" {
+			delete(meta.Annotations, key)
+			continue
+		}
+
+		if meta.Annotations == nil {
+			meta.Annotations = map[string]string{}
+		}
+		meta.Annotations[key] = value
+	}
+}
+
+// CreatePolicy creates the ConfigMap holding the policy. It returns false without
+// touching anything when the ConfigMap already exists.
+func (pa PolicyArgs) CreatePolicy(parent context.Context) (bool, error) {
+	policyData, err := pa.policyData()
+	if err != nil {
+		return false, err
+	}
+
+	ctx, cancel := context.WithTimeout(parent, 5*time.Second)
+	defer cancel()
+
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pa.ConfigMapName,
+			Namespace: pa.Namespace,
+		},
+		Data: policyData,
+	}
+	applyAnnotations(&configMap.ObjectMeta, pa.Annotations)
+
+	created, err := pa.Client.CoreV1().ConfigMaps(pa.Namespace).Create(ctx, configMap, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, classify(err)
+	}
+
+	Logger(parent).Printf("Created config map %s/%s, resourceVersion %s", pa.Namespace, pa.ConfigMapName, created.ResourceVersion)
+	pa.written(created)
+	return true, nil
+}
+
+// RecordEvent creates a Normal Event on the ConfigMap, so it shows in kubectl describe.
+func (pa PolicyArgs) RecordEvent(parent context.Context, reason, message string) error {
+	ctx, cancel := context.WithTimeout(parent, 5*time.Second)
+	defer cancel()
+
+	configMap, err := pa.Client.CoreV1().ConfigMaps(pa.Namespace).Get(ctx, pa.ConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		return classify(err)
+	}
+
+	now := metav1.Now()
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: pa.ConfigMapName + "-",
+			Namespace:    pa.Namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion:      "v1",
+			Kind:            "ConfigMap",
+			Namespace:       pa.Namespace,
+			Name:            pa.ConfigMapName,
+			UID:             configMap.UID,
+			ResourceVersion: configMap.ResourceVersion,
+		},
+		Reason:         reason,
+		Message:        message,
+		Type:           corev1.EventTypeNormal,
+		Source:         corev1.EventSource{Component: policyFieldManager},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+
+	_, err = pa.Client.CoreV1().Events(pa.Namespace).Create(ctx, event, metav1.CreateOptions{})
+	return classify(err)
+}
+
+// GetPolicy returns the policy currently stored in the ConfigMap.
+func (pa PolicyArgs) GetPolicy(parent context.Context) (string, error) {
+	stored, err := pa.GetStoredPolicy(parent)
+	return stored.Policy, err
+}
+
+// GetStoredPolicy returns the policy currently stored in the ConfigMap along with its annotations.
+func (pa PolicyArgs) GetStoredPolicy(parent context.Context) (StoredPolicy, error) {
+	ctx, cancel := context.WithTimeout(parent, 5*time.Second)
+	defer cancel()
+
+	configMap, err := pa.Client.CoreV1().ConfigMaps(pa.Namespace).Get(ctx, pa.ConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		return StoredPolicy{}, classify(err)
+	}
+
+	return StoredPolicy{
+		Policy:            pa.policyFromData(configMap.Data),
+		Annotations:       configMap.Annotations,
+		Size:              configMap.Size(),
+		CreationTimestamp: configMap.CreationTimestamp.Time,
+		LastModified:      lastModified(configMap),
+	}, nil
+}
+
+// lastModified returns the latest time any field manager wrote to the ConfigMap, as
+// tracked by the API server in its managed fields. Without managed fields it falls
+// back to the creation time.
+func lastModified(configMap *corev1.ConfigMap) time.Time {
+	modified := configMap.CreationTimestamp.Time
+	for _, entry := range configMap.ManagedFields {
+		if entry.Time != nil && entry.Time.After(modified) {
+			modified = entry.Time.Time
+		}
+	}
+
+	return modified
+}
+
+// UpdatePolicies applies the policy to every ConfigMap, in any namespace, matching LabelSelector.
+// A failure on one ConfigMap does not stop the others from being updated. The targets
+// are updated one after another within ctx, so once it is done the remaining ones fail
+// with its error without being tried.
+func (pa PolicyArgs) UpdatePolicies(ctx context.Context) ([]TargetResult, error) {
+	listCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	configMaps, err := pa.Client.CoreV1().ConfigMaps(metav1.NamespaceAll).List(listCtx, metav1.ListOptions{LabelSelector: pa.LabelSelector})
+	if err != nil {
+		return nil, classify(err)
+	}
+
+	results := make([]TargetResult, 0, len(configMaps.Items))
+	for _, configMap := range configMaps.Items {
+		target := pa
+		target.Namespace = configMap.Namespace
+		target.ConfigMapName = configMap.Name
+
+		result, err := UpdateResult{}, ctx.Err()
+		if err == nil {
+			result, err = target.UpdatePolicy(ctx)
+		}
+		results = append(results, TargetResult{
+			Namespace:     configMap.Namespace,
+			ConfigMapName: configMap.Name,
+			Outcome:       result.Outcome,
+			Err:           err,
+		})
+	}
+
+	return results, nil
 }
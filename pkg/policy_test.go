@@ -0,0 +1,277 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func policyConfigMap(namespace string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "ncfs-policy", Namespace: namespace, Labels: map[string]string{"app": "ncfs"}},
+		Data:       map[string]string{policyKey: `{"UnprocessableFileTypeAction":1}`},
+	}
+}
+
+func TestUpdatePolicyNotRetried(t *testing.T) {
+	pa := PolicyArgs{Client: fake.NewClientset(), Namespace: "ncfs", ConfigMapName: "ncfs-policy", Policy: "{}"}
+
+	start := time.Now()
+	_, err := pa.UpdatePolicy(context.Background())
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("error = %v, want ErrNotFound", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("a missing config map took %v to report", elapsed)
+	}
+}
+
+func TestUpdatePolicyRetriesWithinDeadline(t *testing.T) {
+	client := fake.NewClientset(policyConfigMap("ncfs"))
+	attempts := 0
+	client.PrependReactor("update", "configmaps", func(k8stesting.Action) (bool, runtime.Object, error) {
+		attempts++
+		return true, nil, apierrors.NewServiceUnavailable("etcd is unavailable")
+	})
+	pa := PolicyArgs{Client: client, Namespace: "ncfs", ConfigMapName: "ncfs-policy", Policy: "{}"}
+
+	// the first retry waits 5s, more than the deadline leaves
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	_, err := pa.UpdatePolicy(ctx)
+	if !apierrors.IsServiceUnavailable(err) {
+		t.Errorf("error = %v, want the API error rather than the deadline", err)
+	}
+	if attempts != 1 || time.Since(start) > time.Second {
+		t.Errorf("%d attempts in %v, want 1 without waiting for the deadline", attempts, time.Since(start))
+	}
+}
+
+func TestUpdatePoliciesWithinContext(t *testing.T) {
+	client := fake.NewClientset(policyConfigMap("a"), policyConfigMap("b"), policyConfigMap("c"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the request ends while the first target is written
+	client.PrependReactor("update", "configmaps", func(k8stesting.Action) (bool, runtime.Object, error) {
+		cancel()
+		return false, nil, nil
+	})
+	pa := PolicyArgs{Client: client, LabelSelector: "app=ncfs", Policy: "{}"}
+
+	results, err := pa.UpdatePolicies(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+	if results[0].Err != nil {
+		t.Errorf("first target failed: %v", results[0].Err)
+	}
+	for _, result := range results[1:] {
+		if !errors.Is(result.Err, context.Canceled) {
+			t.Errorf("target %s/%s error = %v, want context.Canceled", result.Namespace, result.ConfigMapName, result.Err)
+		}
+	}
+}
+
+func TestConcurrentUpdatesKeepEveryWrite(t *testing.T) {
+	client := fake.NewClientset(policyConfigMap("ncfs"))
+	// a slow read leaves room for the other writers to read the same ConfigMap
+	client.PrependReactor("get", "configmaps", func(k8stesting.Action) (bool, runtime.Object, error) {
+		time.Sleep(time.Millisecond)
+		return false, nil, nil
+	})
+
+	// each writer adds an annotation of its own to whatever the ConfigMap holds, so a
+	// write based on a stale read drops another writer's annotation
+	const writers = 20
+	var wg sync.WaitGroup
+	for i := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pa := PolicyArgs{Client: client, Namespace: "ncfs", ConfigMapName: "ncfs-policy", Policy: "{}",
+				Annotations: map[string]string{"writer-" + strconv.Itoa(i): "done"}}
+			if _, err := pa.UpdatePolicy(context.Background()); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	configMap, err := client.CoreV1().ConfigMaps("ncfs").Get(context.Background(), "ncfs-policy", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range writers {
+		if _, ok := configMap.Annotations["writer-"+strconv.Itoa(i)]; !ok {
+			t.Errorf("the update of writer %d was lost", i)
+		}
+	}
+}
+
+func TestUpdatePolicyOutcome(t *testing.T) {
+	ctx := context.Background()
+	configMap := policyConfigMap("ncfs")
+	configMap.ResourceVersion = "7"
+	pa := PolicyArgs{Client: fake.NewClientset(configMap), Namespace: "ncfs", ConfigMapName: "ncfs-policy", Policy: `{"UnprocessableFileTypeAction":2}`}
+
+	updated, err := pa.UpdatePolicy(ctx)
+	if err != nil || updated.Outcome != Updated {
+		t.Fatalf("UpdatePolicy() = %v, %v, want updated", updated.Outcome, err)
+	}
+
+	unchanged, err := pa.UpdatePolicy(ctx)
+	if err != nil || unchanged.Outcome != Unchanged || unchanged.ResourceVersion != updated.ResourceVersion {
+		t.Errorf("repeated UpdatePolicy() = %+v, %v, want unchanged at %q", unchanged, err, updated.ResourceVersion)
+	}
+}
+
+func TestUpdatePolicyOutcomeOfError(t *testing.T) {
+	pa := PolicyArgs{Client: fake.NewClientset(), Namespace: "ncfs", ConfigMapName: "ncfs-policy", Policy: "{}"}
+
+	result, err := pa.UpdatePolicy(context.Background())
+	if err == nil || result.Outcome != OutcomeUnknown || result.Outcome.String() != "unknown" {
+		t.Errorf("UpdatePolicy() of a missing config map = %v, %v, want an error and no outcome", result.Outcome, err)
+	}
+}
+
+func TestUpdatePolicyDataStrategy(t *testing.T) {
+	const policy = `{"UnprocessableFileTypeAction":2}`
+
+	for _, replace := range []bool{false, true} {
+		configMap := policyConfigMap("ncfs")
+		configMap.Data["logging.json"] = `{"level":"info"}`
+		client := fake.NewClientset(configMap)
+
+		pa := PolicyArgs{Client: client, Namespace: "ncfs", ConfigMapName: "ncfs-policy", Policy: policy, ReplaceData: replace}
+		if _, err := pa.UpdatePolicy(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		updated, err := client.CoreV1().ConfigMaps("ncfs").Get(context.Background(), "ncfs-policy", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := map[string]string{policyKey: policy, "logging.json": `{"level":"info"}`}
+		if replace {
+			want = map[string]string{policyKey: policy}
+		}
+		if !reflect.DeepEqual(updated.Data, want) {
+			t.Errorf("ReplaceData %v: data = %v, want %v", replace, updated.Data, want)
+		}
+	}
+}
+
+func TestApplyPolicy(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewClientset()
+	pa := PolicyArgs{Client: client, Namespace: "ncfs", ConfigMapName: "ncfs-policy", ServerSideApply: true, Policy: `{"UnprocessableFileTypeAction":1}`}
+
+	result, err := pa.UpdatePolicy(ctx)
+	if err != nil || result.Outcome != Created {
+		t.Fatalf("first apply = %v, %v, want created", result.Outcome, err)
+	}
+
+	// the fake API leaves resourceVersion unset, so an update is told by the stored policy
+	pa.Policy = `{"UnprocessableFileTypeAction":2}`
+	if _, err := pa.UpdatePolicy(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := storedPolicy(t, client); got != pa.Policy {
+		t.Errorf("stored policy = %s, want %s", got, pa.Policy)
+	}
+}
+
+func storedPolicy(t *testing.T, client *fake.Clientset) string {
+	configMap, err := client.CoreV1().ConfigMaps("ncfs").Get(context.Background(), "ncfs-policy", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return configMap.Data[policyKey]
+}
+
+func TestApplyPolicyTakesOverUpdatedFields(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewClientset()
+	configMap := policyConfigMap("ncfs")
+	if _, err := client.CoreV1().ConfigMaps("ncfs").Create(ctx, configMap, metav1.CreateOptions{FieldManager: "kubectl-edit"}); err != nil {
+		t.Fatal(err)
+	}
+
+	pa := PolicyArgs{Client: client, Namespace: "ncfs", ConfigMapName: "ncfs-policy", ServerSideApply: true, Policy: `{"UnprocessableFileTypeAction":2}`}
+	if _, err := pa.UpdatePolicy(ctx); err != nil {
+		t.Fatalf("apply over a field written by an update: %v", err)
+	}
+	if got := storedPolicy(t, client); got != pa.Policy {
+		t.Errorf("stored policy = %s, want %s", got, pa.Policy)
+	}
+}
+
+func TestApplyPolicyConflict(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewClientset()
+
+	// a GitOps tool applies the policy first
+	patch := `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"ncfs-policy","namespace":"ncfs"},"data":{"appsettings.json":"{\"UnprocessableFileTypeAction\":1}"}}`
+	if _, err := client.CoreV1().ConfigMaps("ncfs").Patch(ctx, "ncfs-policy", types.ApplyPatchType, []byte(patch), metav1.PatchOptions{FieldManager: "gitops"}); err != nil {
+		t.Fatal(err)
+	}
+
+	pa := PolicyArgs{Client: client, Namespace: "ncfs", ConfigMapName: "ncfs-policy", ServerSideApply: true, Policy: `{"UnprocessableFileTypeAction":2}`}
+	if _, err := pa.UpdatePolicy(ctx); !errors.Is(err, ErrConflict) {
+		t.Errorf("error = %v, want ErrConflict", err)
+	}
+	if got := storedPolicy(t, client); got != `{"UnprocessableFileTypeAction":1}` {
+		t.Errorf("stored policy = %s, want the applied one kept", got)
+	}
+}
+
+func TestValidateNames(t *testing.T) {
+	tests := []struct {
+		name          string
+		namespace     string
+		configMapName string
+		valid         bool
+	}{
+		{name: "valid", namespace: "ncfs", configMapName: "ncfs-policy", valid: true},
+		{name: "config map with dots", namespace: "ncfs", configMapName: "ncfs.policy-v2", valid: true},
+		{name: "longest namespace", namespace: strings.Repeat("n", 63), configMapName: "ncfs-policy", valid: true},
+		{name: "longest config map", namespace: "ncfs", configMapName: strings.Repeat("c", 253), valid: true},
+		{name: "uppercase namespace", namespace: "NCFS", configMapName: "ncfs-policy"},
+		{name: "uppercase config map", namespace: "ncfs", configMapName: "NCFS-Policy"},
+		{name: "underscore in namespace", namespace: "ncfs_prod", configMapName: "ncfs-policy"},
+		{name: "underscore in config map", namespace: "ncfs", configMapName: "ncfs_policy"},
+		{name: "overlong namespace", namespace: strings.Repeat("n", 64), configMapName: "ncfs-policy"},
+		{name: "overlong config map", namespace: "ncfs", configMapName: strings.Repeat("c", 254)},
+		{name: "dot in namespace", namespace: "ncfs.prod", configMapName: "ncfs-policy"},
+		{name: "empty", namespace: "", configMapName: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateNames(tt.namespace, tt.configMapName); (err == nil) != tt.valid {
+				t.Errorf("ValidateNames(%q, %q) = %v, want valid %v", tt.namespace, tt.configMapName, err, tt.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ErrTokenRejected is returned by ReviewToken when the API server does not
+// authenticate the token.
+var ErrTokenRejected = errors.New("token rejected by TokenReview")
+
+// Reviewer asks the API server about the identity and permissions of callers.
+type Reviewer struct {
+	Client kubernetes.Interface
+}
+
+// NewReviewer creates a Reviewer using the in-cluster configuration.
+func NewReviewer() (*Reviewer, error) {
+	client, err := NewClient()
+	if err != nil {
+		return nil, &Error{Kind: ErrClientInit, Err: err}
+	}
+
+	return &Reviewer{Client: client}, nil
+}
+
+// ReviewToken authenticates token, typically a ServiceAccount token, with the
+// TokenReview API and returns the user it belongs to. The token must be valid for one
+// of audiences; with none, only for the API server itself.
+func (rv *Reviewer) ReviewToken(parent context.Context, token string, audiences []string) (authenticationv1.UserInfo, error) {
+	ctx, cancel := context.WithTimeout(parent, 5*time.Second)
+	defer cancel()
+
+	review, err := rv.Client.AuthenticationV1().TokenReviews().Create(ctx, &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token, Audiences: audiences},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return authenticationv1.UserInfo{}, classify(err)
+	}
+
+	if !review.Status.Authenticated {
+		if review.Status.Error != "" {
+			return authenticationv1.UserInfo{}, &Error{Kind: ErrTokenRejected, Err: errors.New(review.Status.Error)}
+		}
+		return authenticationv1.UserInfo{}, ErrTokenRejected
+	}
+
+	// the API server reports which of the requested audiences the token is valid for
+	if len(audiences) > 0 && !intersects(review.Status.Audiences, audiences) {
+		return authenticationv1.UserInfo{}, &Error{Kind: ErrTokenRejected, Err: errors.New("token is not valid for the requested audiences")}
+	}
+
+	return review.Status.User, nil
+}
+
+func intersects(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Subject is the user a SubjectAccessReview is performed for.
+type Subject struct {
+	User   string
+	UID    string
+	Groups []string
+	Extra  map[string][]string
+}
+
+// CanUpdateConfigMap asks the API server whether subject may update the config map
+// name in namespace. An empty name checks all config maps in namespace, and an empty
+// namespace checks all namespaces. When denied, the reason given by the authorizer
+// is returned, if any.
+func (rv *Reviewer) CanUpdateConfigMap(parent context.Context, subject Subject, namespace, name string) (bool, string, error) {
+	ctx, cancel := context.WithTimeout(parent, 5*time.Second)
+	defer cancel()
+
+	extra := make(map[string]authorizationv1.ExtraValue, len(subject.Extra))
+	for key, values := range subject.Extra {
+		extra[key] = values
+	}
+
+	review, err := rv.Client.AuthorizationV1().SubjectAccessReviews().Create(ctx, &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   subject.User,
+			UID:    subject.UID,
+			Groups: subject.Groups,
+			Extra:  extra,
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: namespace,
+				Verb:      "update",
+				Resource:  "configmaps",
+				Name:      name,
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return false, "", classify(err)
+	}
+
+	return review.Status.Allowed && !review.Status.Denied, review.Status.Reason, nil
+}
@@ -0,0 +1,136 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// TokenStore keeps records of service tokens as entries of a ConfigMap, keyed by token
+// ID. The records are opaque to the store.
+type TokenStore struct {
+	Client        kubernetes.Interface
+	Namespace     string
+	ConfigMapName string
+}
+
+// GetClient creates the Kubernetes client from the in-cluster configuration.
+func (ts *TokenStore) GetClient() error {
+	args := PolicyArgs{}
+	if err := args.GetClient(); err != nil {
+		return err
+	}
+
+	ts.Client = args.Client
+	return nil
+}
+
+// List returns all token records. A missing ConfigMap holds no records.
+func (ts TokenStore) List(parent context.Context) (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(parent, 5*time.Second)
+	defer cancel()
+
+	configMap, err := ts.Client.CoreV1().ConfigMaps(ts.Namespace).Get(ctx, ts.ConfigMapName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, classify(err)
+	}
+
+	if configMap.Data == nil {
+		return map[string]string{}, nil
+	}
+
+	return configMap.Data, nil
+}
+
+// Get returns the record of token id, and false if there is none.
+func (ts TokenStore) Get(parent context.Context, id string) (string, bool, error) {
+	records, err := ts.List(parent)
+	if err != nil {
+		return "", false, err
+	}
+
+	record, ok := records[id]
+	return record, ok, nil
+}
+
+// Put stores the record of token id, creating the ConfigMap if it does not exist.
+func (ts TokenStore) Put(parent context.Context, id, record string) error {
+	_, err := ts.modify(parent, func(data map[string]string) bool {
+		data[id] = record
+		return true
+	})
+	return err
+}
+
+// Delete removes the record of token id and reports whether there was one.
+func (ts TokenStore) Delete(parent context.Context, id string) (bool, error) {
+	return ts.modify(parent, func(data map[string]string) bool {
+		if _, ok := data[id]; !ok {
+			return false
+		}
+
+		delete(data, id)
+		return true
+	})
+}
+
+// modify applies change to the records and writes them back if it reports a change,
+// retrying a few times when the ConfigMap is modified concurrently.
+func (ts TokenStore) modify(parent context.Context, change func(data map[string]string) bool) (bool, error) {
+	defer lockTarget(ts.Namespace, ts.ConfigMapName)()
+
+	ctx, cancel := context.WithTimeout(parent, 5*time.Second)
+	defer cancel()
+
+	configMaps := ts.Client.CoreV1().ConfigMaps(ts.Namespace)
+
+	var err error
+	for attempt := 0; attempt < 3; attempt++ {
+		var configMap *corev1.ConfigMap
+		configMap, err = configMaps.Get(ctx, ts.ConfigMapName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			data := map[string]string{}
+			if !change(data) {
+				return false, nil
+			}
+
+			_, err = configMaps.Create(ctx, &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: ts.ConfigMapName, Namespace: ts.Namespace},
+				Data:       data,
+			}, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) {
+				continue
+			}
+			return err == nil, classify(err)
+		}
+		if err != nil {
+			return false, classify(err)
+		}
+
+		if configMap.Data == nil {
+			configMap.Data = map[string]string{}
+		}
+		if !change(configMap.Data) {
+			return false, nil
+		}
+
+		_, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{})
+		if apierrors.IsConflict(err) {
+			continue
+		}
+		return err == nil, classify(err)
+	}
+
+	if err == nil {
+		err = errors.New("too many concurrent modifications")
+	}
+	return false, &Error{Kind: ErrConflict, Err: err}
+}